@@ -16,14 +16,24 @@ import (
 )
 
 var sampleDestObject = client.NewSampleCustomDestination()
+var gitDestObject = client.NewGitDestination()
+var s3DestObject = client.NewS3Destination()
+var fsDestObject = client.NewFSDestination()
 var customDestFactory = map[string]client.CustomDestination{
 	"sampleCustomDestination": &sampleDestObject,
+	"git":                     &gitDestObject,
+	"s3":                      &s3DestObject,
+	"localFS":                 &fsDestObject,
 	// Add here a mapping of name -> customDestFactory/empty struct for reference at runtime
 	// See sample above for the built-in sample custom destination that is within the client package
 }
 var apicurioObject = client.NewApicurioSource()
+var s3SrcObject = client.NewS3Source()
+var fsSrcObject = client.NewFSSource()
 var customSrcFactory = map[string]client.CustomSource{
 	"sampleCustomSourceApicurio": &apicurioObject,
+	"s3":                         &s3SrcObject,
+	"localFS":                    &fsSrcObject,
 	// Add here a mapping of name -> customSrcFactory/empty struct for reference at runtime
 	// See sample above for the built-in sample custom source that is within the client package
 }
@@ -77,7 +87,11 @@ func main() {
 			preflightWriteChecks(destClient, false)
 		}
 
-		client.WriteFromFS(destClient, client.PathToWrite, workingDir)
+		if client.IsArchivePath(client.PathToWrite) {
+			client.WriteFromArchive(destClient, client.PathToWrite, workingDir)
+		} else {
+			client.WriteFromFS(destClient, client.PathToWrite, workingDir)
+		}
 
 		log.Println("-----------------------------------------------")
 		log.Println("All Done! Thanks for using ccloud-schema-exporter!")
@@ -97,7 +111,179 @@ func main() {
 		}
 
 		schemaLoader := client.NewSchemaLoader(client.SchemaLoadType, destClient, client.PathToWrite , workingDir)
-		schemaLoader.Run()
+		if client.WatchSchemaLoad {
+			schemaLoader.Watch()
+		} else {
+			schemaLoader.Run()
+		}
+
+		log.Println("-----------------------------------------------")
+		log.Println("All Done! Thanks for using ccloud-schema-exporter!")
+
+		os.Exit(0)
+	}
+
+	if client.ThisRun == client.CHECKCOMPAT {
+		workingDir, err := os.Getwd()
+		if err != nil {
+			log.Fatalln("Could not get execution path. Possibly a permissions issue.")
+		}
+
+		destClient := client.NewSchemaRegistryClient(client.DestSRUrl, client.DestSRKey, client.DestSRSecret, "dst")
+		if !destClient.IsReachable() {
+			log.Fatalln("Could not reach destination registry. Possible bad credentials?")
+		}
+
+		report := client.RunCompatibilityCheck(destClient, client.SchemaLoadType, client.PathToWrite, workingDir)
+		out := client.OpenReportOutput(client.ReportOutput)
+		err = client.WriteCompatibilityReport(report, client.ReportFormat, out)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		out.Close()
+
+		if report.HasIncompatibilities() {
+			log.Println("Some schemas are not compatible with their subject.")
+			os.Exit(1)
+		}
+		log.Println("All schemas are compatible with their subject.")
+		os.Exit(0)
+	}
+
+	if client.ThisRun == client.LINT {
+		workingDir, err := os.Getwd()
+		if err != nil {
+			log.Fatalln("Could not get execution path. Possibly a permissions issue.")
+		}
+
+		rules, err := client.ReadLintRules(client.LintRulesPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		source := client.LintSource
+		if client.SchemaLoadType != "" {
+			source = client.PathToWrite
+		}
+
+		report := client.RunLint(source, client.SchemaLoadType, workingDir, rules)
+		out := client.OpenReportOutput(client.ReportOutput)
+		err = client.WriteLintReport(report, client.ReportFormat, out)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		out.Close()
+
+		if report.Count(client.LINT_ERROR) != 0 {
+			log.Println("Some schemas break lint rules.")
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if client.ThisRun == client.DIFF {
+		workingDir, err := os.Getwd()
+		if err != nil {
+			log.Fatalln("Could not get execution path. Possibly a permissions issue.")
+		}
+
+		report := client.RunDiff(client.DiffLeft, client.DiffRight, workingDir)
+		out := client.OpenReportOutput(client.ReportOutput)
+		err = client.WriteDiffReport(report, client.ReportFormat, out)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		out.Close()
+
+		if len(report.Changes) != 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if client.ThisRun == client.BREAKING {
+		workingDir, err := os.Getwd()
+		if err != nil {
+			log.Fatalln("Could not get execution path. Possibly a permissions issue.")
+		}
+
+		report := client.RunBreakingChanges(client.BreakingFrom, client.BreakingTo, workingDir, client.CompatibilityLevelName)
+		out := client.OpenReportOutput(client.ReportOutput)
+		err = client.WriteBreakingChangeReport(report, client.ReportFormat, out)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		out.Close()
+
+		if report.HasBreakingChanges() {
+			log.Println("Promoting some subjects would break their consumers.")
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if client.ThisRun == client.CATALOG {
+		workingDir, err := os.Getwd()
+		if err != nil {
+			log.Fatalln("Could not get execution path. Possibly a permissions issue.")
+		}
+		format, _ := client.ParseCatalogFormat(client.CatalogFormatName)
+
+		client.WriteCatalog(client.CatalogSource, client.CatalogPath, format, workingDir)
+		log.Println("-----------------------------------------------")
+		log.Println("All Done! Thanks for using ccloud-schema-exporter!")
+		os.Exit(0)
+	}
+
+	if client.ThisRun == client.GRAPH {
+		workingDir, err := os.Getwd()
+		if err != nil {
+			log.Fatalln("Could not get execution path. Possibly a permissions issue.")
+		}
+		direction, _ := client.ParseGraphDirection(client.GraphDirectionName)
+
+		graph := client.BuildDependencyGraph(client.GraphSource, workingDir, client.GraphFilter{
+			Subject: client.GraphSubject, Direction: direction, DanglingOnly: client.GraphDanglingOnly,
+		})
+		out := client.OpenReportOutput(client.ReportOutput)
+		err = client.WriteDependencyGraph(graph, client.GraphFormat, out)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		out.Close()
+
+		if client.GraphDanglingOnly && len(graph.Dangling) != 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if client.ThisRun == client.MERGE {
+		placement, err := client.ParseMergePlacement(client.FanInPlacement)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		sources := []*client.MergeSource{}
+		for spec := range client.FanInSources {
+			if spec == "" {
+				continue
+			}
+			source, err := client.NewMergeSource(spec)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			sources = append(sources, source)
+		}
+
+		destClient := client.NewSchemaRegistryClient(client.DestSRUrl, client.DestSRKey, client.DestSRSecret, "dst")
+		if !client.NoPrompt {
+			preflightWriteChecks(destClient, false)
+		}
+
+		conflicts := client.RunFanInMerge(sources, destClient, placement)
+		if len(conflicts) != 0 {
+			log.Fatalln("Merge aborted due to conflicts between sources.")
+		}
 
 		log.Println("-----------------------------------------------")
 		log.Println("All Done! Thanks for using ccloud-schema-exporter!")
@@ -110,6 +296,40 @@ func main() {
 		log.Fatalln("Could not reach source registry. Possible bad credentials?")
 	}
 
+	if len(client.FanOutDestinations) != 0 {
+		if client.ThisRun != client.SYNC {
+			log.Fatalln("Fan-out destinations are only supported in -sync mode.")
+		}
+
+		client.RunFanOutSync(srcClient, buildFanOutDestinations(srcClient))
+		log.Println("-----------------------------------------------")
+		log.Println("All Done! Thanks for using ccloud-schema-exporter!")
+
+		os.Exit(0)
+	}
+
+	if client.ThisRun == client.VERIFY {
+		destClient := client.NewSchemaRegistryClient(client.DestSRUrl, client.DestSRKey, client.DestSRSecret, "dst")
+		if !destClient.IsReachable() {
+			log.Fatalln("Could not reach destination registry. Possible bad credentials?")
+		}
+
+		report := client.RunVerification(srcClient, destClient, client.VerifyConfig)
+		out := client.OpenReportOutput(client.ReportOutput)
+		err := client.WriteVerificationReport(report, client.ReportFormat, out)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		out.Close()
+
+		if report.HasMismatches() {
+			log.Println("Destination does not match the source.")
+			os.Exit(1)
+		}
+		log.Println("Destination matches the source.")
+		os.Exit(0)
+	}
+
 	if client.CustomDestinationName != "" {
 
 		if client.ThisRun == client.BATCH {
@@ -129,7 +349,13 @@ func main() {
 		if err != nil {
 			log.Fatalln("Could not get execution path. Possibly a permissions issue.")
 		}
-		client.WriteToFS(srcClient, client.PathToWrite, workingDir)
+		if client.IsArchivePath(client.PathToWrite) {
+			client.WriteToArchive(srcClient, client.PathToWrite, workingDir)
+		} else if client.IncrementalBackup {
+			client.WriteIncrementalToFS(srcClient, client.PathToWrite, workingDir)
+		} else {
+			client.WriteToFS(srcClient, client.PathToWrite, workingDir)
+		}
 
 		log.Println("-----------------------------------------------")
 		log.Println("All Done! Thanks for using ccloud-schema-exporter!")
@@ -181,6 +407,33 @@ func main() {
 
 }
 
+// Builds the destinations of a fan-out sync. Entries are matched against custom destinations first,
+// and are otherwise treated as Schema Registry urls.
+func buildFanOutDestinations(srcClient *client.SchemaRegistryClient) []*client.FanOutDestination {
+	destinations := []*client.FanOutDestination{}
+	for destination := range client.FanOutDestinations {
+		if destination == "" {
+			continue
+		}
+		customDest, isCustom := customDestFactory[destination]
+		if isCustom {
+			destinations = append(destinations, client.NewFanOutDestination(destination, customDest))
+			continue
+		}
+		registryDest, err := client.NewRegistryFanOutDestination(srcClient, destination)
+		if err != nil {
+			log.Println(err)
+			log.Fatalln("Could not parse fan-out destination. Destinations must be custom destination names or Schema Registry urls.")
+		}
+		if !client.NoPrompt {
+			dstClient, _ := registryDest.RegistryClient()
+			preflightWriteChecks(dstClient, false)
+		}
+		destinations = append(destinations, registryDest)
+	}
+	return destinations
+}
+
 func preflightWriteChecks(destClient *client.SchemaRegistryClient, noImport bool) {
 
 	if !destClient.IsReachable() {
@@ -190,7 +443,7 @@ func preflightWriteChecks(destClient *client.SchemaRegistryClient, noImport bool
 
 	if !noImport {
 		destSubjects := client.GetCurrentSubjectState(destClient)
-		if len(destSubjects) != 0 && client.ThisRun != client.SYNC {
+		if len(destSubjects) != 0 && client.ThisRun != client.SYNC && client.ThisRun != client.MERGE {
 			log.Println("You have existing subjects registered in the destination registry, exporter cannot write schemas when " +
 				"previous schemas exist in batch mode.")
 			os.Exit(0)
@@ -226,6 +479,7 @@ func preflightWriteChecks(destClient *client.SchemaRegistryClient, noImport bool
 
 		fmt.Println("Destination Schema Registry is not set to NONE global compatibility level!")
 		fmt.Println("We assume the source to be maintaining correct compatibility between registrations, per subject compatibility changes are not supported.")
+		fmt.Println("AVRO schemas can be checked locally instead with -compatibilityLevel.")
 		fmt.Println("------------------------------------------------------")
 		fmt.Println("Set to NONE? (Y/n)")
 
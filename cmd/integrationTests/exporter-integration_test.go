@@ -514,7 +514,8 @@ func testLocalCopy(t *testing.T, expectedFilesToWrite int) {
 	testClientDst.DeleteAllSubjectsPermanently()
 
 	assert.Equal(t, expectedFilesToWrite, count)
-	assert.Equal(t, expectedFilesToWrite, len(files))
+	// One file per schema, plus the manifest
+	assert.Equal(t, expectedFilesToWrite+1, len(files))
 
 	// Test Absolute Paths
 	_ = os.Mkdir(localAbsPath, 0755)
@@ -537,7 +538,20 @@ func testLocalCopy(t *testing.T, expectedFilesToWrite int) {
 	files2, _ := ioutil.ReadDir(localAbsPath)
 
 	assert.Equal(t, expectedFilesToWrite, count)
-	assert.Equal(t, expectedFilesToWrite, len(files2))
+	assert.Equal(t, expectedFilesToWrite+1, len(files2))
+
+	// The destination stays in IMPORT mode, so the backup can be restored into it again
+	assert.Equal(t, "IMPORT", testClientDst.GetGlobalMode())
+	client.WriteFromFS(testClientDst, localAbsPath, currentPath)
+
+	count = 0
+	for _, versions := range client.GetCurrentSubjectState(testClientDst) {
+		count = count + len(versions)
+	}
+
+	testClientDst.DeleteAllSubjectsPermanently()
+
+	assert.Equal(t, expectedFilesToWrite, count)
 
 }
 
@@ -554,15 +568,15 @@ func testSchemaLoadAvro(t *testing.T, expectedLoadNumber int) {
 	}
 
 	// Write files for Schema Load testing
-	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad1", schemaReferencerSchemaLoad)
-	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad2", schemaReferenceForSchemaLoad)
-	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad3", schemaReferenceForSchemaLoadEvolved)
-	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad4", schema)
-	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad5", schema2)
-	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad6", schema3)
-	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad7", schema4)
-	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad8", schema5)
-	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad9", schema6)
+	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad1.avsc", schemaReferencerSchemaLoad)
+	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad2.avsc", schemaReferenceForSchemaLoad)
+	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad3.avsc", schemaReferenceForSchemaLoadEvolved)
+	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad4.avsc", schema)
+	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad5.avsc", schema2)
+	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad6.avsc", schema3)
+	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad7.avsc", schema4)
+	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad8.avsc", schema5)
+	client.WriteFile(currentPath+localRelativePath, "someSchemaLoad9.avsc", schema6)
 	defer os.RemoveAll(currentPath + localRelativePath)
 
 	avroLoader := client.NewSchemaLoader(client.AVRO.String(), testClientDst, "testingLocalBackupRelativePath", currentPath)
@@ -0,0 +1,512 @@
+package client
+
+//
+// archive.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+/*
+Local backups can be written to, and restored from, a single archive instead of a directory.
+The archive format is decided by the extension of -localPath: .tar.gz, .tgz or .zip.
+Archives ending in .age are encrypted with age, and archives ending in .pgp or .gpg with OpenPGP,
+either for the recipients given in -archiveRecipient or with the passphrase in the ARCHIVE_PASSPHRASE environment variable.
+*/
+
+var archiveExtensions = map[string]string{
+	".tar.gz": "tar.gz",
+	".tgz":    "tar.gz",
+	".zip":    "zip",
+}
+
+const (
+	AGE_ENCRYPTION = "age"
+	PGP_ENCRYPTION = "pgp"
+)
+
+var encryptionExtensions = map[string]string{
+	".age": AGE_ENCRYPTION,
+	".pgp": PGP_ENCRYPTION,
+	".gpg": PGP_ENCRYPTION,
+}
+
+// Returns whether the given path describes an archive backup
+func IsArchivePath(path string) bool {
+	format, _ := archiveFormatOf(path)
+	return format != ""
+}
+
+// Returns the archive format of the given path and the encryption it uses, if any.
+// The format is empty if the path does not describe an archive.
+func archiveFormatOf(path string) (string, string) {
+	lowerPath := strings.ToLower(path)
+	encryption := ""
+	for extension, scheme := range encryptionExtensions {
+		if strings.HasSuffix(lowerPath, extension) {
+			encryption = scheme
+			lowerPath = strings.TrimSuffix(lowerPath, extension)
+		}
+	}
+	for extension, format := range archiveExtensions {
+		if strings.HasSuffix(lowerPath, extension) {
+			return format, encryption
+		}
+	}
+	return "", encryption
+}
+
+// Writes a local copy of the source registry into the archive at the given path
+func WriteToArchive(srcClient *SchemaRegistryClient, archivePath string, workingDirectory string) {
+	archivePath = resolveArchivePath(archivePath, workingDirectory)
+
+	stagingDir, err := ioutil.TempDir("", "schema-registry-backup-")
+	check(err)
+	defer os.RemoveAll(stagingDir)
+
+	WriteToFS(srcClient, stagingDir, workingDirectory)
+	if CancelRun == true {
+		log.Println("Interrupted, the archive will not be written")
+		return
+	}
+
+	checkFail(packBackup(stagingDir, archivePath), "Could not write archive "+archivePath)
+	log.Printf("Wrote backup archive %s", archivePath)
+}
+
+// Registers all schemas of the archive at the given path into the destination registry
+func WriteFromArchive(dstClient *SchemaRegistryClient, archivePath string, workingDirectory string) {
+	archivePath = resolveArchivePath(archivePath, workingDirectory)
+
+	stagingDir, err := ioutil.TempDir("", "schema-registry-restore-")
+	check(err)
+	defer os.RemoveAll(stagingDir)
+
+	checkFail(unpackBackup(archivePath, stagingDir), "Could not extract archive "+archivePath)
+
+	log.Printf("Restoring from backup archive %s", archivePath)
+	WriteFromFS(dstClient, stagingDir, workingDirectory)
+}
+
+// Packs the given backup directory into the archive at the given path, encrypting it if needed.
+// The archive is written next to its path and only renamed to it once complete, so that a failed
+// run never leaves a partial archive behind.
+func packBackup(dir string, archivePath string) error {
+	format, encryption := archiveFormatOf(archivePath)
+
+	// Keys are resolved before anything is written
+	encrypt := func(out io.Writer) (io.WriteCloser, error) { return nopWriteCloser{out}, nil }
+	var err error
+	if encryption == AGE_ENCRYPTION {
+		encrypt, err = ageEncrypter()
+	} else if encryption == PGP_ENCRYPTION {
+		encrypt, err = pgpEncrypter()
+	}
+	if err != nil {
+		return err
+	}
+
+	archiveFile, err := ioutil.TempFile(filepath.Dir(archivePath), "."+filepath.Base(archivePath)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archiveFile.Name())
+	defer archiveFile.Close()
+
+	out, err := encrypt(archiveFile)
+	if err != nil {
+		return err
+	}
+	if format == "zip" {
+		err = writeZip(dir, out)
+	} else {
+		err = writeTarGz(dir, out)
+	}
+	if err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := archiveFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(archiveFile.Name(), archivePath)
+}
+
+// Extracts the archive at the given path into the given directory, decrypting it if needed
+func unpackBackup(archivePath string, dir string) error {
+	format, encryption := archiveFormatOf(archivePath)
+
+	archiveFile, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer archiveFile.Close()
+
+	var in io.Reader = archiveFile
+	if encryption == AGE_ENCRYPTION {
+		in, err = ageDecrypt(archiveFile)
+	} else if encryption == PGP_ENCRYPTION {
+		in, err = pgpDecrypt(archiveFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	if format == "zip" {
+		err = extractZip(in, dir)
+	} else {
+		err = extractTarGz(in, dir)
+	}
+	if err != nil || encryption == "" {
+		return err
+	}
+	// Reading the encrypted archive to its end authenticates it
+	_, err = io.Copy(ioutil.Discard, in)
+	return err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// Returns the absolute path of the archive, making sure its directory exists
+func resolveArchivePath(archivePath string, workingDirectory string) string {
+	if !filepath.IsAbs(archivePath) {
+		archivePath = filepath.Join(filepath.Clean(workingDirectory), archivePath)
+	}
+	if _, err := os.Stat(filepath.Dir(archivePath)); os.IsNotExist(err) {
+		log.Println("Path: " + filepath.Dir(archivePath))
+		log.Fatalln("The directory specified for the archive does not exist.")
+	}
+	return archivePath
+}
+
+// Returns a function encrypting archives with age
+func ageEncrypter() (func(io.Writer) (io.WriteCloser, error), error) {
+	recipients, err := archiveRecipients()
+	if err != nil {
+		return nil, err
+	}
+	return func(out io.Writer) (io.WriteCloser, error) {
+		return age.Encrypt(out, recipients...)
+	}, nil
+}
+
+func ageDecrypt(in io.Reader) (io.Reader, error) {
+	identities, err := archiveIdentities()
+	if err != nil {
+		return nil, err
+	}
+	return age.Decrypt(in, identities...)
+}
+
+// Returns the age recipients to encrypt archives for.
+// -archiveRecipient accepts an age public key or a path to a file of public keys.
+func archiveRecipients() ([]age.Recipient, error) {
+	if ArchiveRecipient != "" {
+		if fileExists(ArchiveRecipient) {
+			recipientsFile, err := os.Open(ArchiveRecipient)
+			if err != nil {
+				return nil, err
+			}
+			defer recipientsFile.Close()
+			return age.ParseRecipients(recipientsFile)
+		}
+		recipient, err := age.ParseX25519Recipient(ArchiveRecipient)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Recipient{recipient}, nil
+	}
+
+	passphrase := GetArchivePassphrase()
+	if passphrase == "" {
+		return nil, fmt.Errorf("encrypted archives need -archiveRecipient or the ARCHIVE_PASSPHRASE environment variable")
+	}
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return []age.Recipient{recipient}, nil
+}
+
+// Returns the age identities to decrypt archives with.
+// -archiveIdentity accepts a path to a file of age private keys.
+func archiveIdentities() ([]age.Identity, error) {
+	if ArchiveIdentity != "" {
+		identityFile, err := os.Open(ArchiveIdentity)
+		if err != nil {
+			return nil, err
+		}
+		defer identityFile.Close()
+		return age.ParseIdentities(identityFile)
+	}
+
+	passphrase := GetArchivePassphrase()
+	if passphrase == "" {
+		return nil, fmt.Errorf("encrypted archives need -archiveIdentity or the ARCHIVE_PASSPHRASE environment variable")
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return []age.Identity{identity}, nil
+}
+
+// Returns a function encrypting archives with OpenPGP.
+// -archiveRecipient accepts a path to a file of OpenPGP public keys, armored or not.
+func pgpEncrypter() (func(io.Writer) (io.WriteCloser, error), error) {
+	hints := &openpgp.FileHints{IsBinary: true}
+	if ArchiveRecipient != "" {
+		recipients, err := readPgpKeyRing(ArchiveRecipient)
+		if err != nil {
+			return nil, err
+		}
+		return func(out io.Writer) (io.WriteCloser, error) {
+			return openpgp.Encrypt(out, recipients, nil, hints, nil)
+		}, nil
+	}
+
+	passphrase := GetArchivePassphrase()
+	if passphrase == "" {
+		return nil, fmt.Errorf("encrypted archives need -archiveRecipient or the ARCHIVE_PASSPHRASE environment variable")
+	}
+	return func(out io.Writer) (io.WriteCloser, error) {
+		return openpgp.SymmetricallyEncrypt(out, []byte(passphrase), hints, nil)
+	}, nil
+}
+
+// Decrypts an OpenPGP archive with the private keys in the file given in -archiveIdentity, or with ARCHIVE_PASSPHRASE.
+// ARCHIVE_PASSPHRASE also unlocks private keys protected by a passphrase.
+func pgpDecrypt(in io.Reader) (io.Reader, error) {
+	var keyRing openpgp.EntityList
+	if ArchiveIdentity != "" {
+		var err error
+		keyRing, err = readPgpKeyRing(ArchiveIdentity)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	passphrase := GetArchivePassphrase()
+	if ArchiveIdentity == "" && passphrase == "" {
+		return nil, fmt.Errorf("encrypted archives need -archiveIdentity or the ARCHIVE_PASSPHRASE environment variable")
+	}
+	prompted := false
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		// The passphrase is only offered once, as it is asked for again until it works
+		if prompted {
+			return nil, fmt.Errorf("the archive can not be decrypted with the given keys or passphrase")
+		}
+		prompted = true
+		for _, key := range keys {
+			_ = key.PrivateKey.Decrypt([]byte(passphrase))
+		}
+		return []byte(passphrase), nil
+	}
+
+	message, err := openpgp.ReadMessage(in, keyRing, prompt, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The body of a message checks its integrity every time its end is read, so it is read only once
+	return &stickyErrorReader{reader: message.UnverifiedBody}, nil
+}
+
+// A reader returning the first error of the reader it wraps from then on
+type stickyErrorReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *stickyErrorReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.reader.Read(p)
+	r.err = err
+	return n, err
+}
+
+func readPgpKeyRing(path string) (openpgp.EntityList, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keyRing, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(contents))
+	if err != nil {
+		keyRing, err = openpgp.ReadKeyRing(bytes.NewReader(contents))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read the OpenPGP keys of %s: %w", path, err)
+	}
+	return keyRing, nil
+}
+
+// Calls the given function for every file under the given directory, with its path relative to the directory
+func walkBackupFiles(dir string, fn func(relativePath string, fullPath string, info os.FileInfo) error) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(relativePath), path, info)
+	})
+}
+
+func writeTarGz(dir string, out io.Writer) error {
+	gzipWriter := gzip.NewWriter(out)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	err := walkBackupFiles(dir, func(relativePath string, fullPath string, info os.FileInfo) error {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = relativePath
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		return copyFileInto(fullPath, tarWriter)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+func writeZip(dir string, out io.Writer) error {
+	zipWriter := zip.NewWriter(out)
+
+	err := walkBackupFiles(dir, func(relativePath string, fullPath string, info os.FileInfo) error {
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = relativePath
+		header.Method = zip.Deflate
+		entryWriter, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		return copyFileInto(fullPath, entryWriter)
+	})
+	if err != nil {
+		return err
+	}
+
+	return zipWriter.Close()
+}
+
+func extractTarGz(in io.Reader, dir string) error {
+	gzipReader, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := extractEntry(dir, header.Name, tarReader); err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(in io.Reader, dir string) error {
+	// Zip archives need random access, so they are read fully first
+	contents, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range zipReader.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		entryReader, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		err = extractEntry(dir, entry.Name, entryReader)
+		entryReader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes an archive entry under the given directory, refusing entries that would land outside of it
+func extractEntry(dir string, name string, contents io.Reader) error {
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+		return fmt.Errorf("archive entry %s is outside of the backup", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, contents)
+	return err
+}
+
+func copyFileInto(path string, out io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(out, f)
+	return err
+}
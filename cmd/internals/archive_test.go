@@ -0,0 +1,160 @@
+package client
+
+//
+// archive_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackArchive(t *testing.T) {
+	t.Run("TArchiveFormat", func(t *testing.T) { TArchiveFormat(t) })
+	t.Run("TArchiveRoundTrip", func(t *testing.T) { TArchiveRoundTrip(t) })
+	t.Run("TArchiveEncryptedRoundTrip", func(t *testing.T) { TArchiveEncryptedRoundTrip(t) })
+	t.Run("TArchivePgpRoundTrip", func(t *testing.T) { TArchivePgpRoundTrip(t) })
+	t.Run("TArchiveFailedPack", func(t *testing.T) { TArchiveFailedPack(t) })
+}
+
+func TArchiveFormat(t *testing.T) {
+	format, encryption := archiveFormatOf("backup.tar.gz")
+	assert.Equal(t, "tar.gz", format)
+	assert.Equal(t, "", encryption)
+
+	format, encryption = archiveFormatOf("backup.ZIP.age")
+	assert.Equal(t, "zip", format)
+	assert.Equal(t, AGE_ENCRYPTION, encryption)
+
+	format, encryption = archiveFormatOf("backup.tgz.gpg")
+	assert.Equal(t, "tar.gz", format)
+	assert.Equal(t, PGP_ENCRYPTION, encryption)
+
+	assert.True(t, IsArchivePath("/tmp/backup.tgz"))
+	assert.False(t, IsArchivePath("SchemaRegistryBackup"))
+}
+
+func TArchiveRoundTrip(t *testing.T) {
+	for _, name := range []string{"backup.tar.gz", "backup.zip"} {
+		backupDir := t.TempDir()
+		writeBackupFile(t, backupDir, "test-key-1-10001-AVRO", mockSchema)
+		writeBackupFile(t, backupDir, ManifestFileName, "{}")
+
+		archivePath := filepath.Join(t.TempDir(), name)
+		assert.Nil(t, packBackup(backupDir, archivePath))
+
+		restoreDir := t.TempDir()
+		assert.Nil(t, unpackBackup(archivePath, restoreDir))
+		assertSameFile(t, backupDir, restoreDir, "test-key-1-10001-AVRO")
+		assertSameFile(t, backupDir, restoreDir, ManifestFileName)
+	}
+}
+
+func TArchiveEncryptedRoundTrip(t *testing.T) {
+	t.Setenv("ARCHIVE_PASSPHRASE", "correct horse battery staple")
+
+	backupDir := t.TempDir()
+	writeBackupFile(t, backupDir, "test-key-1-10001-AVRO", mockSchema)
+
+	archivePath := filepath.Join(t.TempDir(), "backup.tar.gz.age")
+	assert.Nil(t, packBackup(backupDir, archivePath))
+
+	restoreDir := t.TempDir()
+	assert.Nil(t, unpackBackup(archivePath, restoreDir))
+	assertSameFile(t, backupDir, restoreDir, "test-key-1-10001-AVRO")
+
+	t.Setenv("ARCHIVE_PASSPHRASE", "wrong passphrase")
+	assert.NotNil(t, unpackBackup(archivePath, t.TempDir()))
+}
+
+// Writes a new OpenPGP key pair, returning the paths of its armored public and private keys
+func writePgpKeys(t *testing.T) (string, string) {
+	entity, err := openpgp.NewEntity("backups", "", "backups@example.com", nil)
+	assert.Nil(t, err)
+
+	keysDir := t.TempDir()
+	publicKey, privateKey := filepath.Join(keysDir, "public.asc"), filepath.Join(keysDir, "private.asc")
+	writeArmored := func(path string, blockType string, serialize func(io.Writer) error) {
+		keyFile, err := os.Create(path)
+		assert.Nil(t, err)
+		w, err := armor.Encode(keyFile, blockType, nil)
+		assert.Nil(t, err)
+		assert.Nil(t, serialize(w))
+		assert.Nil(t, w.Close())
+		assert.Nil(t, keyFile.Close())
+	}
+	writeArmored(publicKey, openpgp.PublicKeyType, entity.Serialize)
+	writeArmored(privateKey, openpgp.PrivateKeyType, func(w io.Writer) error { return entity.SerializePrivate(w, nil) })
+	return publicKey, privateKey
+}
+
+func TArchivePgpRoundTrip(t *testing.T) {
+	defer func() { ArchiveRecipient, ArchiveIdentity = "", "" }()
+	backupDir := t.TempDir()
+	writeBackupFile(t, backupDir, "test-key-1-10001-AVRO", mockSchema)
+
+	// With public keys
+	ArchiveRecipient, ArchiveIdentity = writePgpKeys(t)
+	archivePath := filepath.Join(t.TempDir(), "backup.zip.pgp")
+	assert.Nil(t, packBackup(backupDir, archivePath))
+
+	restoreDir := t.TempDir()
+	assert.Nil(t, unpackBackup(archivePath, restoreDir))
+	assertSameFile(t, backupDir, restoreDir, "test-key-1-10001-AVRO")
+
+	_, ArchiveIdentity = writePgpKeys(t)
+	assert.NotNil(t, unpackBackup(archivePath, t.TempDir()))
+
+	// With a passphrase
+	ArchiveRecipient, ArchiveIdentity = "", ""
+	t.Setenv("ARCHIVE_PASSPHRASE", "correct horse battery staple")
+	archivePath = filepath.Join(t.TempDir(), "backup.tar.gz.gpg")
+	assert.Nil(t, packBackup(backupDir, archivePath))
+
+	restoreDir = t.TempDir()
+	assert.Nil(t, unpackBackup(archivePath, restoreDir))
+	assertSameFile(t, backupDir, restoreDir, "test-key-1-10001-AVRO")
+
+	t.Setenv("ARCHIVE_PASSPHRASE", "wrong passphrase")
+	assert.NotNil(t, unpackBackup(archivePath, t.TempDir()))
+}
+
+func TArchiveFailedPack(t *testing.T) {
+	defer func() { ArchiveRecipient = "" }()
+	backupDir := t.TempDir()
+	writeBackupFile(t, backupDir, "test-key-1-10001-AVRO", mockSchema)
+	archiveDir := t.TempDir()
+
+	// Nothing is written without keys
+	t.Setenv("ARCHIVE_PASSPHRASE", "")
+	assert.NotNil(t, packBackup(backupDir, filepath.Join(archiveDir, "backup.tar.gz.age")))
+	ArchiveRecipient = "not-an-age-key"
+	assert.NotNil(t, packBackup(backupDir, filepath.Join(archiveDir, "backup.tar.gz.age")))
+
+	// A failed write keeps the previous archive
+	archivePath := filepath.Join(archiveDir, "backup.tar.gz")
+	writeBackupFile(t, archiveDir, "backup.tar.gz", "previous archive")
+	assert.NotNil(t, packBackup(filepath.Join(backupDir, "missing"), archivePath))
+
+	entries, err := os.ReadDir(archiveDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	contents, err := os.ReadFile(archivePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "previous archive", string(contents))
+}
+
+func assertSameFile(t *testing.T, expectedDir string, actualDir string, name string) {
+	expected, err := os.ReadFile(filepath.Join(expectedDir, name))
+	assert.Nil(t, err)
+	actual, err := os.ReadFile(filepath.Join(actualDir, name))
+	assert.Nil(t, err)
+	assert.Equal(t, string(expected), string(actual))
+}
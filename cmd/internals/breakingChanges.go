@@ -0,0 +1,501 @@
+package client
+
+//
+// breakingChanges.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Result of a subject whose compatibility can not be checked locally, as only AVRO schemas are
+const UNCHECKED_RESULT = "UNCHECKED"
+
+// Kinds of field changes between the latest version of the target side and the newest version of the source side
+const (
+	FIELD_ADDED        = "ADDED"
+	FIELD_REMOVED      = "REMOVED"
+	FIELD_RENAMED      = "RENAMED"
+	FIELD_TYPE_CHANGED = "TYPE_CHANGED"
+)
+
+// A field of an AVRO record added, removed, renamed or retyped. Fields of nested records are named by their path.
+type FieldChange struct {
+	Change string `json:"change"`
+	Field  string `json:"field"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+}
+
+// What promoting the newest version of a subject from the source side to the target side does to its consumers
+type SubjectPromotion struct {
+	Subject       string        `json:"subject"`
+	Version       int64         `json:"version"`
+	TargetVersion int64         `json:"targetVersion"`
+	Level         string        `json:"level,omitempty"`
+	Result        string        `json:"result"`
+	Messages      []string      `json:"messages,omitempty"`
+	FieldChanges  []FieldChange `json:"fieldChanges,omitempty"`
+}
+
+// The promotions of every subject present on both sides, from the source side to the target side
+type BreakingChangeReport struct {
+	From     string             `json:"from"`
+	To       string             `json:"to"`
+	Subjects []SubjectPromotion `json:"subjects"`
+}
+
+// Returns whether promoting any subject of the report would break its consumers, or could not be checked
+func (bcr BreakingChangeReport) HasBreakingChanges() bool {
+	for _, promotion := range bcr.Subjects {
+		if promotion.Result == INCOMPATIBLE_RESULT || promotion.Result == ERROR_RESULT {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks the newest version of every subject of the source spec against the versions of the subject in the target spec,
+// see openSchemaSnapshot for the accepted specs. Registry targets check with their /compatibility endpoint and the
+// compatibility level of the subject, other targets are checked locally with the given level, BACKWARD when NONE.
+func RunBreakingChanges(fromSpec string, toSpec string, workingDirectory string, level string) BreakingChangeReport {
+	listenForInterruption()
+
+	compatibility, err := ParseCompatibility(level)
+	checkFail(err, "Could not check breaking changes")
+	if compatibility == NONE {
+		compatibility = BACKWARD
+	}
+
+	from := openSchemaSnapshot(fromSpec, workingDirectory)
+	to := openSchemaSnapshot(toSpec, workingDirectory)
+	log.Printf("Checking the promotion of the subjects of %s to %s", from.name, to.name)
+
+	return breakingChanges(from, to, compatibility)
+}
+
+func breakingChanges(from *schemaSnapshot, to *schemaSnapshot, level Compatibility) BreakingChangeReport {
+	report := BreakingChangeReport{From: from.name, To: to.name, Subjects: []SubjectPromotion{}}
+	for subject, versions := range from.subjects {
+		if CancelRun == true {
+			break
+		}
+		if len(versions) == 0 || len(to.subjects[subject]) == 0 {
+			continue
+		}
+		report.Subjects = append(report.Subjects, promotionOf(from, to, subject, level))
+	}
+
+	sort.Slice(report.Subjects, func(i, j int) bool { return report.Subjects[i].Subject < report.Subjects[j].Subject })
+	return report
+}
+
+func promotionOf(from *schemaSnapshot, to *schemaSnapshot, subject string, level Compatibility) SubjectPromotion {
+	version := newestVersion(from.subjects[subject])
+	record := from.getSchema(subject, version).setTypeIfEmpty()
+
+	targetVersions := append([]int64{}, to.subjects[subject]...)
+	sort.Slice(targetVersions, func(i, j int) bool { return targetVersions[i] < targetVersions[j] })
+	targetRecords := make([]SchemaRecord, len(targetVersions))
+	for i, targetVersion := range targetVersions {
+		targetRecords[i] = to.getSchema(subject, targetVersion).setTypeIfEmpty()
+	}
+	latest := targetRecords[len(targetRecords)-1]
+
+	promotion := SubjectPromotion{Subject: subject, Version: version, TargetVersion: latest.Version}
+	if promotion.TargetVersion == 0 {
+		promotion.TargetVersion = targetVersions[len(targetVersions)-1]
+	}
+	promotion.FieldChanges = fieldChangesOf(latest, record)
+
+	for _, targetRecord := range targetRecords {
+		if targetRecord.SType == record.SType && canonicalSchema(record.SType, record.Schema) == canonicalSchema(targetRecord.SType, targetRecord.Schema) {
+			promotion.Result = REGISTERED_RESULT
+			return promotion
+		}
+	}
+
+	if to.registry != nil {
+		promotion.Level = to.registry.GetSubjectCompatibility(subject)
+		if promotion.Level == "" {
+			promotion.Level = to.registry.GetGlobalCompatibility()
+		}
+		response, hasVersions, err := to.registry.TestCompatibility(subject, record.SType, record.Schema, record.References)
+		switch {
+		case err != nil:
+			promotion.Result = ERROR_RESULT
+			promotion.Messages = []string{err.Error()}
+		case !hasVersions:
+			promotion.Result = NEW_SUBJECT_RESULT
+		case response.IsCompatible:
+			promotion.Result = COMPATIBLE_RESULT
+		default:
+			promotion.Result = INCOMPATIBLE_RESULT
+			promotion.Messages = response.Messages
+		}
+		return promotion
+	}
+
+	promotion.Level = level.String()
+	if record.SType != AVRO.String() {
+		promotion.Result = UNCHECKED_RESULT
+		return promotion
+	}
+	schema, err := parseJsonSchema(record.Schema)
+	if err != nil {
+		promotion.Result = ERROR_RESULT
+		promotion.Messages = []string{fmt.Sprintf("version %d is not valid JSON: %v", version, err)}
+		return promotion
+	}
+	previous := []checkedVersion{}
+	for i, targetRecord := range targetRecords {
+		if targetRecord.SType != AVRO.String() {
+			promotion.Result = INCOMPATIBLE_RESULT
+			promotion.Messages = []string{fmt.Sprintf("version %d of the target is a %s schema", targetVersions[i], targetRecord.SType)}
+			return promotion
+		}
+		targetSchema, err := parseJsonSchema(targetRecord.Schema)
+		if err != nil {
+			promotion.Result = ERROR_RESULT
+			promotion.Messages = []string{fmt.Sprintf("version %d of the target is not valid JSON: %v", targetVersions[i], err)}
+			return promotion
+		}
+		previous = append(previous, checkedVersion{version: targetVersions[i], schema: targetSchema})
+	}
+
+	promotion.Messages = avroCompatibilityProblems(schema, previous, level)
+	promotion.Result = COMPATIBLE_RESULT
+	if len(promotion.Messages) != 0 {
+		promotion.Result = INCOMPATIBLE_RESULT
+	}
+	return promotion
+}
+
+func newestVersion(versions []int64) int64 {
+	newest := versions[0]
+	for _, version := range versions {
+		if version > newest {
+			newest = version
+		}
+	}
+	return newest
+}
+
+func parseJsonSchema(schema string) (interface{}, error) {
+	var parsed interface{}
+	err := json.Unmarshal([]byte(schema), &parsed)
+	return parsed, err
+}
+
+// Returns the field changes from the previous version to the given version, when both are AVRO schemas
+func fieldChangesOf(previous SchemaRecord, record SchemaRecord) []FieldChange {
+	if previous.SType != AVRO.String() || record.SType != AVRO.String() {
+		return nil
+	}
+	previousSchema, err := parseJsonSchema(previous.Schema)
+	if err != nil {
+		return nil
+	}
+	schema, err := parseJsonSchema(record.Schema)
+	if err != nil {
+		return nil
+	}
+	return avroFieldChanges(previousSchema, schema)
+}
+
+// Compares the fields of the records found at the same places of two AVRO schemas
+type avroFieldComparison struct {
+	previousTypes map[string]avroNamedType
+	types         map[string]avroNamedType
+	compared      map[string]bool // Names of the records compared, as records may be recursive or used by several fields
+	changes       []FieldChange
+}
+
+// Returns the fields added, removed, renamed and retyped from the previous schema to the given schema,
+// in the order of the fields of the given schema, fields removed last
+func avroFieldChanges(previous interface{}, schema interface{}) []FieldChange {
+	comparison := &avroFieldComparison{
+		previousTypes: avroNamedTypesOf(previous),
+		types:         avroNamedTypesOf(schema),
+		compared:      map[string]bool{},
+		changes:       []FieldChange{},
+	}
+	comparison.compare(previous, "", schema, "", "")
+	return comparison.changes
+}
+
+func (afc *avroFieldComparison) compare(previous interface{}, previousNamespace string, schema interface{}, namespace string, path string) {
+	previousRecord, previousNamespace := avroRecordOf(previous, previousNamespace, afc.previousTypes)
+	record, namespace := avroRecordOf(schema, namespace, afc.types)
+	if previousRecord == nil || record == nil {
+		return
+	}
+	comparedNames := avroDefinitionName(previousRecord, previousNamespace) + "\n" + avroDefinitionName(record, namespace)
+	if afc.compared[comparedNames] {
+		return
+	}
+	afc.compared[comparedNames] = true
+
+	previousFields := map[string]map[string]interface{}{}
+	previousOrder := []string{}
+	for _, field := range avroFieldsOf(previousRecord) {
+		name, _ := field["name"].(string)
+		previousFields[name] = field
+		previousOrder = append(previousOrder, name)
+	}
+
+	matched := map[string]bool{}
+	removed := []FieldChange{}
+	for _, field := range avroFieldsOf(record) {
+		name, _ := field["name"].(string)
+		previousName := name
+		previousField, existed := previousFields[name]
+		if !existed {
+			for _, alias := range avroStringsOf(field["aliases"]) {
+				if previousField, existed = previousFields[alias]; existed && !matched[alias] {
+					previousName = alias
+					break
+				}
+			}
+		}
+		if !existed || matched[previousName] {
+			afc.changes = append(afc.changes, FieldChange{Change: FIELD_ADDED, Field: path + name, To: avroTypeLabel(field["type"], namespace)})
+			continue
+		}
+		matched[previousName] = true
+
+		if previousName != name {
+			afc.changes = append(afc.changes, FieldChange{Change: FIELD_RENAMED, Field: path + name, From: path + previousName, To: path + name})
+		}
+		previousType, fieldType := avroTypeLabel(previousField["type"], previousNamespace), avroTypeLabel(field["type"], namespace)
+		if previousType != fieldType {
+			afc.changes = append(afc.changes, FieldChange{Change: FIELD_TYPE_CHANGED, Field: path + name, From: previousType, To: fieldType})
+		}
+		afc.compare(previousField["type"], previousNamespace, field["type"], namespace, path+name+".")
+	}
+
+	for _, name := range previousOrder {
+		if !matched[name] {
+			removed = append(removed, FieldChange{Change: FIELD_REMOVED, Field: path + name, From: avroTypeLabel(previousFields[name]["type"], previousNamespace)})
+		}
+	}
+	afc.changes = append(afc.changes, removed...)
+}
+
+// Returns the record a field of the given type holds: the type itself, the items of an array, the values of a map,
+// or the only record of a union, along with the namespace of the names it uses
+func avroRecordOf(schema interface{}, namespace string, namedTypes map[string]avroNamedType) (map[string]interface{}, string) {
+	definition, namespace := definitionOf(schema, namespace, namedTypes)
+	switch avroKindOf(definition) {
+	case "record":
+		return definition.(map[string]interface{}), namespace
+	case "array":
+		return avroRecordOf(definition.(map[string]interface{})["items"], namespace, namedTypes)
+	case "map":
+		return avroRecordOf(definition.(map[string]interface{})["values"], namespace, namedTypes)
+	case "union":
+		var found map[string]interface{}
+		foundNamespace := namespace
+		for _, member := range definition.([]interface{}) {
+			if record, recordNamespace := avroRecordOf(member, namespace, namedTypes); record != nil {
+				if found != nil {
+					return nil, namespace
+				}
+				found, foundNamespace = record, recordNamespace
+			}
+		}
+		return found, foundNamespace
+	}
+	return nil, namespace
+}
+
+func avroFieldsOf(record map[string]interface{}) []map[string]interface{} {
+	fields := []map[string]interface{}{}
+	fieldList, _ := record["fields"].([]interface{})
+	for _, field := range fieldList {
+		if fieldMap, isMap := field.(map[string]interface{}); isMap {
+			fields = append(fields, fieldMap)
+		}
+	}
+	return fields
+}
+
+func avroStringsOf(value interface{}) []string {
+	values := []string{}
+	list, _ := value.([]interface{})
+	for _, item := range list {
+		if text, isString := item.(string); isString {
+			values = append(values, text)
+		}
+	}
+	return values
+}
+
+// Returns a short description of the given type used within the given namespace, such as
+// union<null, com.acme.Address>, array<string> or long (timestamp-millis)
+func avroTypeLabel(schema interface{}, namespace string) string {
+	switch typed := schema.(type) {
+	case string:
+		if avroPrimitiveTypes[typed] {
+			return typed
+		}
+		return avroFullName(typed, namespace)
+	case []interface{}:
+		members := []string{}
+		for _, member := range typed {
+			members = append(members, avroTypeLabel(member, namespace))
+		}
+		return "union<" + strings.Join(members, ", ") + ">"
+	case map[string]interface{}:
+		label := ""
+		switch typed["type"] {
+		case "record", "error", "enum", "fixed":
+			label = avroDefinitionName(typed, avroNamespaceOf(typed, namespace))
+		case "array":
+			label = "array<" + avroTypeLabel(typed["items"], namespace) + ">"
+		case "map":
+			label = "map<" + avroTypeLabel(typed["values"], namespace) + ">"
+		default:
+			label = avroTypeLabel(typed["type"], namespace)
+		}
+		if logicalType, hasLogicalType := typed["logicalType"].(string); hasLogicalType {
+			label = fmt.Sprintf("%s (%s)", label, logicalType)
+		}
+		return label
+	}
+	return fmt.Sprint(schema)
+}
+
+// Writes the breaking change report in the given format: TEXT, MARKDOWN or JSON
+func WriteBreakingChangeReport(report BreakingChangeReport, format string, out io.Writer) error {
+	switch strings.ToUpper(format) {
+	case "", "TEXT":
+		return writeBreakingChangeText(report, out)
+	case "MARKDOWN", "MD":
+		return writeBreakingChangeMarkdown(report, out)
+	case "JSON":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return fmt.Errorf("unknown report format %s, expected one of TEXT, MARKDOWN or JSON", format)
+}
+
+// Counts the subjects of the report by result
+func (bcr BreakingChangeReport) counts() map[string]int {
+	counts := map[string]int{}
+	for _, promotion := range bcr.Subjects {
+		counts[promotion.Result]++
+	}
+	return counts
+}
+
+func (sp SubjectPromotion) versions() string {
+	description := fmt.Sprintf("version %d against version %d", sp.Version, sp.TargetVersion)
+	if sp.Level != "" {
+		description += ", " + sp.Level
+	}
+	return description
+}
+
+func (fc FieldChange) String() string {
+	switch fc.Change {
+	case FIELD_ADDED:
+		return fmt.Sprintf("%s %s: %s", fc.Change, fc.Field, fc.To)
+	case FIELD_REMOVED:
+		return fmt.Sprintf("%s %s: %s", fc.Change, fc.Field, fc.From)
+	}
+	return fmt.Sprintf("%s %s: %s -> %s", fc.Change, fc.Field, fc.From, fc.To)
+}
+
+func writeBreakingChangeText(report BreakingChangeReport, out io.Writer) error {
+	for _, promotion := range report.Subjects {
+		if len(promotion.Messages) == 0 && len(promotion.FieldChanges) == 0 && promotion.Result != INCOMPATIBLE_RESULT {
+			continue
+		}
+		if _, err := fmt.Fprintf(out, "%s %s (%s)\n", promotion.Result, promotion.Subject, promotion.versions()); err != nil {
+			return err
+		}
+		for _, message := range promotion.Messages {
+			if _, err := fmt.Fprintf(out, "  %s\n", message); err != nil {
+				return err
+			}
+		}
+		for _, change := range promotion.FieldChanges {
+			if _, err := fmt.Fprintf(out, "  %s\n", change); err != nil {
+				return err
+			}
+		}
+	}
+	counts := report.counts()
+	_, err := fmt.Fprintf(out, "Checked %d subjects of %s against %s: %d compatible, %d incompatible, %d registered, %d unchecked, %d errors\n",
+		len(report.Subjects), report.From, report.To, counts[COMPATIBLE_RESULT], counts[INCOMPATIBLE_RESULT],
+		counts[REGISTERED_RESULT], counts[UNCHECKED_RESULT], counts[ERROR_RESULT])
+	return err
+}
+
+func writeBreakingChangeMarkdown(report BreakingChangeReport, out io.Writer) error {
+	var markdown strings.Builder
+	counts := report.counts()
+	fmt.Fprintf(&markdown, "### Promoting %s to %s\n\n", markdownCode(report.From), markdownCode(report.To))
+	if counts[INCOMPATIBLE_RESULT] != 0 {
+		fmt.Fprintf(&markdown, "**%d of %d subjects would break their consumers.**\n\n", counts[INCOMPATIBLE_RESULT], len(report.Subjects))
+	} else {
+		fmt.Fprintf(&markdown, "No subject of the %d checked would break its consumers.\n\n", len(report.Subjects))
+	}
+	if counts[ERROR_RESULT] != 0 {
+		fmt.Fprintf(&markdown, "**%d subjects could not be checked.**\n\n", counts[ERROR_RESULT])
+	}
+	if len(report.Subjects) == 0 {
+		_, err := io.WriteString(out, markdown.String())
+		return err
+	}
+
+	markdown.WriteString("| Subject | Version | Target version | Level | Result | Field changes |\n")
+	markdown.WriteString("| --- | ---: | ---: | --- | --- | ---: |\n")
+	for _, promotion := range report.Subjects {
+		fmt.Fprintf(&markdown, "| %s | %d | %d | %s | %s | %d |\n", markdownCode(promotion.Subject), promotion.Version,
+			promotion.TargetVersion, promotion.Level, promotion.Result, len(promotion.FieldChanges))
+	}
+
+	for _, promotion := range report.Subjects {
+		if len(promotion.Messages) == 0 && len(promotion.FieldChanges) == 0 {
+			continue
+		}
+		fmt.Fprintf(&markdown, "\n#### %s: %s\n\n", markdownCode(promotion.Subject), promotion.Result)
+		for _, message := range promotion.Messages {
+			fmt.Fprintf(&markdown, "- %s\n", markdownCode(message))
+		}
+		if len(promotion.Messages) != 0 && len(promotion.FieldChanges) != 0 {
+			markdown.WriteString("\n")
+		}
+		if len(promotion.FieldChanges) != 0 {
+			markdown.WriteString("| Change | Field | From | To |\n| --- | --- | --- | --- |\n")
+			for _, change := range promotion.FieldChanges {
+				fmt.Fprintf(&markdown, "| %s | %s | %s | %s |\n", change.Change, markdownCode(change.Field),
+					markdownCode(change.From), markdownCode(change.To))
+			}
+		}
+	}
+
+	_, err := io.WriteString(out, markdown.String())
+	return err
+}
+
+// Returns the given text as inline code usable in a table cell, or nothing for empty texts
+func markdownCode(text string) string {
+	if text == "" {
+		return ""
+	}
+	fence := "`"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + strings.ReplaceAll(text, "|", "\\|") + fence
+}
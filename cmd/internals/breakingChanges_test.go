@@ -0,0 +1,196 @@
+package client
+
+//
+// breakingChanges_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackBreakingChanges(t *testing.T) {
+	t.Run("TAvroFieldChanges", func(t *testing.T) { TAvroFieldChanges(t) })
+	t.Run("TBreakingChangesLocal", func(t *testing.T) { TBreakingChangesLocal(t) })
+	t.Run("TBreakingChangesRegistry", func(t *testing.T) { TBreakingChangesRegistry(t) })
+	t.Run("TWriteBreakingChangeReport", func(t *testing.T) { TWriteBreakingChangeReport(t) })
+}
+
+func TAvroFieldChanges(t *testing.T) {
+	previous := avroSchemaOf(t, `{"type":"record","name":"Order","namespace":"com.acme","fields":[
+		{"name":"id","type":"string"},
+		{"name":"amount","type":"double"},
+		{"name":"placed","type":{"type":"long","logicalType":"timestamp-millis"}},
+		{"name":"customer","type":{"type":"record","name":"Customer","fields":[
+			{"name":"name","type":"string"},{"name":"email","type":"string"}]}},
+		{"name":"lines","type":{"type":"array","items":{"type":"record","name":"Line","fields":[{"name":"sku","type":"string"}]}}},
+		{"name":"billing","type":"Customer"}]}`)
+	schema := avroSchemaOf(t, `{"type":"record","name":"Order","namespace":"com.acme","fields":[
+		{"name":"id","type":"string"},
+		{"name":"total","type":"double","aliases":["amount"]},
+		{"name":"placed","type":{"type":"long","logicalType":"timestamp-micros"}},
+		{"name":"customer","type":["null",{"type":"record","name":"Customer","fields":[
+			{"name":"name","type":"string"},{"name":"phone","type":["null","string"],"default":null}]}]},
+		{"name":"lines","type":{"type":"array","items":{"type":"record","name":"Line","fields":[{"name":"sku","type":"long"}]}}},
+		{"name":"note","type":{"type":"map","values":"string"}}]}`)
+
+	assert.Equal(t, []FieldChange{
+		{Change: FIELD_RENAMED, Field: "total", From: "amount", To: "total"},
+		{Change: FIELD_TYPE_CHANGED, Field: "placed", From: "long (timestamp-millis)", To: "long (timestamp-micros)"},
+		{Change: FIELD_TYPE_CHANGED, Field: "customer", From: "com.acme.Customer", To: "union<null, com.acme.Customer>"},
+		{Change: FIELD_ADDED, Field: "customer.phone", To: "union<null, string>"},
+		{Change: FIELD_REMOVED, Field: "customer.email", From: "string"},
+		{Change: FIELD_TYPE_CHANGED, Field: "lines.sku", From: "string", To: "long"},
+		{Change: FIELD_ADDED, Field: "note", To: "map<string>"},
+		{Change: FIELD_REMOVED, Field: "billing", From: "com.acme.Customer"},
+	}, avroFieldChanges(previous, schema))
+
+	// Recursive records are compared once
+	linkedList := avroSchemaOf(t, `{"type":"record","name":"Node","fields":[{"name":"value","type":"int"},{"name":"next","type":["null","Node"]}]}`)
+	assert.Equal(t, []FieldChange{}, avroFieldChanges(linkedList, linkedList))
+	assert.Equal(t, []FieldChange{}, avroFieldChanges(avroSchemaOf(t, `"string"`), linkedList))
+}
+
+func writeBreakingChangeBackups(t *testing.T) (string, string) {
+	fromDir, toDir := t.TempDir(), t.TempDir()
+	writeBackupFile(t, toDir, "orders-1-10001-AVRO", compatOrderV1)
+	writeBackupFile(t, toDir, "orders-2-10002-AVRO", compatOrderV2)
+	writeBackupFile(t, fromDir, "orders-3-10003-AVRO", compatOrderV3)
+
+	invoice := `{"type":"record","name":"Invoice","namespace":"com.acme","fields":[]}`
+	writeBackupFile(t, toDir, "invoices-1-10004-AVRO", invoice)
+	writeBackupFile(t, fromDir, "invoices-1-10004-AVRO", strings.ReplaceAll(invoice, ",", ", "))
+
+	writeBackupFile(t, toDir, "payments-1-10005-AVRO", compatOrderV1)
+	writeBackupFile(t, fromDir, "payments-2-10006-AVRO", compatOrderV2)
+
+	writeBackupFile(t, toDir, "proto-1-10007-PROTOBUF", `syntax = "proto3"; message A {}`)
+	writeBackupFile(t, fromDir, "proto-2-10008-PROTOBUF", `syntax = "proto3"; message B {}`)
+
+	// Subjects only present on one side are not checked
+	writeBackupFile(t, fromDir, "customers-1-10009-AVRO", invoice)
+	return fromDir, toDir
+}
+
+func TBreakingChangesLocal(t *testing.T) {
+	fromDir, toDir := writeBreakingChangeBackups(t)
+
+	report := RunBreakingChanges(fromDir, toDir, "", "NONE")
+	assert.Equal(t, fromDir, report.From)
+	assert.Equal(t, toDir, report.To)
+	assert.Equal(t, []SubjectPromotion{
+		{Subject: "invoices", Version: 1, TargetVersion: 1, Result: REGISTERED_RESULT, FieldChanges: []FieldChange{}},
+		{Subject: "orders", Version: 3, TargetVersion: 2, Level: "BACKWARD", Result: INCOMPATIBLE_RESULT,
+			Messages:     []string{"can not read data written with version 2, #/fields/3: field total has no default and is missing from the record written"},
+			FieldChanges: []FieldChange{{Change: FIELD_ADDED, Field: "total", To: "double"}}},
+		{Subject: "payments", Version: 2, TargetVersion: 1, Level: "BACKWARD", Result: COMPATIBLE_RESULT, Messages: []string{},
+			FieldChanges: []FieldChange{
+				{Change: FIELD_TYPE_CHANGED, Field: "count", From: "int", To: "long"},
+				{Change: FIELD_ADDED, Field: "note", To: "union<null, string>"},
+			}},
+		{Subject: "proto", Version: 2, TargetVersion: 1, Level: "BACKWARD", Result: UNCHECKED_RESULT},
+	}, report.Subjects)
+	assert.True(t, report.HasBreakingChanges())
+
+	// FORWARD_TRANSITIVE checks every version of the target reads the newest version
+	report = RunBreakingChanges(fromDir, toDir, "", "FORWARD_TRANSITIVE")
+	assert.Equal(t, INCOMPATIBLE_RESULT, report.Subjects[2].Result)
+	assert.Equal(t, []string{"version 1 can not read data written with it, #/fields/1/type: the long written can not be read as int"},
+		report.Subjects[2].Messages)
+}
+
+func TBreakingChangesRegistry(t *testing.T) {
+	HttpCallTimeout = 60
+	registry := newFakeRegistry()
+	compatibility := withCompatibilityEndpoint(registry)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/config/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/config" {
+			_, _ = w.Write([]byte(`{"compatibilityLevel":"BACKWARD"}`))
+			return
+		}
+		compatibility.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	dstClient := NewSchemaRegistryClient(server.URL, "key", "secret", "dst")
+	dstClient.RegisterSchema(compatOrderV1, "orders", AVRO.String(), nil)
+	dstClient.RegisterSchema(compatOrderV2, "orders", AVRO.String(), nil)
+
+	fromDir, _ := writeBreakingChangeBackups(t)
+	to := &schemaSnapshot{
+		name:     server.URL,
+		subjects: map[string][]int64{"orders": {1, 2}},
+		getSchema: func(subject string, version int64) SchemaRecord {
+			schema := registry.subjects[subject][version-1]
+			return SchemaRecord{Subject: subject, Schema: schema.Schema, SType: schema.SType, Version: version, Id: schema.Id}
+		},
+		registry: dstClient,
+	}
+
+	report := breakingChanges(newLocalSnapshot(fromDir), to, BACKWARD)
+	assert.Equal(t, []SubjectPromotion{
+		{Subject: "orders", Version: 3, TargetVersion: 2, Level: "BACKWARD", Result: INCOMPATIBLE_RESULT,
+			Messages:     []string{"#/fields/3: field total has no default and is missing from the record written"},
+			FieldChanges: []FieldChange{{Change: FIELD_ADDED, Field: "total", To: "double"}}},
+	}, report.Subjects)
+}
+
+func TWriteBreakingChangeReport(t *testing.T) {
+	report := BreakingChangeReport{From: "staging", To: "https://prod", Subjects: []SubjectPromotion{
+		{Subject: "invoices-value", Version: 1, TargetVersion: 1, Result: REGISTERED_RESULT},
+		{Subject: "orders-value", Version: 3, TargetVersion: 2, Level: "BACKWARD", Result: INCOMPATIBLE_RESULT,
+			Messages:     []string{"#/fields/3: field total has no default"},
+			FieldChanges: []FieldChange{{Change: FIELD_ADDED, Field: "total", To: "double"}, {Change: FIELD_TYPE_CHANGED, Field: "note", From: "string", To: "union<null, string>"}}},
+		{Subject: "payments-value", Version: 2, TargetVersion: 1, Level: "BACKWARD", Result: COMPATIBLE_RESULT,
+			FieldChanges: []FieldChange{{Change: FIELD_REMOVED, Field: "legacy", From: "string"}}},
+	}}
+
+	var text bytes.Buffer
+	assert.Nil(t, WriteBreakingChangeReport(report, "TEXT", &text))
+	assert.Equal(t, "INCOMPATIBLE orders-value (version 3 against version 2, BACKWARD)\n"+
+		"  #/fields/3: field total has no default\n"+
+		"  ADDED total: double\n"+
+		"  TYPE_CHANGED note: string -> union<null, string>\n"+
+		"COMPATIBLE payments-value (version 2 against version 1, BACKWARD)\n"+
+		"  REMOVED legacy: string\n"+
+		"Checked 3 subjects of staging against https://prod: 1 compatible, 1 incompatible, 1 registered, 0 unchecked, 0 errors\n",
+		text.String())
+
+	var markdown bytes.Buffer
+	assert.Nil(t, WriteBreakingChangeReport(report, "markdown", &markdown))
+	assert.Equal(t, "### Promoting `staging` to `https://prod`\n\n"+
+		"**1 of 3 subjects would break their consumers.**\n\n"+
+		"| Subject | Version | Target version | Level | Result | Field changes |\n"+
+		"| --- | ---: | ---: | --- | --- | ---: |\n"+
+		"| `invoices-value` | 1 | 1 |  | REGISTERED | 0 |\n"+
+		"| `orders-value` | 3 | 2 | BACKWARD | INCOMPATIBLE | 2 |\n"+
+		"| `payments-value` | 2 | 1 | BACKWARD | COMPATIBLE | 1 |\n"+
+		"\n#### `orders-value`: INCOMPATIBLE\n\n"+
+		"- `#/fields/3: field total has no default`\n\n"+
+		"| Change | Field | From | To |\n| --- | --- | --- | --- |\n"+
+		"| ADDED | `total` |  | `double` |\n"+
+		"| TYPE_CHANGED | `note` | `string` | `union<null, string>` |\n"+
+		"\n#### `payments-value`: COMPATIBLE\n\n"+
+		"| Change | Field | From | To |\n| --- | --- | --- | --- |\n"+
+		"| REMOVED | `legacy` | `string` |  |\n", markdown.String())
+
+	var jsonReport bytes.Buffer
+	assert.Nil(t, WriteBreakingChangeReport(report, "JSON", &jsonReport))
+	decoded := BreakingChangeReport{}
+	assert.Nil(t, json.Unmarshal(jsonReport.Bytes(), &decoded))
+	assert.Equal(t, report, decoded)
+
+	assert.NotNil(t, WriteBreakingChangeReport(report, "JUNIT", &text))
+	assert.Equal(t, "`a\\|b`", markdownCode("a|b"))
+	assert.Equal(t, "``a`b``", markdownCode("a`b"))
+}
@@ -0,0 +1,487 @@
+package client
+
+//
+// catalog.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+The catalog is a static site documenting the subjects of a registry or local backup: an index of the subjects,
+and a page per subject holding its versions, newest first, each with its ID, type, references and the versions
+referencing it, its fields and their docs, its schema pretty printed, and its changes from the version before it.
+Field tables are built for AVRO and JSON schemas, fields of nested records and objects named by their path.
+*/
+
+// Define CatalogFormat Enum
+type CatalogFormat int
+
+const (
+	HTML_CATALOG CatalogFormat = iota
+	MARKDOWN_CATALOG
+)
+
+func (cf CatalogFormat) String() string {
+	return [...]string{"HTML", "MARKDOWN"}[cf]
+}
+
+func (cf CatalogFormat) extension() string {
+	return [...]string{".html", ".md"}[cf]
+}
+
+func ParseCatalogFormat(format string) (CatalogFormat, error) {
+	switch strings.ToUpper(format) {
+	case "", HTML_CATALOG.String():
+		return HTML_CATALOG, nil
+	case MARKDOWN_CATALOG.String(), "MD":
+		return MARKDOWN_CATALOG, nil
+	}
+	return HTML_CATALOG, fmt.Errorf("unknown catalog format %s, expected one of HTML or MARKDOWN", format)
+}
+
+// A link from a subject page to a version of a subject, Href being empty for versions missing from the catalog
+type catalogLink struct {
+	Label string
+	Name  string // Name the schema is referenced by, for references
+	Href  string
+}
+
+// A field of a schema, named by its path
+type catalogField struct {
+	Name    string
+	Type    string
+	Default string
+	Doc     string
+}
+
+type catalogVersion struct {
+	Record       SchemaRecord
+	Anchor       string
+	Doc          string
+	Pretty       string
+	Fields       []catalogField
+	References   []catalogLink
+	ReferencedBy []catalogLink
+	Previous     int64  // Version the changes are from, 0 for the first version
+	Diff         string // Unified diff from the previous version
+}
+
+type catalogSubject struct {
+	Subject  string
+	Page     string // Escaped name of the page file, linked from pages of the subjects directory
+	Versions []*catalogVersion
+}
+
+func (cs *catalogSubject) Latest() *catalogVersion {
+	return cs.Versions[0]
+}
+
+type schemaCatalog struct {
+	Source   string
+	Subjects []*catalogSubject
+}
+
+// Writes the catalog of the subjects of the given source spec, see openSchemaSnapshot for the accepted specs,
+// to the given directory, created when missing
+func WriteCatalog(sourceSpec string, outputPath string, format CatalogFormat, workingDirectory string) {
+	listenForInterruption()
+
+	if !filepath.IsAbs(outputPath) {
+		outputPath = filepath.Join(workingDirectory, outputPath)
+	}
+	snapshot := openSchemaSnapshot(sourceSpec, workingDirectory)
+	log.Printf("Writing the %s catalog of %s to %s", format, snapshot.name, outputPath)
+
+	catalog := buildCatalog(snapshot, format)
+	err := writeCatalogFiles(catalog, outputPath, format)
+	checkFail(err, "Could not write the catalog")
+	log.Printf("Wrote the catalog of %d subjects to %s", len(catalog.Subjects), outputPath)
+}
+
+func buildCatalog(snapshot *schemaSnapshot, format CatalogFormat) *schemaCatalog {
+	catalog := &schemaCatalog{Source: snapshot.name, Subjects: []*catalogSubject{}}
+	pages := map[string]string{}
+	for subject := range snapshot.subjects {
+		pages[subject] = url.PathEscape(url.QueryEscape(subject) + format.extension())
+	}
+	linkTo := func(subject string, version int64) string {
+		if !isInSlice(version, snapshot.subjects[subject]) {
+			return ""
+		}
+		return fmt.Sprintf("%s#v%d", pages[subject], version)
+	}
+
+	referencedBy := map[SubjectVersion][]catalogLink{}
+	for subject, versions := range snapshot.subjects {
+		if CancelRun == true {
+			break
+		}
+		if len(versions) == 0 {
+			continue
+		}
+		sortedVersions := append([]int64{}, versions...)
+		sort.Slice(sortedVersions, func(i, j int) bool { return sortedVersions[i] > sortedVersions[j] })
+
+		catalogEntry := &catalogSubject{Subject: subject, Page: pages[subject]}
+		for _, version := range sortedVersions {
+			record := snapshot.getSchema(subject, version).setTypeIfEmpty()
+			record.Version = version
+			entry := &catalogVersion{Record: record, Anchor: fmt.Sprintf("v%d", version), Pretty: prettySchema(record)}
+			entry.Doc, entry.Fields = catalogFieldsOf(record)
+			for _, reference := range record.References {
+				entry.References = append(entry.References, catalogLink{
+					Label: fmt.Sprintf("%s version %d", reference.Subject, reference.Version),
+					Name:  reference.Name,
+					Href:  linkTo(reference.Subject, reference.Version),
+				})
+				referenced := SubjectVersion{Subject: reference.Subject, Version: reference.Version}
+				referencedBy[referenced] = append(referencedBy[referenced], catalogLink{
+					Label: fmt.Sprintf("%s version %d", subject, version),
+					Href:  linkTo(subject, version),
+				})
+			}
+			catalogEntry.Versions = append(catalogEntry.Versions, entry)
+		}
+
+		for i, entry := range catalogEntry.Versions[:len(catalogEntry.Versions)-1] {
+			previous := catalogEntry.Versions[i+1]
+			entry.Previous = previous.Record.Version
+			entry.Diff = unifiedDiff(previous.Pretty, entry.Pretty, fmt.Sprintf("%s/versions/%d", subject, previous.Record.Version),
+				fmt.Sprintf("%s/versions/%d", subject, entry.Record.Version))
+		}
+		catalog.Subjects = append(catalog.Subjects, catalogEntry)
+	}
+
+	for _, catalogEntry := range catalog.Subjects {
+		for _, entry := range catalogEntry.Versions {
+			entry.ReferencedBy = referencedBy[SubjectVersion{Subject: catalogEntry.Subject, Version: entry.Record.Version}]
+			sort.Slice(entry.ReferencedBy, func(i, j int) bool { return entry.ReferencedBy[i].Label < entry.ReferencedBy[j].Label })
+		}
+	}
+	sort.Slice(catalog.Subjects, func(i, j int) bool { return catalog.Subjects[i].Subject < catalog.Subjects[j].Subject })
+	return catalog
+}
+
+// Returns the doc of the given schema and its fields, for AVRO and JSON schemas
+func catalogFieldsOf(record SchemaRecord) (string, []catalogField) {
+	if record.SType != AVRO.String() && record.SType != JSON.String() {
+		return "", nil
+	}
+	schema, err := parseJsonSchema(record.Schema)
+	if err != nil {
+		return "", nil
+	}
+	fields := []catalogField{}
+	if record.SType == JSON.String() {
+		jsonSchemaFields(schema, "", map[string]bool{}, &fields)
+		return jsonSchemaDoc(schema), fields
+	}
+
+	namedTypes := avroNamedTypesOf(schema)
+	avroCatalogFields(schema, "", "", namedTypes, map[string]bool{}, &fields)
+	doc := ""
+	if root, _ := avroRecordOf(schema, "", namedTypes); root != nil {
+		doc, _ = root["doc"].(string)
+	}
+	return doc, fields
+}
+
+// Appends the fields of the record held by the given AVRO type, and of the records nested in them, to the given fields
+func avroCatalogFields(schema interface{}, namespace string, path string, namedTypes map[string]avroNamedType, listed map[string]bool,
+	fields *[]catalogField) {
+	record, namespace := avroRecordOf(schema, namespace, namedTypes)
+	if record == nil || listed[avroDefinitionName(record, namespace)] {
+		return
+	}
+	listed[avroDefinitionName(record, namespace)] = true
+
+	for _, field := range avroFieldsOf(record) {
+		name, _ := field["name"].(string)
+		doc, _ := field["doc"].(string)
+		*fields = append(*fields, catalogField{
+			Name: path + name, Type: avroTypeLabel(field["type"], namespace), Default: catalogDefaultOf(field), Doc: doc,
+		})
+		avroCatalogFields(field["type"], namespace, path+name+".", namedTypes, listed, fields)
+	}
+}
+
+// Appends the properties of the given JSON schema, and of the objects nested in them, to the given fields
+func jsonSchemaFields(schema interface{}, path string, listed map[string]bool, fields *[]catalogField) {
+	object, isObject := schema.(map[string]interface{})
+	if !isObject {
+		return
+	}
+	if items, hasItems := object["items"]; hasItems {
+		jsonSchemaFields(items, path, listed, fields)
+	}
+	properties, _ := object["properties"].(map[string]interface{})
+	names := []string{}
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, _ := properties[name].(map[string]interface{})
+		if listed[path+name] {
+			continue
+		}
+		listed[path+name] = true
+		*fields = append(*fields, catalogField{
+			Name: path + name, Type: jsonSchemaTypeOf(property), Default: catalogDefaultOf(property), Doc: jsonSchemaDoc(property),
+		})
+		jsonSchemaFields(property, path+name+".", listed, fields)
+	}
+}
+
+func jsonSchemaTypeOf(property map[string]interface{}) string {
+	switch typed := property["type"].(type) {
+	case string:
+		if items, isMap := property["items"].(map[string]interface{}); typed == "array" && isMap {
+			return "array<" + jsonSchemaTypeOf(items) + ">"
+		}
+		return typed
+	case []interface{}:
+		return strings.Join(avroStringsOf(typed), ", ")
+	}
+	if reference, hasReference := property["$ref"].(string); hasReference {
+		return reference
+	}
+	return ""
+}
+
+func jsonSchemaDoc(schema interface{}) string {
+	object, _ := schema.(map[string]interface{})
+	if description, hasDescription := object["description"].(string); hasDescription {
+		return description
+	}
+	title, _ := object["title"].(string)
+	return title
+}
+
+func catalogDefaultOf(definition map[string]interface{}) string {
+	value, hasDefault := definition["default"]
+	if !hasDefault {
+		return ""
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+func writeCatalogFiles(catalog *schemaCatalog, outputPath string, format CatalogFormat) error {
+	subjectsPath := filepath.Join(outputPath, "subjects")
+	if err := os.MkdirAll(subjectsPath, 0755); err != nil {
+		return err
+	}
+
+	index, err := renderCatalogIndex(catalog, format)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(outputPath, "index"+format.extension()), []byte(index), 0644); err != nil {
+		return err
+	}
+	for _, subject := range catalog.Subjects {
+		page, err := renderCatalogSubject(catalog, subject, format)
+		if err != nil {
+			return err
+		}
+		fileName := url.QueryEscape(subject.Subject) + format.extension()
+		if err := ioutil.WriteFile(filepath.Join(subjectsPath, fileName), []byte(page), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderCatalogIndex(catalog *schemaCatalog, format CatalogFormat) (string, error) {
+	if format == HTML_CATALOG {
+		var page strings.Builder
+		err := catalogTemplates.ExecuteTemplate(&page, "index", catalog)
+		return page.String(), err
+	}
+
+	var page strings.Builder
+	fmt.Fprintf(&page, "# Schema catalog of %s\n\n", markdownCode(catalog.Source))
+	fmt.Fprintf(&page, "%d subjects.\n\n", len(catalog.Subjects))
+	page.WriteString("| Subject | Latest version | Versions | Type | Doc |\n| --- | ---: | ---: | --- | --- |\n")
+	for _, subject := range catalog.Subjects {
+		latest := subject.Latest()
+		fmt.Fprintf(&page, "| [%s](subjects/%s) | %d | %d | %s | %s |\n", markdownText(subject.Subject), subject.Page,
+			latest.Record.Version, len(subject.Versions), latest.Record.SType, markdownText(latest.Doc))
+	}
+	return page.String(), nil
+}
+
+func renderCatalogSubject(catalog *schemaCatalog, subject *catalogSubject, format CatalogFormat) (string, error) {
+	if format == HTML_CATALOG {
+		var page strings.Builder
+		err := catalogTemplates.ExecuteTemplate(&page, "subject", struct {
+			Source string
+			*catalogSubject
+		}{Source: catalog.Source, catalogSubject: subject})
+		return page.String(), err
+	}
+
+	var page strings.Builder
+	fmt.Fprintf(&page, "# %s\n\n[Schema catalog](../index.md) of %s\n\n", markdownText(subject.Subject), markdownCode(catalog.Source))
+	if doc := subject.Latest().Doc; doc != "" {
+		fmt.Fprintf(&page, "%s\n\n", doc)
+	}
+	page.WriteString("| Version | ID | Type | References | Referenced by |\n| ---: | ---: | --- | ---: | ---: |\n")
+	for _, version := range subject.Versions {
+		fmt.Fprintf(&page, "| [%d](#%s) | %d | %s | %d | %d |\n", version.Record.Version, version.Anchor, version.Record.Id,
+			version.Record.SType, len(version.References), len(version.ReferencedBy))
+	}
+
+	for _, version := range subject.Versions {
+		fmt.Fprintf(&page, "\n<a id=\"%s\"></a>\n\n## Version %d\n\nID %d, %s schema.\n", version.Anchor, version.Record.Version,
+			version.Record.Id, version.Record.SType)
+		if len(version.Fields) != 0 {
+			page.WriteString("\n### Fields\n\n| Field | Type | Default | Doc |\n| --- | --- | --- | --- |\n")
+			for _, field := range version.Fields {
+				fmt.Fprintf(&page, "| %s | %s | %s | %s |\n", markdownCode(field.Name), markdownCode(field.Type),
+					markdownCode(field.Default), markdownText(field.Doc))
+			}
+		}
+		writeMarkdownLinks(&page, "References", version.References)
+		writeMarkdownLinks(&page, "Referenced by", version.ReferencedBy)
+
+		language := "json"
+		if version.Record.SType == PROTOBUF.String() {
+			language = "protobuf"
+		}
+		fmt.Fprintf(&page, "\n### Schema\n\n```%s\n%s\n```\n", language, strings.TrimRight(version.Pretty, "\n"))
+		if version.Previous != 0 {
+			fmt.Fprintf(&page, "\n### Changes from version %d\n\n```diff\n%s```\n", version.Previous, version.Diff)
+		}
+	}
+	return page.String(), nil
+}
+
+func writeMarkdownLinks(page *strings.Builder, title string, links []catalogLink) {
+	if len(links) == 0 {
+		return
+	}
+	fmt.Fprintf(page, "\n### %s\n\n", title)
+	for _, link := range links {
+		label := markdownText(link.Label)
+		if link.Href != "" {
+			label = fmt.Sprintf("[%s](%s)", label, link.Href)
+		} else {
+			label += " (missing)"
+		}
+		if link.Name != "" {
+			label = fmt.Sprintf("%s: %s", markdownCode(link.Name), label)
+		}
+		fmt.Fprintf(page, "- %s\n", label)
+	}
+}
+
+// Returns the given text escaped for Markdown table cells and links, on a single line
+func markdownText(text string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "|", "\\|", "[", "\\[", "]", "\\]", "*", "\\*", "_", "\\_", "`", "\\`",
+		"<", "&lt;", "\r\n", " ", "\n", " ")
+	return replacer.Replace(text)
+}
+
+var catalogTemplates = template.Must(template.New("catalog").Parse(`
+{{- define "head" -}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 70em; padding: 0 1em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+pre { background: #f6f8fa; padding: 1em; overflow-x: auto; }
+code { font-family: monospace; }
+.missing { color: #a00; }
+</style>
+</head>
+<body>
+{{end -}}
+
+{{- define "links" -}}
+<ul>
+{{- range .}}
+<li>{{if .Name}}<code>{{.Name}}</code>: {{end}}{{if .Href}}<a href="{{.Href}}">{{.Label}}</a>{{else}}<span class="missing">{{.Label}} (missing)</span>{{end}}</li>
+{{- end}}
+</ul>
+{{end -}}
+
+{{- define "index" -}}
+{{template "head" "Schema catalog"}}
+<h1>Schema catalog of <code>{{.Source}}</code></h1>
+<p>{{len .Subjects}} subjects.</p>
+<table>
+<tr><th>Subject</th><th>Latest version</th><th>Versions</th><th>Type</th><th>Doc</th></tr>
+{{- range .Subjects}}
+<tr><td><a href="subjects/{{.Page}}">{{.Subject}}</a></td><td>{{.Latest.Record.Version}}</td><td>{{len .Versions}}</td><td>{{.Latest.Record.SType}}</td><td>{{.Latest.Doc}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+{{end -}}
+
+{{- define "subject" -}}
+{{template "head" .Subject}}
+<h1>{{.Subject}}</h1>
+<p><a href="../index.html">Schema catalog</a> of <code>{{.Source}}</code></p>
+{{- with .Latest.Doc}}
+<p>{{.}}</p>
+{{- end}}
+<table>
+<tr><th>Version</th><th>ID</th><th>Type</th><th>References</th><th>Referenced by</th></tr>
+{{- range .Versions}}
+<tr><td><a href="#{{.Anchor}}">{{.Record.Version}}</a></td><td>{{.Record.Id}}</td><td>{{.Record.SType}}</td><td>{{len .References}}</td><td>{{len .ReferencedBy}}</td></tr>
+{{- end}}
+</table>
+{{range .Versions}}
+<h2 id="{{.Anchor}}">Version {{.Record.Version}}</h2>
+<p>ID {{.Record.Id}}, {{.Record.SType}} schema.</p>
+{{- if .Fields}}
+<h3>Fields</h3>
+<table>
+<tr><th>Field</th><th>Type</th><th>Default</th><th>Doc</th></tr>
+{{- range .Fields}}
+<tr><td><code>{{.Name}}</code></td><td><code>{{.Type}}</code></td><td>{{with .Default}}<code>{{.}}</code>{{end}}</td><td>{{.Doc}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .References}}
+<h3>References</h3>
+{{template "links" .References}}
+{{- end}}
+{{- if .ReferencedBy}}
+<h3>Referenced by</h3>
+{{template "links" .ReferencedBy}}
+{{- end}}
+<h3>Schema</h3>
+<pre><code>{{.Pretty}}</code></pre>
+{{- if .Previous}}
+<h3>Changes from version {{.Previous}}</h3>
+<pre><code>{{.Diff}}</code></pre>
+{{- end}}
+{{end -}}
+</body>
+</html>
+{{end -}}
+`))
@@ -0,0 +1,169 @@
+package client
+
+//
+// catalog_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackCatalog(t *testing.T) {
+	t.Run("TParseCatalogFormat", func(t *testing.T) { TParseCatalogFormat(t) })
+	t.Run("TCatalogFields", func(t *testing.T) { TCatalogFields(t) })
+	t.Run("TBuildCatalog", func(t *testing.T) { TBuildCatalog(t) })
+	t.Run("TWriteMarkdownCatalog", func(t *testing.T) { TWriteMarkdownCatalog(t) })
+	t.Run("TWriteHtmlCatalog", func(t *testing.T) { TWriteHtmlCatalog(t) })
+}
+
+const catalogAddress = `{"type":"record","name":"Address","namespace":"com.acme","doc":"A postal address","fields":[
+	{"name":"street","type":"string","doc":"Street and number"}]}`
+
+const catalogCustomerV1 = `{"type":"record","name":"Customer","namespace":"com.acme","doc":"A <customer>","fields":[
+	{"name":"name","type":"string","doc":"Full name"}]}`
+
+const catalogCustomerV2 = `{"type":"record","name":"Customer","namespace":"com.acme","doc":"A <customer>","fields":[
+	{"name":"name","type":"string","doc":"Full name"},
+	{"name":"address","type":["null","com.acme.Address"],"default":null}]}`
+
+// Writes a backup of an address subject referenced by the second version of a customer subject
+func writeCatalogBackup(t *testing.T) string {
+	return writeFlatBackup(t, []SchemaRecord{
+		{Subject: "address-value", Version: 1, Id: 1, SType: AVRO.String(), Schema: catalogAddress},
+		{Subject: "customers-value", Version: 1, Id: 2, SType: AVRO.String(), Schema: catalogCustomerV1},
+		{Subject: "customers-value", Version: 2, Id: 3, SType: AVRO.String(), Schema: catalogCustomerV2, References: []SchemaReference{
+			{Name: "com.acme.Address", Subject: "address-value", Version: 1},
+			{Name: "com.acme.Phone", Subject: "phone-value", Version: 4},
+		}},
+		{Subject: ":.ctx:events", Version: 1, Id: 4, SType: PROTOBUF.String(), Schema: `syntax = "proto3"; message Event {}`},
+	})
+}
+
+func TParseCatalogFormat(t *testing.T) {
+	format, err := ParseCatalogFormat("")
+	assert.Nil(t, err)
+	assert.Equal(t, HTML_CATALOG, format)
+	format, err = ParseCatalogFormat("markdown")
+	assert.Nil(t, err)
+	assert.Equal(t, MARKDOWN_CATALOG, format)
+	_, err = ParseCatalogFormat("PDF")
+	assert.NotNil(t, err)
+}
+
+func TCatalogFields(t *testing.T) {
+	doc, fields := catalogFieldsOf(SchemaRecord{SType: AVRO.String(), Schema: `{"type":"record","name":"Order","namespace":"com.acme","doc":"An order","fields":[
+		{"name":"id","type":"string","doc":"Identifier"},
+		{"name":"placed","type":{"type":"long","logicalType":"timestamp-millis"},"default":0},
+		{"name":"customer","type":{"type":"record","name":"Customer","fields":[{"name":"name","type":"string"}]}},
+		{"name":"billing","type":"Customer"}]}`})
+	assert.Equal(t, "An order", doc)
+	assert.Equal(t, []catalogField{
+		{Name: "id", Type: "string", Doc: "Identifier"},
+		{Name: "placed", Type: "long (timestamp-millis)", Default: "0"},
+		{Name: "customer", Type: "com.acme.Customer"},
+		{Name: "customer.name", Type: "string"},
+		{Name: "billing", Type: "com.acme.Customer"},
+	}, fields)
+
+	doc, fields = catalogFieldsOf(SchemaRecord{SType: JSON.String(), Schema: `{"type":"object","description":"An order","properties":{
+		"tags":{"type":"array","items":{"type":"string"}},
+		"id":{"type":"string","description":"Identifier"},
+		"customer":{"type":["object","null"],"properties":{"name":{"type":"string","default":""}}}}}`})
+	assert.Equal(t, "An order", doc)
+	assert.Equal(t, []catalogField{
+		{Name: "customer", Type: "object, null"},
+		{Name: "customer.name", Type: "string", Default: `""`},
+		{Name: "id", Type: "string", Doc: "Identifier"},
+		{Name: "tags", Type: "array<string>"},
+	}, fields)
+
+	doc, fields = catalogFieldsOf(SchemaRecord{SType: PROTOBUF.String(), Schema: `syntax = "proto3";`})
+	assert.Equal(t, "", doc)
+	assert.Nil(t, fields)
+}
+
+func TBuildCatalog(t *testing.T) {
+	backupDir := writeCatalogBackup(t)
+	catalog := buildCatalog(newLocalSnapshot(backupDir), MARKDOWN_CATALOG)
+
+	assert.Equal(t, backupDir, catalog.Source)
+	assert.Equal(t, 3, len(catalog.Subjects))
+	assert.Equal(t, ":.ctx:events", catalog.Subjects[0].Subject)
+	assert.Equal(t, "%253A.ctx%253Aevents.md", catalog.Subjects[0].Page)
+
+	address := catalog.Subjects[1]
+	assert.Equal(t, []catalogLink{{Label: "customers-value version 2", Href: "customers-value.md#v2"}}, address.Latest().ReferencedBy)
+
+	customers := catalog.Subjects[2]
+	assert.Equal(t, []int64{2, 1}, []int64{customers.Versions[0].Record.Version, customers.Versions[1].Record.Version})
+	assert.Equal(t, "A <customer>", customers.Latest().Doc)
+	assert.Equal(t, []catalogLink{
+		{Label: "address-value version 1", Name: "com.acme.Address", Href: "address-value.md#v1"},
+		{Label: "phone-value version 4", Name: "com.acme.Phone"},
+	}, customers.Latest().References)
+	assert.Equal(t, int64(1), customers.Latest().Previous)
+	assert.Contains(t, customers.Latest().Diff, "+++ customers-value/versions/2\n")
+	assert.Contains(t, customers.Latest().Diff, "+    {\n")
+	assert.Equal(t, int64(0), customers.Versions[1].Previous)
+	assert.Equal(t, "", customers.Versions[1].Diff)
+}
+
+func readCatalogPage(t *testing.T, path string) string {
+	contents, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	return string(contents)
+}
+
+func TWriteMarkdownCatalog(t *testing.T) {
+	catalogDir := filepath.Join(t.TempDir(), "catalog")
+	backupDir := writeCatalogBackup(t)
+	WriteCatalog(backupDir, catalogDir, MARKDOWN_CATALOG, "")
+
+	assert.Equal(t, "# Schema catalog of `"+backupDir+"`\n\n3 subjects.\n\n"+
+		"| Subject | Latest version | Versions | Type | Doc |\n| --- | ---: | ---: | --- | --- |\n"+
+		"| [:.ctx:events](subjects/%253A.ctx%253Aevents.md) | 1 | 1 | PROTOBUF |  |\n"+
+		"| [address-value](subjects/address-value.md) | 1 | 1 | AVRO | A postal address |\n"+
+		"| [customers-value](subjects/customers-value.md) | 2 | 2 | AVRO | A &lt;customer> |\n",
+		readCatalogPage(t, filepath.Join(catalogDir, "index.md")))
+
+	customers := readCatalogPage(t, filepath.Join(catalogDir, "subjects", "customers-value.md"))
+	assert.Contains(t, customers, "| [2](#v2) | 3 | AVRO | 2 | 0 |\n| [1](#v1) | 2 | AVRO | 0 | 0 |\n")
+	assert.Contains(t, customers, "<a id=\"v2\"></a>\n\n## Version 2\n\nID 3, AVRO schema.\n")
+	assert.Contains(t, customers, "| `address` | `union<null, com.acme.Address>` | `null` |  |\n")
+	assert.Contains(t, customers, "### References\n\n- `com.acme.Address`: [address-value version 1](address-value.md#v1)\n"+
+		"- `com.acme.Phone`: phone-value version 4 (missing)\n")
+	assert.Contains(t, customers, "### Changes from version 1\n\n```diff\n--- customers-value/versions/1\n")
+
+	address := readCatalogPage(t, filepath.Join(catalogDir, "subjects", "address-value.md"))
+	assert.Contains(t, address, "### Referenced by\n\n- [customers-value version 2](customers-value.md#v2)\n")
+	assert.NotContains(t, address, "### Changes")
+
+	events := readCatalogPage(t, filepath.Join(catalogDir, "subjects", "%3A.ctx%3Aevents.md"))
+	assert.Contains(t, events, "```protobuf\nsyntax = \"proto3\"; message Event {}\n```\n")
+}
+
+func TWriteHtmlCatalog(t *testing.T) {
+	catalogDir := t.TempDir()
+	WriteCatalog(writeCatalogBackup(t), catalogDir, HTML_CATALOG, "")
+
+	index := readCatalogPage(t, filepath.Join(catalogDir, "index.html"))
+	assert.Contains(t, index, "<p>3 subjects.</p>")
+	assert.Contains(t, index, `<tr><td><a href="subjects/%253A.ctx%253Aevents.html">:.ctx:events</a></td><td>1</td><td>1</td><td>PROTOBUF</td><td></td></tr>`)
+	assert.Contains(t, index, `<td>A &lt;customer&gt;</td>`)
+
+	customers := readCatalogPage(t, filepath.Join(catalogDir, "subjects", "customers-value.html"))
+	assert.Contains(t, customers, `<h2 id="v2">Version 2</h2>`)
+	assert.Contains(t, customers, `<li><code>com.acme.Address</code>: <a href="address-value.html#v1">address-value version 1</a></li>`)
+	assert.Contains(t, customers, `<li><code>com.acme.Phone</code>: <span class="missing">phone-value version 4 (missing)</span></li>`)
+	assert.Contains(t, customers, `<tr><td><code>address</code></td><td><code>union&lt;null, com.acme.Address&gt;</code></td><td><code>null</code></td><td></td></tr>`)
+	assert.Contains(t, customers, "<h3>Changes from version 1</h3>")
+
+	address := readCatalogPage(t, filepath.Join(catalogDir, "subjects", "address-value.html"))
+	assert.Contains(t, address, `<h3>Referenced by</h3>`)
+	assert.Contains(t, address, `<a href="customers-value.html#v2">customers-value version 2</a>`)
+}
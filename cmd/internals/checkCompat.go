@@ -0,0 +1,151 @@
+package client
+
+//
+// checkCompat.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Results of testing a schema against the latest version of its subject
+const (
+	COMPATIBLE_RESULT   = "COMPATIBLE"
+	INCOMPATIBLE_RESULT = "INCOMPATIBLE"
+	REGISTERED_RESULT   = "REGISTERED"  // The schema is registered under the subject already
+	NEW_SUBJECT_RESULT  = "NEW_SUBJECT" // The subject has no version to test against
+	ERROR_RESULT        = "ERROR"
+)
+
+// The result of testing one schema against the registry
+type CompatibilityCheck struct {
+	Subject  string   `json:"subject"`
+	File     string   `json:"file"`
+	Result   string   `json:"result"`
+	Messages []string `json:"messages,omitempty"`
+}
+
+// The result of testing a directory of schemas against a registry
+type CompatibilityReport struct {
+	RegistryUrl string               `json:"registryUrl"`
+	Path        string               `json:"path"`
+	Checks      []CompatibilityCheck `json:"checks"`
+}
+
+// Returns whether any schema of the report is incompatible with its subject, or could not be tested
+func (cr CompatibilityReport) HasIncompatibilities() bool {
+	for _, compatCheck := range cr.Checks {
+		if compatCheck.Result == INCOMPATIBLE_RESULT || compatCheck.Result == ERROR_RESULT {
+			return true
+		}
+	}
+	return false
+}
+
+// Collects the checks of a schema load only testing schemas against the registry
+type compatibilityCheckRun struct {
+	report CompatibilityReport
+	tested map[string]bool // Subject and schema of the checks made, as referenced schemas are met several times
+}
+
+// Tests every schema of the given path, read the same way the given type of schema load reads them, against the
+// latest version of the subject it would be registered under, with the compatibility level of the subject.
+// Nothing is registered: schemas referencing schemas not registered yet are reported as errors.
+func RunCompatibilityCheck(dstClient *SchemaRegistryClient, schemaType string, givenPath string, workingDirectory string) CompatibilityReport {
+	loader := NewSchemaLoader(schemaType, dstClient, givenPath, workingDirectory)
+	loader.compatChecks = &compatibilityCheckRun{
+		report: CompatibilityReport{RegistryUrl: dstClient.SRUrl, Path: loader.path, Checks: []CompatibilityCheck{}},
+		tested: map[string]bool{},
+	}
+
+	log.Printf("Checking the compatibility of the schemas of %s against %s", loader.path, dstClient.SRUrl)
+	loader.Run()
+
+	checks := loader.compatChecks.report.Checks
+	sort.SliceStable(checks, func(i, j int) bool { return checks[i].Subject < checks[j].Subject })
+	return loader.compatChecks.report
+}
+
+// Tests the given schema, read from the given file, against the latest version of the subject
+func (ccr *compatibilityCheckRun) test(dstClient *SchemaRegistryClient, subject string, schemaType string, schema string,
+	references []SchemaReference, file string) {
+	if ccr.tested[subject+"\n"+schema] {
+		return
+	}
+	ccr.tested[subject+"\n"+schema] = true
+
+	compatCheck := CompatibilityCheck{Subject: subject, File: file}
+	if dstClient.schemaIsRegisteredUnderSubject(subject, schemaType, schema, references) {
+		compatCheck.Result = REGISTERED_RESULT
+	} else {
+		response, hasVersions, err := dstClient.TestCompatibility(subject, schemaType, schema, references)
+		switch {
+		case err != nil:
+			compatCheck.Result = ERROR_RESULT
+			compatCheck.Messages = []string{err.Error()}
+		case !hasVersions:
+			compatCheck.Result = NEW_SUBJECT_RESULT
+		case response.IsCompatible:
+			compatCheck.Result = COMPATIBLE_RESULT
+		default:
+			compatCheck.Result = INCOMPATIBLE_RESULT
+			compatCheck.Messages = response.Messages
+		}
+	}
+
+	log.Printf("%s against %s: %s", file, subject, compatCheck.Result)
+	ccr.report.Checks = append(ccr.report.Checks, compatCheck)
+}
+
+// Reports the given schema, read from the given file, as not tested against the subject for the given reason
+func (ccr *compatibilityCheckRun) fail(subject string, schema string, file string, reason string) {
+	if ccr.tested[subject+"\n"+schema] {
+		return
+	}
+	ccr.tested[subject+"\n"+schema] = true
+
+	log.Printf("%s against %s: %s, %s", file, subject, ERROR_RESULT, reason)
+	ccr.report.Checks = append(ccr.report.Checks, CompatibilityCheck{Subject: subject, File: file, Result: ERROR_RESULT,
+		Messages: []string{"Could not test the schema, " + reason}})
+}
+
+// Writes the compatibility report in the given format: TEXT or JSON
+func WriteCompatibilityReport(report CompatibilityReport, format string, out io.Writer) error {
+	switch strings.ToUpper(format) {
+	case "", "TEXT":
+		return writeCompatibilityText(report, out)
+	case "JSON":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return fmt.Errorf("unknown report format %s, expected one of TEXT or JSON", format)
+}
+
+func writeCompatibilityText(report CompatibilityReport, out io.Writer) error {
+	counts := map[string]int{}
+	for _, compatCheck := range report.Checks {
+		counts[compatCheck.Result]++
+		if compatCheck.Result != INCOMPATIBLE_RESULT && compatCheck.Result != ERROR_RESULT {
+			continue
+		}
+		if _, err := fmt.Fprintf(out, "%s %s (%s)\n", compatCheck.Result, compatCheck.Subject, compatCheck.File); err != nil {
+			return err
+		}
+		for _, message := range compatCheck.Messages {
+			if _, err := fmt.Fprintf(out, "  %s\n", message); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintf(out, "Checked %d schemas of %s against %s: %d compatible, %d incompatible, %d registered, %d new subjects, %d errors\n",
+		len(report.Checks), report.Path, report.RegistryUrl, counts[COMPATIBLE_RESULT], counts[INCOMPATIBLE_RESULT],
+		counts[REGISTERED_RESULT], counts[NEW_SUBJECT_RESULT], counts[ERROR_RESULT])
+	return err
+}
@@ -0,0 +1,138 @@
+package client
+
+//
+// checkCompat_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackCheckCompat(t *testing.T) {
+	t.Run("TRunCompatibilityCheck", func(t *testing.T) { TRunCompatibilityCheck(t) })
+	t.Run("TRunProtobufCompatibilityCheck", func(t *testing.T) { TRunProtobufCompatibilityCheck(t) })
+	t.Run("TWriteCompatibilityReport", func(t *testing.T) { TWriteCompatibilityReport(t) })
+}
+
+// Answers the /compatibility endpoint of the given registry with BACKWARD checks of the local engine
+func withCompatibilityEndpoint(registry *fakeRegistry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+		if len(parts) < 3 || parts[0] != "compatibility" {
+			registry.ServeHTTP(w, r)
+			return
+		}
+		subject, _ := url.PathUnescape(parts[2])
+		request := SchemaToRegister{}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+
+		registry.lock.Lock()
+		versions := registry.subjects[subject]
+		registry.lock.Unlock()
+		if len(versions) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error_code":40401,"message":"Subject not found"}`))
+			return
+		}
+
+		var candidate, latest interface{}
+		_ = json.Unmarshal([]byte(request.Schema), &candidate)
+		_ = json.Unmarshal([]byte(versions[len(versions)-1].Schema), &latest)
+		messages := avroReadProblems(candidate, latest)
+		_ = json.NewEncoder(w).Encode(CompatibilityResponse{IsCompatible: len(messages) == 0, Messages: messages})
+	})
+}
+
+func TRunCompatibilityCheck(t *testing.T) {
+	HttpCallTimeout = 60
+	registry := newFakeRegistry()
+	server := httptest.NewServer(withCompatibilityEndpoint(registry))
+	defer server.Close()
+	dstClient := NewSchemaRegistryClient(server.URL, "key", "secret", "dst")
+
+	registeredDir := t.TempDir()
+	writeWatchedFile(t, registeredDir, "order.avsc", compatOrderV2)
+	writeWatchedFile(t, registeredDir, "invoice.avsc", `{"type":"record","name":"Invoice","namespace":"com.acme","fields":[]}`)
+	NewSchemaLoader(AVRO.String(), dstClient, registeredDir, "").Run()
+
+	schemaDir := t.TempDir()
+	writeWatchedFile(t, schemaDir, "order.avsc", compatOrderV3)
+	writeWatchedFile(t, schemaDir, "invoice.avsc", `{"type":"record","name":"Invoice","namespace":"com.acme","fields":[]}`)
+	writeWatchedFile(t, schemaDir, "customer.avsc", `{"type":"record","name":"Customer","namespace":"com.acme","fields":[]}`)
+
+	report := RunCompatibilityCheck(dstClient, AVRO.String(), schemaDir, "")
+	assert.Equal(t, []CompatibilityCheck{
+		{Subject: "com.acme.Customer-value", File: filepath.Join(schemaDir, "customer.avsc"), Result: NEW_SUBJECT_RESULT},
+		{Subject: "com.acme.Invoice-value", File: filepath.Join(schemaDir, "invoice.avsc"), Result: REGISTERED_RESULT},
+		{Subject: "com.acme.Order-value", File: filepath.Join(schemaDir, "order.avsc"), Result: INCOMPATIBLE_RESULT,
+			Messages: []string{"#/fields/3: field total has no default and is missing from the record written"}},
+	}, report.Checks)
+	assert.True(t, report.HasIncompatibilities())
+
+	// Nothing is registered
+	assert.Equal(t, 1, registry.versionCount("com.acme.Order-value"))
+	assert.Equal(t, 0, registry.versionCount("com.acme.Customer-value"))
+}
+
+func TRunProtobufCompatibilityCheck(t *testing.T) {
+	HttpCallTimeout = 60
+	registry := newFakeRegistry()
+	server := httptest.NewServer(withCompatibilityEndpoint(registry))
+	defer server.Close()
+	dstClient := NewSchemaRegistryClient(server.URL, "key", "secret", "dst")
+
+	schemaDir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(schemaDir, "common"), 0755))
+	writeWatchedFile(t, schemaDir, "common/money.proto", protoMoney)
+	writeWatchedFile(t, schemaDir, "order.proto", protoOrder)
+
+	// Files referencing files that are not registered can not be tested
+	report := RunCompatibilityCheck(dstClient, PROTOBUF.String(), schemaDir, "")
+	assert.Equal(t, []CompatibilityCheck{
+		{Subject: "com.acme.orders.Order-value", File: filepath.Join(schemaDir, "order.proto"), Result: ERROR_RESULT,
+			Messages: []string{"Could not test the schema, its reference common/money.proto is not registered in " + server.URL}},
+		{Subject: "common/money.proto", File: filepath.Join(schemaDir, "common/money.proto"), Result: NEW_SUBJECT_RESULT},
+	}, report.Checks)
+	assert.True(t, report.HasIncompatibilities())
+	assert.Equal(t, 0, registry.versionCount("common/money.proto"))
+
+	// Once the referenced file is registered, the files referencing it are tested
+	NewSchemaLoader(PROTOBUF.String(), dstClient, schemaDir, "").Run()
+	report = RunCompatibilityCheck(dstClient, PROTOBUF.String(), schemaDir, "")
+	assert.Equal(t, []string{REGISTERED_RESULT, REGISTERED_RESULT}, []string{report.Checks[0].Result, report.Checks[1].Result})
+	assert.False(t, report.HasIncompatibilities())
+}
+
+func TWriteCompatibilityReport(t *testing.T) {
+	report := CompatibilityReport{RegistryUrl: "http://registry", Path: "/schemas", Checks: []CompatibilityCheck{
+		{Subject: "a-value", File: "/schemas/a.avsc", Result: COMPATIBLE_RESULT},
+		{Subject: "b-value", File: "/schemas/b.avsc", Result: INCOMPATIBLE_RESULT, Messages: []string{"#/fields/0: field x has no default"}},
+		{Subject: "c-value", File: "/schemas/c.avsc", Result: NEW_SUBJECT_RESULT},
+	}}
+
+	var text bytes.Buffer
+	assert.Nil(t, WriteCompatibilityReport(report, "TEXT", &text))
+	assert.Equal(t, "INCOMPATIBLE b-value (/schemas/b.avsc)\n  #/fields/0: field x has no default\n"+
+		"Checked 3 schemas of /schemas against http://registry: 1 compatible, 1 incompatible, 0 registered, 1 new subjects, 0 errors\n",
+		text.String())
+
+	var jsonReport bytes.Buffer
+	assert.Nil(t, WriteCompatibilityReport(report, "json", &jsonReport))
+	decoded := CompatibilityReport{}
+	assert.Nil(t, json.Unmarshal(jsonReport.Bytes(), &decoded))
+	assert.Equal(t, report, decoded)
+
+	assert.NotNil(t, WriteCompatibilityReport(report, "JUNIT", &text))
+	assert.False(t, CompatibilityReport{Checks: report.Checks[:1]}.HasIncompatibilities())
+}
@@ -0,0 +1,456 @@
+package client
+
+//
+// compatibility.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+/*
+As destinations are set to the NONE compatibility level while schemas are written, schema loads and restores
+can check AVRO schemas offline instead, with -compatibilityLevel. Every new version of a subject is checked
+against the versions registered before it, following the schema resolution rules of the AVRO specification:
+	BACKWARD    the new version reads data written with the previous version
+	FORWARD     the previous version reads data written with the new version
+	FULL        both, the _TRANSITIVE variants checking every previous version instead of the latest one
+Names referencing schemas registered under other subjects are compared by full name, the referenced schemas
+being checked under their own subjects. Protobuf and JSON schemas are not checked.
+*/
+
+func ParseCompatibility(level string) (Compatibility, error) {
+	for _, compatibility := range []Compatibility{BACKWARD, BACKWARD_TRANSITIVE, FORWARD, FORWARD_TRANSITIVE, FULL, FULL_TRANSITIVE, NONE} {
+		if strings.EqualFold(level, compatibility.String()) {
+			return compatibility, nil
+		}
+	}
+	if level == "" {
+		return NONE, nil
+	}
+	return NONE, fmt.Errorf("unknown compatibility level %s, expected one of BACKWARD, BACKWARD_TRANSITIVE, FORWARD, "+
+		"FORWARD_TRANSITIVE, FULL, FULL_TRANSITIVE or NONE", level)
+}
+
+// A version of a subject new versions are checked against
+type checkedVersion struct {
+	version int64
+	schema  interface{}
+}
+
+// Returns the reasons the given AVRO schema can not follow the given previous versions of its subject, oldest first,
+// under the given compatibility level
+func avroCompatibilityProblems(schema interface{}, previous []checkedVersion, level Compatibility) []string {
+	problems := []string{}
+	if level == NONE || len(previous) == 0 {
+		return problems
+	}
+
+	checked := previous[len(previous)-1:]
+	if level == BACKWARD_TRANSITIVE || level == FORWARD_TRANSITIVE || level == FULL_TRANSITIVE {
+		checked = previous
+	}
+	backward := level != FORWARD && level != FORWARD_TRANSITIVE
+	forward := level != BACKWARD && level != BACKWARD_TRANSITIVE
+
+	for _, previousVersion := range checked {
+		if backward {
+			for _, problem := range avroReadProblems(schema, previousVersion.schema) {
+				problems = append(problems, fmt.Sprintf("can not read data written with version %d, %s", previousVersion.version, problem))
+			}
+		}
+		if forward {
+			for _, problem := range avroReadProblems(previousVersion.schema, schema) {
+				problems = append(problems, fmt.Sprintf("version %d can not read data written with it, %s", previousVersion.version, problem))
+			}
+		}
+	}
+	return problems
+}
+
+// A named type of a schema, along with the namespace of the names it uses
+type avroNamedType struct {
+	definition map[string]interface{}
+	namespace  string
+}
+
+// Resolves data written with one AVRO schema against the schema reading it
+type avroResolution struct {
+	readerTypes map[string]avroNamedType
+	writerTypes map[string]avroNamedType
+	resolving   map[string]bool // Reader and writer record names being resolved, as records may be recursive
+}
+
+// Returns the reasons data written with the writer schema can not be read with the reader schema,
+// located by JSON pointer in the reader schema
+func avroReadProblems(reader interface{}, writer interface{}) []string {
+	resolution := &avroResolution{
+		readerTypes: avroNamedTypesOf(reader),
+		writerTypes: avroNamedTypesOf(writer),
+		resolving:   map[string]bool{},
+	}
+	return resolution.problemsOf(reader, "", writer, "", "")
+}
+
+func avroNamedTypesOf(schema interface{}) map[string]avroNamedType {
+	namedTypes := map[string]avroNamedType{}
+	walkAvroNamedTypes(schema, "", func(fullName string, namespace string, definition map[string]interface{}) {
+		namedTypes[fullName] = avroNamedType{definition: definition, namespace: namespace}
+	})
+	return namedTypes
+}
+
+func (ar *avroResolution) problemsOf(reader interface{}, readerNamespace string, writer interface{}, writerNamespace string, pointer string) []string {
+	reader, readerNamespace = definitionOf(reader, readerNamespace, ar.readerTypes)
+	writer, writerNamespace = definitionOf(writer, writerNamespace, ar.writerTypes)
+
+	// Every type a union may have been written with must be readable
+	if writerUnion, isUnion := writer.([]interface{}); isUnion {
+		problems := []string{}
+		for _, writerType := range writerUnion {
+			problems = append(problems, ar.problemsOf(reader, readerNamespace, writerType, writerNamespace, pointer)...)
+		}
+		return problems
+	}
+
+	// A union reads the first of its types that reads the type written, the problems of the closest type are given otherwise
+	if readerUnion, isUnion := reader.([]interface{}); isUnion {
+		var closest []string
+		for i, readerType := range readerUnion {
+			problems := ar.problemsOf(readerType, readerNamespace, writer, writerNamespace, fmt.Sprintf("%s/%d", pointer, i))
+			if len(problems) == 0 {
+				return problems
+			}
+			readerDefinition, definitionNamespace := definitionOf(readerType, readerNamespace, ar.readerTypes)
+			if closest == nil && avroKindOf(readerDefinition) == avroKindOf(writer) &&
+				sameAvroName(readerDefinition, definitionNamespace, writer, writerNamespace) {
+				closest = problems
+			}
+		}
+		if closest != nil {
+			return closest
+		}
+		return []string{avroProblemAt(pointer, "no type of the union reads the %s written", describeAvroType(writer, writerNamespace))}
+	}
+
+	readerKind, writerKind := avroKindOf(reader), avroKindOf(writer)
+	if readerKind == "reference" || writerKind == "reference" {
+		if !sameAvroName(reader, readerNamespace, writer, writerNamespace) {
+			return []string{avroProblemAt(pointer, "the %s written can not be read as %s",
+				describeAvroType(writer, writerNamespace), describeAvroType(reader, readerNamespace))}
+		}
+		return []string{}
+	}
+	if readerKind != writerKind {
+		if avroPromotions[writerKind][readerKind] {
+			return []string{}
+		}
+		return []string{avroProblemAt(pointer, "the %s written can not be read as %s",
+			describeAvroType(writer, writerNamespace), describeAvroType(reader, readerNamespace))}
+	}
+
+	readerMap, _ := reader.(map[string]interface{})
+	writerMap, _ := writer.(map[string]interface{})
+	switch readerKind {
+	case "record", "enum", "fixed":
+		if !sameAvroName(reader, readerNamespace, writer, writerNamespace) {
+			return []string{avroProblemAt(pointer, "the %s written can not be read as %s",
+				describeAvroType(writer, writerNamespace), describeAvroType(reader, readerNamespace))}
+		}
+		switch readerKind {
+		case "record":
+			return ar.recordProblems(readerMap, readerNamespace, writerMap, writerNamespace, pointer)
+		case "enum":
+			return enumProblems(readerMap, writerMap, pointer)
+		case "fixed":
+			readerSize, _ := avroInteger(readerMap["size"])
+			writerSize, _ := avroInteger(writerMap["size"])
+			if readerSize != writerSize {
+				return []string{avroProblemAt(pointer+"/size", "the fixed type written has a size of %v, not %v", writerSize, readerSize)}
+			}
+		}
+	case "array":
+		return ar.problemsOf(readerMap["items"], readerNamespace, writerMap["items"], writerNamespace, pointer+"/items")
+	case "map":
+		return ar.problemsOf(readerMap["values"], readerNamespace, writerMap["values"], writerNamespace, pointer+"/values")
+	}
+	return []string{}
+}
+
+func (ar *avroResolution) recordProblems(reader map[string]interface{}, readerNamespace string, writer map[string]interface{},
+	writerNamespace string, pointer string) []string {
+	problems := []string{}
+	resolving := avroDefinitionName(reader, readerNamespace) + " " + avroDefinitionName(writer, writerNamespace)
+	if ar.resolving[resolving] {
+		return problems
+	}
+	ar.resolving[resolving] = true
+	defer delete(ar.resolving, resolving)
+
+	writerFields := map[string]map[string]interface{}{}
+	if fields, isArray := writer["fields"].([]interface{}); isArray {
+		for _, field := range fields {
+			if fieldMap, isMap := field.(map[string]interface{}); isMap {
+				if name, isString := fieldMap["name"].(string); isString {
+					writerFields[name] = fieldMap
+				}
+			}
+		}
+	}
+
+	readerFields, _ := reader["fields"].([]interface{})
+	for i, field := range readerFields {
+		fieldMap, isMap := field.(map[string]interface{})
+		if !isMap {
+			continue
+		}
+		name, _ := fieldMap["name"].(string)
+		writerField, written := writerFields[name]
+		// A field may read a field written under one of its aliases
+		aliases, _ := fieldMap["aliases"].([]interface{})
+		for _, alias := range avroStrings(aliases) {
+			if !written {
+				writerField, written = writerFields[alias]
+			}
+		}
+
+		fieldPointer := fmt.Sprintf("%s/fields/%d", pointer, i)
+		if !written {
+			if _, hasDefault := fieldMap["default"]; !hasDefault {
+				problems = append(problems, avroProblemAt(fieldPointer, "field %s has no default and is missing from the record written", name))
+			}
+			continue
+		}
+		problems = append(problems, ar.problemsOf(fieldMap["type"], readerNamespace, writerField["type"], writerNamespace, fieldPointer+"/type")...)
+	}
+	return problems
+}
+
+func enumProblems(reader map[string]interface{}, writer map[string]interface{}, pointer string) []string {
+	problems := []string{}
+	if _, hasDefault := reader["default"]; hasDefault {
+		return problems
+	}
+	readerSymbols, _ := reader["symbols"].([]interface{})
+	writerSymbols, _ := writer["symbols"].([]interface{})
+	for _, symbol := range avroStrings(writerSymbols) {
+		if !stringIsInSlice(symbol, avroStrings(readerSymbols)) {
+			problems = append(problems, avroProblemAt(pointer+"/symbols", "symbol %s written is not a symbol of the enum, which has no default", symbol))
+		}
+	}
+	return problems
+}
+
+// Types written that can be read as another type: writer type -> reader types
+var avroPromotions = map[string]map[string]bool{
+	"int":    {"long": true, "float": true, "double": true},
+	"long":   {"float": true, "double": true},
+	"float":  {"double": true},
+	"string": {"bytes": true},
+	"bytes":  {"string": true},
+}
+
+// Returns the definition of the given schema used within the given namespace, names of the given named types
+// replaced by their definition, along with the namespace of the names the definition uses
+func definitionOf(schema interface{}, namespace string, namedTypes map[string]avroNamedType) (interface{}, string) {
+	switch typed := schema.(type) {
+	case string:
+		if avroPrimitiveTypes[typed] {
+			return typed, namespace
+		}
+		fullName := avroFullName(typed, namespace)
+		if namedType, defined := namedTypes[fullName]; defined {
+			return namedType.definition, namedType.namespace
+		}
+		return fullName, namespace
+	case map[string]interface{}:
+		switch typed["type"] {
+		case "record", "error", "enum", "fixed":
+			return typed, avroNamespaceOf(typed, namespace)
+		case "array", "map":
+			return typed, namespace
+		}
+		// A primitive type with attributes, such as a logical type, or a name given as {"type": "com.mycorp.Name"}
+		return definitionOf(typed["type"], namespace, namedTypes)
+	}
+	return schema, namespace
+}
+
+// Returns the kind of the given definition: a primitive type, record, enum, fixed, array, map, union,
+// or reference for names of types the schema does not define
+func avroKindOf(definition interface{}) string {
+	switch typed := definition.(type) {
+	case string:
+		if avroPrimitiveTypes[typed] {
+			return typed
+		}
+		return "reference"
+	case []interface{}:
+		return "union"
+	case map[string]interface{}:
+		if typed["type"] == "error" {
+			return "record"
+		}
+		kind, _ := typed["type"].(string)
+		return kind
+	}
+	return ""
+}
+
+// Returns the full name of the given named type definition, or the given name of a reference
+func avroDefinitionName(definition interface{}, namespace string) string {
+	if definitionMap, isMap := definition.(map[string]interface{}); isMap {
+		name, _ := definitionMap["name"].(string)
+		return avroFullName(name, namespace)
+	}
+	name, _ := definition.(string)
+	return name
+}
+
+// Returns whether the reader definition reads the named type written: they have the same full name,
+// or the full name written is one of the aliases of the reader
+func sameAvroName(reader interface{}, readerNamespace string, writer interface{}, writerNamespace string) bool {
+	readerName, writerName := avroDefinitionName(reader, readerNamespace), avroDefinitionName(writer, writerNamespace)
+	if readerName == writerName {
+		return true
+	}
+	if readerMap, isMap := reader.(map[string]interface{}); isMap {
+		return stringIsInSlice(writerName, avroAliasesOf(readerMap, readerNamespace))
+	}
+	return false
+}
+
+func describeAvroType(definition interface{}, namespace string) string {
+	switch kind := avroKindOf(definition); kind {
+	case "record", "enum", "fixed":
+		return kind + " " + avroDefinitionName(definition, namespace)
+	case "reference":
+		return "type " + avroDefinitionName(definition, namespace)
+	default:
+		return kind
+	}
+}
+
+func avroProblemAt(pointer string, format string, args ...interface{}) string {
+	return fmt.Sprintf("#%s: %s", pointer, fmt.Sprintf(format, args...))
+}
+
+// Checks the schemas registered under every subject against the versions registered before them, offline
+type compatibilityGate struct {
+	level     Compatibility
+	accepted  map[string][]checkedVersion // Subject -> versions registered so far, oldest first
+	seen      map[string]bool             // Subject and schema of the versions accepted, as schemas may be registered again
+	unchecked map[string]bool             // Schema types that can not be checked, reported once
+	existing  func(subject string) ([]SchemaRecord, error)
+	seeded    map[string]bool // Subjects whose existing versions were read
+}
+
+func newCompatibilityGate(level string) (*compatibilityGate, error) {
+	compatibility, err := ParseCompatibility(level)
+	if err != nil {
+		return nil, err
+	}
+	return &compatibilityGate{
+		level:     compatibility,
+		accepted:  map[string][]checkedVersion{},
+		seen:      map[string]bool{},
+		unchecked: map[string]bool{},
+		seeded:    map[string]bool{},
+	}, nil
+}
+
+// Checks new versions against the versions the given registry holds already as well, read the first time a subject is seen
+func (cg *compatibilityGate) withRegistry(dstClient *SchemaRegistryClient) *compatibilityGate {
+	cg.existing = dstClient.getSubjectSchemas
+	return cg
+}
+
+func (cg *compatibilityGate) seed(subject string) {
+	if cg.existing == nil || cg.seeded[subject] {
+		return
+	}
+	cg.seeded[subject] = true
+	records, err := cg.existing(subject)
+	if err != nil {
+		log.Printf("Could not read the versions of %s registered already, only versions of this run are checked against: %v", subject, err)
+		return
+	}
+	for _, record := range records {
+		if cg.seen[subject+"\n"+record.Schema] {
+			continue
+		}
+		if parsed, checkable := cg.parse(record.SType, record.Schema); checkable {
+			cg.add(subject, record.Version, record.Schema, parsed)
+		}
+	}
+}
+
+// Returns whether the given schema can be registered under the given subject as the given version, version 0 being
+// the one following the versions accepted so far. Schemas allowed become previous versions of the subject.
+func (cg *compatibilityGate) allows(subject string, version int64, schemaType string, schema string) bool {
+	if cg.level == NONE {
+		return true
+	}
+	cg.seed(subject)
+	if cg.seen[subject+"\n"+schema] {
+		return true
+	}
+	parsed, checkable := cg.parse(schemaType, schema)
+	if !checkable {
+		return true
+	}
+
+	problems := avroCompatibilityProblems(parsed, cg.accepted[subject], cg.level)
+	if len(problems) != 0 {
+		log.Printf("Not registering a new version of %s, it is not %s compatible:\n  %s", subject, cg.level, strings.Join(problems, "\n  "))
+		return false
+	}
+	cg.add(subject, version, schema, parsed)
+	return true
+}
+
+// Records the given schema, registered already, as a previous version of the subject
+func (cg *compatibilityGate) accept(subject string, version int64, schemaType string, schema string) {
+	if cg.level == NONE {
+		return
+	}
+	cg.seed(subject)
+	if cg.seen[subject+"\n"+schema] {
+		return
+	}
+	if parsed, checkable := cg.parse(schemaType, schema); checkable {
+		cg.add(subject, version, schema, parsed)
+	}
+}
+
+func (cg *compatibilityGate) add(subject string, version int64, schema string, parsed interface{}) {
+	if version == 0 {
+		version = 1
+		if previous := cg.accepted[subject]; len(previous) != 0 {
+			version = previous[len(previous)-1].version + 1
+		}
+	}
+	cg.seen[subject+"\n"+schema] = true
+	cg.accepted[subject] = append(cg.accepted[subject], checkedVersion{version: version, schema: parsed})
+}
+
+// Returns the given AVRO schema parsed, or false when its compatibility can not be checked
+func (cg *compatibilityGate) parse(schemaType string, schema string) (interface{}, bool) {
+	if schemaType != "" && schemaType != AVRO.String() {
+		if !cg.unchecked[schemaType] {
+			cg.unchecked[schemaType] = true
+			log.Printf("Compatibility of %s schemas is not checked locally, only AVRO schemas are", schemaType)
+		}
+		return nil, false
+	}
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(schema), &parsed); err != nil {
+		log.Printf("Could not check the compatibility of a schema that is not valid JSON: %v", err)
+		return nil, false
+	}
+	return parsed, true
+}
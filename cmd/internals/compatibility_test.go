@@ -0,0 +1,235 @@
+package client
+
+//
+// compatibility_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackCompatibility(t *testing.T) {
+	t.Run("TParseCompatibility", func(t *testing.T) { TParseCompatibility(t) })
+	t.Run("TAvroReadProblems", func(t *testing.T) { TAvroReadProblems(t) })
+	t.Run("TAvroCompatibilityLevels", func(t *testing.T) { TAvroCompatibilityLevels(t) })
+	t.Run("TCompatibilityGate", func(t *testing.T) { TCompatibilityGate(t) })
+	t.Run("TCompatibilityGateSeeding", func(t *testing.T) { TCompatibilityGateSeeding(t) })
+	t.Run("TSchemaLoadCompatibility", func(t *testing.T) { TSchemaLoadCompatibility(t) })
+	t.Run("TRestoreCompatibility", func(t *testing.T) { TRestoreCompatibility(t) })
+	t.Run("TLegacyRestoreCompatibility", func(t *testing.T) { TLegacyRestoreCompatibility(t) })
+}
+
+const compatOrderV1 = `{"type":"record","name":"Order","namespace":"com.acme","fields":[
+	{"name":"id","type":"string"},{"name":"count","type":"int"}]}`
+
+// Adds a field with a default, and promotes count to long
+const compatOrderV2 = `{"type":"record","name":"Order","namespace":"com.acme","fields":[
+	{"name":"id","type":"string"},{"name":"count","type":"long"},{"name":"note","type":["null","string"],"default":null}]}`
+
+// Adds a field without a default
+const compatOrderV3 = `{"type":"record","name":"Order","namespace":"com.acme","fields":[
+	{"name":"id","type":"string"},{"name":"count","type":"long"},{"name":"note","type":["null","string"],"default":null},
+	{"name":"total","type":"double"}]}`
+
+func TParseCompatibility(t *testing.T) {
+	level, err := ParseCompatibility("")
+	assert.Nil(t, err)
+	assert.Equal(t, NONE, level)
+	level, err = ParseCompatibility("full_transitive")
+	assert.Nil(t, err)
+	assert.Equal(t, FULL_TRANSITIVE, level)
+	_, err = ParseCompatibility("SIDEWAYS")
+	assert.NotNil(t, err)
+}
+
+func TAvroReadProblems(t *testing.T) {
+	readProblems := func(reader string, writer string) []string {
+		return avroReadProblems(avroSchemaOf(t, reader), avroSchemaOf(t, writer))
+	}
+
+	assert.Equal(t, []string{}, readProblems(compatOrderV2, compatOrderV1))
+	assert.Equal(t, []string{"#/fields/1/type: the long written can not be read as int"}, readProblems(compatOrderV1, compatOrderV2))
+	assert.Equal(t, []string{"#/fields/3: field total has no default and is missing from the record written"},
+		readProblems(compatOrderV3, compatOrderV2))
+	assert.Equal(t, []string{`#: the record com.acme.Order written can not be read as record com.acme.Invoice`},
+		readProblems(`{"type":"record","name":"com.acme.Invoice","fields":[]}`, compatOrderV1))
+
+	// Renamed records and fields are read through their aliases
+	assert.Equal(t, []string{}, readProblems(`{"type":"record","name":"Purchase","namespace":"com.acme","aliases":["Order"],"fields":[
+		{"name":"identifier","type":"string","aliases":["id"]}]}`, compatOrderV1))
+
+	// Unions
+	assert.Equal(t, []string{}, readProblems(`["null","string"]`, `"string"`))
+	assert.Equal(t, []string{"#: the null written can not be read as string"}, readProblems(`"string"`, `["null","string"]`))
+	assert.Equal(t, []string{"#: no type of the union reads the boolean written"}, readProblems(`["null","string"]`, `"boolean"`))
+	assert.Equal(t, []string{"#/1/fields/1/type: the long written can not be read as int"},
+		readProblems(`["null",`+compatOrderV1+`]`, `["null",`+compatOrderV2+`]`))
+
+	// Enums, fixed types, arrays and maps
+	assert.Equal(t, []string{"#/items/symbols: symbol C written is not a symbol of the enum, which has no default"},
+		readProblems(`{"type":"array","items":{"type":"enum","name":"Letter","symbols":["A","B"]}}`,
+			`{"type":"array","items":{"type":"enum","name":"Letter","symbols":["A","B","C"]}}`))
+	assert.Equal(t, []string{}, readProblems(`{"type":"enum","name":"Letter","symbols":["A","B"],"default":"A"}`,
+		`{"type":"enum","name":"Letter","symbols":["A","B","C"]}`))
+	assert.Equal(t, []string{"#/values/size: the fixed type written has a size of 8, not 16"},
+		readProblems(`{"type":"map","values":{"type":"fixed","name":"Hash","size":16}}`, `{"type":"map","values":{"type":"fixed","name":"Hash","size":8}}`))
+
+	// Logical types are read as their base type
+	assert.Equal(t, []string{}, readProblems(`"long"`, `{"type":"int","logicalType":"date"}`))
+
+	// Recursive records, and names referencing other subjects
+	linkedList := `{"type":"record","name":"Node","fields":[{"name":"value","type":"int"},{"name":"next","type":["null","Node"]}]}`
+	assert.Equal(t, []string{}, readProblems(linkedList, linkedList))
+	assert.Equal(t, []string{}, readProblems(`{"type":"record","name":"Line","namespace":"com.acme","fields":[{"name":"item","type":"Item"}]}`,
+		`{"type":"record","name":"Line","namespace":"com.acme","fields":[{"name":"item","type":"com.acme.Item"}]}`))
+	assert.Equal(t, []string{"#/fields/0/type: the type com.acme.Item written can not be read as type com.acme.Product"},
+		readProblems(`{"type":"record","name":"Line","namespace":"com.acme","fields":[{"name":"item","type":"Product"}]}`,
+			`{"type":"record","name":"Line","namespace":"com.acme","fields":[{"name":"item","type":"Item"}]}`))
+}
+
+func TAvroCompatibilityLevels(t *testing.T) {
+	previous := []checkedVersion{{version: 1, schema: avroSchemaOf(t, compatOrderV1)}, {version: 2, schema: avroSchemaOf(t, compatOrderV2)}}
+	removedNote := avroSchemaOf(t, `{"type":"record","name":"Order","namespace":"com.acme","fields":[
+		{"name":"id","type":"string"},{"name":"count","type":"long"}]}`)
+
+	// Removing a field with a default is backward compatible, but older versions can not read count as an int
+	assert.Equal(t, []string{}, avroCompatibilityProblems(removedNote, previous, BACKWARD))
+	assert.Equal(t, []string{}, avroCompatibilityProblems(removedNote, previous, BACKWARD_TRANSITIVE))
+	assert.Equal(t, []string{}, avroCompatibilityProblems(removedNote, previous, FORWARD))
+	assert.Equal(t, []string{"version 1 can not read data written with it, #/fields/1/type: the long written can not be read as int"},
+		avroCompatibilityProblems(removedNote, previous, FORWARD_TRANSITIVE))
+	assert.Equal(t, []string{}, avroCompatibilityProblems(removedNote, previous, FULL))
+	assert.Equal(t, 1, len(avroCompatibilityProblems(removedNote, previous, FULL_TRANSITIVE)))
+
+	assert.Equal(t, []string{"can not read data written with version 2, #/fields/3: field total has no default and is missing from the record written"},
+		avroCompatibilityProblems(avroSchemaOf(t, compatOrderV3), previous, BACKWARD))
+	assert.Equal(t, []string{}, avroCompatibilityProblems(avroSchemaOf(t, compatOrderV3), previous, NONE))
+	assert.Equal(t, []string{}, avroCompatibilityProblems(avroSchemaOf(t, compatOrderV3), []checkedVersion{}, FULL))
+}
+
+func TCompatibilityGate(t *testing.T) {
+	gate, err := newCompatibilityGate("BACKWARD")
+	assert.Nil(t, err)
+
+	assert.True(t, gate.allows("orders", 0, "AVRO", compatOrderV1))
+	assert.True(t, gate.allows("orders", 0, "", compatOrderV2))
+	assert.False(t, gate.allows("orders", 0, "AVRO", compatOrderV3))
+	assert.Equal(t, []int64{1, 2}, []int64{gate.accepted["orders"][0].version, gate.accepted["orders"][1].version})
+
+	// Schemas seen already are allowed again without becoming new versions
+	gate.accept("orders", 0, "AVRO", compatOrderV1)
+	assert.True(t, gate.allows("orders", 0, "AVRO", compatOrderV2))
+	assert.Equal(t, 2, len(gate.accepted["orders"]))
+
+	// Other subjects and schema types are not checked
+	assert.True(t, gate.allows("invoices", 0, "AVRO", compatOrderV3))
+	assert.True(t, gate.allows("orders", 0, "PROTOBUF", `syntax = "proto3";`))
+
+	_, err = newCompatibilityGate("SIDEWAYS")
+	assert.NotNil(t, err)
+}
+
+func TCompatibilityGateSeeding(t *testing.T) {
+	HttpCallTimeout = 60
+	registry := newFakeRegistry()
+	registry.subjects["orders"] = []SchemaToRegister{{Schema: compatOrderV1, SType: "AVRO", Id: 1}, {Schema: compatOrderV2, SType: "AVRO", Id: 2}}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	gate, _ := newCompatibilityGate("BACKWARD")
+	gate.withRegistry(NewSchemaRegistryClient(server.URL, "key", "secret", "dst"))
+
+	// Versions registered before the run are checked against, and are not new versions when seen again
+	assert.False(t, gate.allows("orders", 0, "AVRO", compatOrderV3))
+	assert.True(t, gate.allows("orders", 2, "AVRO", compatOrderV2))
+	assert.Equal(t, []int64{1, 2}, []int64{gate.accepted["orders"][0].version, gate.accepted["orders"][1].version})
+
+	// Versions following the registered ones are numbered after them
+	gate.accept("orders", 0, "AVRO", compatOrderV3)
+	assert.Equal(t, int64(3), gate.accepted["orders"][2].version)
+
+	// Subjects that are not registered start without versions
+	assert.True(t, gate.allows("invoices", 0, "AVRO", compatOrderV3))
+	assert.Equal(t, 1, len(gate.accepted["invoices"]))
+}
+
+func TSchemaLoadCompatibility(t *testing.T) {
+	HttpCallTimeout = 60
+	CompatibilityLevelName = "BACKWARD"
+	defer func() { CompatibilityLevelName = "" }()
+
+	registry := newFakeRegistry()
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	schemaDir := t.TempDir()
+	writeWatchedFile(t, schemaDir, "order_v1.avsc", compatOrderV1)
+	writeWatchedFile(t, schemaDir, "order_v2.avsc", compatOrderV2)
+	writeWatchedFile(t, schemaDir, "order_v3.avsc", compatOrderV3)
+
+	loader := NewSchemaLoader(AVRO.String(), NewSchemaRegistryClient(server.URL, "key", "secret", "dst"), schemaDir, "")
+	loader.Run()
+	assert.Equal(t, 2, registry.versionCount("com.acme.Order-value"))
+
+	// Versions registered by an earlier load are checked against as well
+	loader = NewSchemaLoader(AVRO.String(), NewSchemaRegistryClient(server.URL, "key", "secret", "dst"), schemaDir, "")
+	loader.Run()
+	assert.Equal(t, 2, registry.versionCount("com.acme.Order-value"))
+	assert.Equal(t, 2, len(loader.compatibility.accepted["com.acme.Order-value"]))
+
+	// A load holding only the new version is checked against the versions registered already
+	newSchemaDir := t.TempDir()
+	writeWatchedFile(t, newSchemaDir, "order_v3.avsc", compatOrderV3)
+	NewSchemaLoader(AVRO.String(), NewSchemaRegistryClient(server.URL, "key", "secret", "dst"), newSchemaDir, "").Run()
+	assert.Equal(t, 2, registry.versionCount("com.acme.Order-value"))
+}
+
+func TRestoreCompatibility(t *testing.T) {
+	HttpCallTimeout = 60
+	CompatibilityLevelName = "BACKWARD"
+	defer func() { CompatibilityLevelName = "" }()
+
+	registry := newFakeRegistry()
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	backupDir := t.TempDir()
+	builder := newManifestBuilder("http://source")
+	for version, schema := range []string{compatOrderV1, compatOrderV2, compatOrderV3} {
+		fileName := filepath.Join(backupDir, "orders-"+string(rune('1'+version))+"-AVRO")
+		writeBackupFile(t, backupDir, filepath.Base(fileName), schema)
+		builder.add(SchemaRecord{Subject: "orders", Schema: schema, SType: "AVRO", Version: int64(version + 1), Id: int64(version + 1)},
+			false, backupDir, fileName)
+	}
+	builder.write(backupDir)
+
+	WriteFromFS(NewSchemaRegistryClient(server.URL, "key", "secret", "dst"), backupDir, "")
+	assert.Equal(t, 2, registry.versionCount("orders"))
+}
+
+func TLegacyRestoreCompatibility(t *testing.T) {
+	HttpCallTimeout = 60
+	CompatibilityLevelName = "BACKWARD"
+	defer func() { CompatibilityLevelName = "" }()
+
+	registry := newFakeRegistry()
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	// Without a manifest, version 10 sorts before version 2 by file name
+	backupDir := t.TempDir()
+	writeBackupFile(t, backupDir, "orders-2-1-AVRO", compatOrderV1)
+	writeBackupFile(t, backupDir, "orders-10-2-AVRO", compatOrderV2)
+	writeBackupFile(t, backupDir, "orders-11-3-AVRO", compatOrderV3)
+	assert.Equal(t, []string{"orders-2-1-AVRO", "orders-10-2-AVRO", "orders-11-3-AVRO"},
+		sortedBySubjectVersion([]string{"orders-10-2-AVRO", "orders-11-3-AVRO", "orders-2-1-AVRO"}))
+
+	WriteFromFS(NewSchemaRegistryClient(server.URL, "key", "secret", "dst"), backupDir, "")
+	assert.Equal(t, []string{compatOrderV1, compatOrderV2}, []string{registry.subjects["orders"][0].Schema, registry.subjects["orders"][1].Schema})
+	assert.Equal(t, 2, registry.versionCount("orders"))
+}
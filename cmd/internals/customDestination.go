@@ -46,6 +46,7 @@ func RunCustomDestinationSync(srcClient *SchemaRegistryClient, customDest Custom
 			if SyncDeletes {
 				customDestSyncDeletes(destSubjects, srcSubjects, srcClient, customDest)
 			}
+			commitChangeSet(customDest)
 		}
 		syncDuration := time.Since(beginSync)
 		log.Printf("Finished sync in %d ms", syncDuration.Milliseconds())
@@ -86,6 +87,7 @@ func RunCustomDestinationBatch(srcClient *SchemaRegistryClient, customDest Custo
 			checkCouldNotRegister(err)
 		}
 	}
+	commitChangeSet(customDest)
 }
 
 // Sync function for custom destination
@@ -182,6 +184,19 @@ func removeFromSlice(s []int64, i int) []int64 {
 	return s[:len(s)-1]
 }
 
+// Lets destinations that group changes know all changes of the run have been applied
+func commitChangeSet(customDest CustomDestination) {
+	committer, isCommitter := customDest.(ChangeSetCommitter)
+	if !isCommitter {
+		return
+	}
+	err := committer.CommitChanges()
+	if err != nil {
+		log.Println("Could not commit changes to destination:")
+		log.Println(err)
+	}
+}
+
 func checkCouldNotRegister(err error) {
 	if err != nil {
 		log.Println("Could not register schema to destination:")
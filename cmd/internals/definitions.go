@@ -39,6 +39,14 @@ type CustomDestination interface {
 	TearDown() error
 }
 
+/*
+A CustomDestination that groups the changes of a sync run may also implement this interface,
+it is called once all registrations and deletions of a sync run or batch export have been applied.
+*/
+type ChangeSetCommitter interface {
+	CommitChanges() error
+}
+
 /*
 Any struct that implements this interface is able to run an instance of sync and batch exporting.
 */
@@ -128,6 +136,12 @@ type SubjectVersion struct {
 	Version int64  `json:"version"`
 }
 
+// Holding struct for compatibility test results
+type CompatibilityResponse struct {
+	IsCompatible bool     `json:"is_compatible"`
+	Messages     []string `json:"messages"`
+}
+
 type ErrorMessage struct {
 	ErrorCode    int64  `json:"error_code"`
 	ErrorMessage string `json:"message"`
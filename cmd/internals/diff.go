@@ -0,0 +1,368 @@
+package client
+
+//
+// diff.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A read-only view of the schemas held by a registry or a local backup
+type schemaSnapshot struct {
+	name      string
+	subjects  map[string][]int64
+	getSchema func(subject string, version int64) SchemaRecord
+	holds     func(subjectVersion SubjectVersion) bool // Whether the source holds a version, subjects filtered out included
+	registry  *SchemaRegistryClient                    // The registry of the snapshot, nil for local backups
+}
+
+// Returns the snapshot described by the given spec: "src" for the source registry,
+// "dst" for the destination registry, or the path to a local backup directory
+func openSchemaSnapshot(spec string, workingDirectory string) *schemaSnapshot {
+	switch strings.ToLower(spec) {
+	case "src", "dst":
+		var srClient *SchemaRegistryClient
+		if strings.EqualFold(spec, "src") {
+			srClient = NewSchemaRegistryClient(SrcSRUrl, SrcSRKey, SrcSRSecret, "src")
+		} else {
+			srClient = NewSchemaRegistryClient(DestSRUrl, DestSRKey, DestSRSecret, "dst")
+		}
+		if !srClient.IsReachable() {
+			log.Fatalf("Could not reach %s registry. Possible bad credentials?", spec)
+		}
+		return newRegistrySnapshot(srClient)
+	}
+	return newLocalSnapshot(CheckPath(spec, workingDirectory))
+}
+
+func newRegistrySnapshot(srClient *SchemaRegistryClient) *schemaSnapshot {
+	return &schemaSnapshot{
+		name:     srClient.SRUrl,
+		subjects: GetCurrentSubjectState(srClient),
+		getSchema: func(subject string, version int64) SchemaRecord {
+			return srClient.GetSchema(subject, version, false)
+		},
+		holds: func(subjectVersion SubjectVersion) bool {
+			record := SchemaRecord{}
+			return srClient.getJson(fmt.Sprintf("%s/subjects/%s/versions/%d", srClient.SRUrl, url.QueryEscape(subjectVersion.Subject),
+				subjectVersion.Version), &record) == nil
+		},
+		registry: srClient,
+	}
+}
+
+// Returns a snapshot of a backup written by getLocalCopy, read from its manifest or latest incremental snapshot when present
+func newLocalSnapshot(backupPath string) *schemaSnapshot {
+	manifest, hasManifest := readBackupManifest(backupPath, "")
+	if hasManifest {
+		entries := manifest.entriesBySubjectVersion()
+		subjects := map[string][]int64{}
+		for _, entry := range manifest.Schemas {
+			if !entry.SoftDeleted && checkSubjectIsAllowed(entry.Subject) {
+				subjects[entry.Subject] = append(subjects[entry.Subject], entry.Version)
+			}
+		}
+		return &schemaSnapshot{
+			name:     backupPath,
+			subjects: subjects,
+			getSchema: func(subject string, version int64) SchemaRecord {
+				record, err := entries[SubjectVersion{Subject: subject, Version: version}].readRecord(backupPath)
+				checkDontFail(err)
+				return record
+			},
+			holds: func(subjectVersion SubjectVersion) bool {
+				entry, exists := entries[subjectVersion]
+				return exists && !entry.SoftDeleted
+			},
+		}
+	}
+
+	files := map[SubjectVersion]string{}
+	held := map[SubjectVersion]bool{}
+	subjects := map[string][]int64{}
+
+	err := filepath.Walk(backupPath,
+		func(path string, info os.FileInfo, err error) error {
+			check(err)
+			if !skipBackupFile(path, info) {
+				record := readLocalSchemaFile(path)
+				held[SubjectVersion{Subject: record.Subject, Version: record.Version}] = true
+				if checkSubjectIsAllowed(record.Subject) {
+					files[SubjectVersion{Subject: record.Subject, Version: record.Version}] = path
+					subjects[record.Subject] = append(subjects[record.Subject], record.Version)
+				}
+			}
+			return nil
+		})
+	check(err)
+
+	return &schemaSnapshot{
+		name:     backupPath,
+		subjects: subjects,
+		getSchema: func(subject string, version int64) SchemaRecord {
+			path, exists := files[SubjectVersion{Subject: subject, Version: version}]
+			if !exists {
+				return SchemaRecord{}
+			}
+			return readLocalSchemaFile(path)
+		},
+		holds: func(subjectVersion SubjectVersion) bool {
+			return held[subjectVersion]
+		},
+	}
+}
+
+// A subject version that differs between the two sides of a diff
+type SchemaChange struct {
+	Subject string   `json:"subject"`
+	Version int64    `json:"version"`
+	Change  string   `json:"change"`
+	Details []string `json:"details,omitempty"`
+	Diff    string   `json:"diff,omitempty"`
+}
+
+// The differences between two snapshots, changes are described from the left side to the right side
+type DiffReport struct {
+	Left    string         `json:"left"`
+	Right   string         `json:"right"`
+	Changes []SchemaChange `json:"changes"`
+}
+
+// Compares the two given snapshots specs, see openSchemaSnapshot for the accepted specs
+func RunDiff(leftSpec string, rightSpec string, workingDirectory string) DiffReport {
+	listenForInterruption()
+
+	left := openSchemaSnapshot(leftSpec, workingDirectory)
+	right := openSchemaSnapshot(rightSpec, workingDirectory)
+	log.Printf("Comparing %s with %s", left.name, right.name)
+
+	return diffSnapshots(left, right)
+}
+
+func diffSnapshots(left *schemaSnapshot, right *schemaSnapshot) DiffReport {
+	report := DiffReport{Left: left.name, Right: right.name, Changes: []SchemaChange{}}
+
+	for subject, versions := range GetSubjectDiff(right.subjects, left.subjects) {
+		for _, version := range versions {
+			schema := right.getSchema(subject, version)
+			report.Changes = append(report.Changes, SchemaChange{
+				Subject: subject, Version: version, Change: "ADDED",
+				Diff: unifiedDiff("", prettySchema(schema), "/dev/null", changeLabel(right.name, subject, version)),
+			})
+		}
+	}
+
+	for subject, versions := range GetSubjectDiff(left.subjects, right.subjects) {
+		for _, version := range versions {
+			schema := left.getSchema(subject, version)
+			report.Changes = append(report.Changes, SchemaChange{
+				Subject: subject, Version: version, Change: "REMOVED",
+				Diff: unifiedDiff(prettySchema(schema), "", changeLabel(left.name, subject, version), "/dev/null"),
+			})
+		}
+	}
+
+	for subject, leftVersions := range left.subjects {
+		for _, version := range leftVersions {
+			if CancelRun == true {
+				return report
+			}
+			if !isInSlice(version, right.subjects[subject]) {
+				continue
+			}
+			leftSchema := left.getSchema(subject, version)
+			rightSchema := right.getSchema(subject, version)
+
+			details := []string{}
+			if leftSchema.Id != rightSchema.Id {
+				details = append(details, fmt.Sprintf("id %d -> %d", leftSchema.Id, rightSchema.Id))
+			}
+			if leftSchema.SType != rightSchema.SType {
+				details = append(details, fmt.Sprintf("schemaType %s -> %s", leftSchema.SType, rightSchema.SType))
+			}
+			if formatReferences(leftSchema.References) != formatReferences(rightSchema.References) {
+				details = append(details, fmt.Sprintf("references [%s] -> [%s]",
+					formatReferences(leftSchema.References), formatReferences(rightSchema.References)))
+			}
+			schemaDiff := ""
+			if canonicalSchema(leftSchema.SType, leftSchema.Schema) != canonicalSchema(rightSchema.SType, rightSchema.Schema) {
+				details = append(details, "schema")
+				schemaDiff = unifiedDiff(prettySchema(leftSchema), prettySchema(rightSchema),
+					changeLabel(left.name, subject, version), changeLabel(right.name, subject, version))
+			}
+
+			if len(details) != 0 {
+				report.Changes = append(report.Changes, SchemaChange{
+					Subject: subject, Version: version, Change: "CHANGED", Details: details, Diff: schemaDiff,
+				})
+			}
+		}
+	}
+
+	sort.Slice(report.Changes, func(i, j int) bool {
+		if report.Changes[i].Subject != report.Changes[j].Subject {
+			return report.Changes[i].Subject < report.Changes[j].Subject
+		}
+		return report.Changes[i].Version < report.Changes[j].Version
+	})
+
+	return report
+}
+
+func changeLabel(snapshotName string, subject string, version int64) string {
+	return fmt.Sprintf("%s/%s/versions/%d", snapshotName, subject, version)
+}
+
+// Returns the schema with JSON based schemas indented, so diffs are line based
+func prettySchema(schema SchemaRecord) string {
+	if schema.SType == PROTOBUF.String() {
+		return schema.Schema
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(schema.Schema), "", "  "); err != nil {
+		return schema.Schema
+	}
+	return indented.String()
+}
+
+// Writes the diff report in the given format: TEXT or JSON
+func WriteDiffReport(report DiffReport, format string, out io.Writer) error {
+	switch strings.ToUpper(format) {
+	case "", "TEXT":
+		for _, change := range report.Changes {
+			header := fmt.Sprintf("%s %s version %d", change.Change, change.Subject, change.Version)
+			if len(change.Details) != 0 {
+				header = fmt.Sprintf("%s (%s)", header, strings.Join(change.Details, ", "))
+			}
+			if _, err := fmt.Fprintln(out, header); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(out, change.Diff); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(out, "%d changes between %s and %s\n", len(report.Changes), report.Left, report.Right)
+		return err
+	case "JSON":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return fmt.Errorf("unknown report format %s, expected one of TEXT or JSON", format)
+}
+
+// Returns a unified diff of the two texts, with three lines of context around changes
+func unifiedDiff(left string, right string, leftName string, rightName string) string {
+	leftLines, rightLines := splitLines(left), splitLines(right)
+
+	// Longest common subsequence table, used to walk the edit script
+	lcs := make([][]int, len(leftLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(rightLines)+1)
+	}
+	for i := len(leftLines) - 1; i >= 0; i-- {
+		for j := len(rightLines) - 1; j >= 0; j-- {
+			if leftLines[i] == rightLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type diffLine struct {
+		op        byte
+		text      string
+		leftLine  int
+		rightLine int
+	}
+	lines := []diffLine{}
+	i, j := 0, 0
+	for i < len(leftLines) || j < len(rightLines) {
+		switch {
+		case i < len(leftLines) && j < len(rightLines) && leftLines[i] == rightLines[j]:
+			lines = append(lines, diffLine{' ', leftLines[i], i, j})
+			i++
+			j++
+		case i < len(leftLines) && (j == len(rightLines) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', leftLines[i], i, j})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', rightLines[j], i, j})
+			j++
+		}
+	}
+
+	const context = 3
+	var out strings.Builder
+	for start := 0; start < len(lines); {
+		if lines[start].op == ' ' {
+			start++
+			continue
+		}
+		// Extend the hunk while changes are within twice the context of each other
+		hunkStart := start - context
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		end := start
+		for k := start; k < len(lines); k++ {
+			if lines[k].op != ' ' {
+				end = k
+			} else if k-end > 2*context {
+				break
+			}
+		}
+		hunkEnd := end + context + 1
+		if hunkEnd > len(lines) {
+			hunkEnd = len(lines)
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", leftName, rightName)
+		}
+		leftCount, rightCount := 0, 0
+		for _, line := range lines[hunkStart:hunkEnd] {
+			if line.op != '+' {
+				leftCount++
+			}
+			if line.op != '-' {
+				rightCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(lines[hunkStart].leftLine, leftCount), hunkRange(lines[hunkStart].rightLine, rightCount))
+		for _, line := range lines[hunkStart:hunkEnd] {
+			fmt.Fprintf(&out, "%c%s\n", line.op, line.text)
+		}
+		start = hunkEnd
+	}
+	return out.String()
+}
+
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,77 @@
+package client
+
+//
+// diff_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackDiff(t *testing.T) {
+	t.Run("TUnifiedDiff", func(t *testing.T) { TUnifiedDiff(t) })
+	t.Run("TDiffLocalSnapshots", func(t *testing.T) { TDiffLocalSnapshots(t) })
+}
+
+func TUnifiedDiff(t *testing.T) {
+	left := "a\nb\nc\nd\ne\nf\ng\nh\n"
+	right := "a\nb\nc\nD\ne\nf\ng\nh\ni\n"
+
+	expected := "--- left\n+++ right\n" +
+		"@@ -1,8 +1,9 @@\n a\n b\n c\n-d\n+D\n e\n f\n g\n h\n+i\n"
+
+	assert.Equal(t, expected, unifiedDiff(left, right, "left", "right"))
+	assert.Equal(t, "", unifiedDiff(left, left, "left", "right"))
+	assert.Equal(t, "--- /dev/null\n+++ right\n@@ -0,0 +1,1 @@\n+a\n", unifiedDiff("", "a", "/dev/null", "right"))
+}
+
+func TDiffLocalSnapshots(t *testing.T) {
+	leftDir := t.TempDir()
+	rightDir := t.TempDir()
+
+	writeBackupFile(t, leftDir, "test-key-1-10001-AVRO", mockSchema)
+	writeBackupFile(t, leftDir, "test-key-2-10002-AVRO", mockSchema)
+	writeBackupFile(t, rightDir, "test-key-1-10001-AVRO", strings.Replace(mockSchema, "\"int\"", "\"long\"", 1))
+	writeBackupFile(t, rightDir, "newSubject-key-1-10003-AVRO", mockSchema)
+
+	report := diffSnapshots(newLocalSnapshot(leftDir), newLocalSnapshot(rightDir))
+
+	assert.Equal(t, 3, len(report.Changes))
+	assert.Equal(t, SchemaChange{Subject: newSubject, Version: 1, Change: "ADDED"}, withoutDiff(report.Changes[0]))
+	assert.Equal(t, SchemaChange{Subject: testingSubject, Version: 1, Change: "CHANGED", Details: []string{"schema"}}, withoutDiff(report.Changes[1]))
+	assert.Equal(t, SchemaChange{Subject: testingSubject, Version: 2, Change: "REMOVED"}, withoutDiff(report.Changes[2]))
+	assert.True(t, strings.Contains(report.Changes[1].Diff, "+      \"type\": \"long\","))
+
+	var out bytes.Buffer
+	assert.Nil(t, WriteDiffReport(report, "TEXT", &out))
+	assert.True(t, strings.Contains(out.String(), "3 changes between"))
+}
+
+func writeBackupFile(t *testing.T, dir string, name string, contents string) {
+	err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+	assert.Nil(t, err)
+}
+
+// Writes a backup of the given records in the flat layout, without a manifest
+func writeFlatBackup(t *testing.T, records []SchemaRecord) string {
+	backupDir := t.TempDir()
+	for _, record := range records {
+		_, files := renderFlatSchemaFile(record)
+		for name, contents := range files {
+			writeBackupFile(t, backupDir, name, string(contents))
+		}
+	}
+	return backupDir
+}
+
+func withoutDiff(change SchemaChange) SchemaChange {
+	change.Diff = ""
+	return change
+}
@@ -0,0 +1,104 @@
+package client
+
+//
+// fanOutSync_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingDestination struct {
+	SampleCustomDestination
+}
+
+func (fd *failingDestination) RegisterSchema(record SchemaRecord) error {
+	return fmt.Errorf("destination unavailable")
+}
+
+func TestMainStackFanOut(t *testing.T) {
+	t.Run("TFanOutSyncOnce", func(t *testing.T) { TFanOutSyncOnce(t) })
+	t.Run("TSourceSnapshotFetchesOnce", func(t *testing.T) { TSourceSnapshotFetchesOnce(t) })
+	t.Run("TSourceSnapshotConcurrentFetches", func(t *testing.T) { TSourceSnapshotConcurrentFetches(t) })
+}
+
+func TFanOutSyncOnce(t *testing.T) {
+	healthySample := NewSampleCustomDestination()
+	healthy := NewFanOutDestination("healthy", &healthySample)
+	failing := NewFanOutDestination("failing", &failingDestination{NewSampleCustomDestination()})
+
+	snapshot := newSourceSnapshot(map[string][]int64{testingSubject: {1, 2}},
+		func(subject string, version int64, deleted bool) SchemaRecord {
+			return SchemaRecord{Subject: subject, Version: version, Schema: mockSchema, SType: "AVRO"}
+		})
+
+	failing.syncOnce(snapshot)
+	healthy.syncOnce(snapshot)
+
+	assert.ElementsMatch(t, []int64{1, 2}, healthySample.inMemState[testingSubject])
+	assert.Nil(t, healthy.LastError)
+	assert.Equal(t, 0, healthy.ConsecutiveFailures)
+	assert.False(t, healthy.LastSuccessfulSync.IsZero())
+
+	assert.NotNil(t, failing.LastError)
+	assert.Equal(t, 1, failing.ConsecutiveFailures)
+	assert.True(t, failing.LastSuccessfulSync.IsZero())
+}
+
+func TSourceSnapshotFetchesOnce(t *testing.T) {
+	fetches := 0
+	snapshot := newSourceSnapshot(map[string][]int64{testingSubject: {1}},
+		func(subject string, version int64, deleted bool) SchemaRecord {
+			fetches++
+			return SchemaRecord{Subject: subject, Version: version}
+		})
+
+	snapshot.getSchema(testingSubject, 1)
+	snapshot.getSchema(testingSubject, 1)
+
+	assert.Equal(t, 1, fetches)
+}
+
+func TSourceSnapshotConcurrentFetches(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	snapshot := newSourceSnapshot(map[string][]int64{testingSubject: {1, 2}},
+		func(subject string, version int64, deleted bool) SchemaRecord {
+			atomic.AddInt32(&fetches, 1)
+			if version == 1 {
+				<-release
+			}
+			return SchemaRecord{Subject: subject, Version: version}
+		})
+
+	// Destinations waiting on a slow fetch share it
+	var slow sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		slow.Add(1)
+		go func() {
+			defer slow.Done()
+			assert.Equal(t, int64(1), snapshot.getSchema(testingSubject, 1).Version)
+		}()
+	}
+
+	// While other schemas are still fetched
+	fetched := make(chan SchemaRecord)
+	go func() { fetched <- snapshot.getSchema(testingSubject, 2) }()
+	select {
+	case record := <-fetched:
+		assert.Equal(t, int64(2), record.Version)
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetching a schema waited on the fetch of another")
+	}
+
+	close(release)
+	slow.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+}
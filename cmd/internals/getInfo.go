@@ -75,3 +75,9 @@ func DestGetSRUrl() string {
 
 	panic(errors.New("DST_SR_URL environment variable has not been specified"))
 }
+
+// GetArchivePassphrase returns the passphrase used to encrypt and decrypt archives from environment variables
+// it returns an empty string if no passphrase has been specified
+func GetArchivePassphrase() string {
+	return os.Getenv("ARCHIVE_PASSPHRASE")
+}
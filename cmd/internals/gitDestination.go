@@ -0,0 +1,156 @@
+package client
+
+//
+// gitDestination.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+/*
+GitDestination is a CustomDestination writing the registry into a local Git working tree, in the same
+files and manifest as getLocalCopy. Every sync run that changes the registry becomes one commit
+describing the subject versions it added and deleted. Nothing is pushed, the repository is only local.
+*/
+
+type GitDestination struct {
+	Path     string
+	repo     *git.Repository
+	manifest *manifestBuilder
+	added    []SchemaRecord
+	deleted  []SubjectVersion
+}
+
+func NewGitDestination() GitDestination {
+	return GitDestination{}
+}
+
+// Opens the repository at -localPath, initializing it if needed
+func (gd *GitDestination) SetUp() error {
+	repoPath, err := resolveBackupDirectory(gd.Path)
+	if err != nil {
+		return err
+	}
+	gd.Path = repoPath
+	if err := os.MkdirAll(gd.Path, 0755); err != nil {
+		return err
+	}
+
+	repo, err := git.PlainOpen(gd.Path)
+	if err == git.ErrRepositoryNotExists {
+		log.Println("Initializing Git repository at " + gd.Path)
+		repo, err = git.PlainInit(gd.Path, false)
+	}
+	if err != nil {
+		return err
+	}
+	gd.repo = repo
+
+	gd.manifest = newManifestBuilder(SrcSRUrl)
+	if existing, hasManifest := readManifest(gd.Path); hasManifest {
+		gd.manifest.manifest.Schemas = existing.Schemas
+	}
+	gd.added = []SchemaRecord{}
+	gd.deleted = []SubjectVersion{}
+	return nil
+}
+
+func (gd *GitDestination) RegisterSchema(record SchemaRecord) error {
+	if entry, exists := gd.manifest.remove(record.Subject, record.Version); exists {
+		removeBackupFile(gd.Path, entry.Path)
+	}
+	schemaPath := writeSchemaFile(gd.Path, record, false)
+	gd.manifest.add(record, false, gd.Path, schemaPath)
+	gd.added = append(gd.added, record)
+	return nil
+}
+
+func (gd *GitDestination) DeleteSchema(subject string, version int64) error {
+	entry, exists := gd.manifest.remove(subject, version)
+	if !exists {
+		return fmt.Errorf("subject %s with version %d is not in the repository", subject, version)
+	}
+	removeBackupFile(gd.Path, entry.Path)
+	gd.deleted = append(gd.deleted, SubjectVersion{Subject: subject, Version: version})
+	return nil
+}
+
+// Returns the subject versions held by the repository
+func (gd *GitDestination) GetDestinationState() (map[string][]int64, error) {
+	gd.manifest.lock.Lock()
+	defer gd.manifest.lock.Unlock()
+	return stateOfEntries(gd.manifest.manifest.Schemas), nil
+}
+
+// Commits the changes applied since the last commit, if any
+func (gd *GitDestination) CommitChanges() error {
+	if len(gd.added) == 0 && len(gd.deleted) == 0 {
+		return nil
+	}
+
+	gd.manifest.write(gd.Path)
+
+	worktree, err := gd.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := worktree.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+		return err
+	}
+
+	hash, err := worktree.Commit(gd.commitMessage(), &git.CommitOptions{
+		Author: &object.Signature{Name: GitAuthorName, Email: GitAuthorEmail, When: time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Committed %d added and %d deleted schema versions as %s", len(gd.added), len(gd.deleted), hash.String())
+
+	gd.added = []SchemaRecord{}
+	gd.deleted = []SubjectVersion{}
+	return nil
+}
+
+func (gd *GitDestination) TearDown() error {
+	return gd.CommitChanges()
+}
+
+// Describes the pending changes, one line per subject version
+func (gd *GitDestination) commitMessage() string {
+	var message strings.Builder
+	fmt.Fprintf(&message, "Sync %d added and %d deleted schema versions", len(gd.added), len(gd.deleted))
+	if SrcSRUrl != "" {
+		fmt.Fprintf(&message, " from %s", SrcSRUrl)
+	}
+	message.WriteString("\n")
+
+	if len(gd.added) != 0 {
+		sort.Slice(gd.added, func(i, j int) bool {
+			return lessSubjectVersion(gd.added[i].Subject, gd.added[i].Version, gd.added[j].Subject, gd.added[j].Version)
+		})
+		message.WriteString("\nAdded:\n")
+		for _, record := range gd.added {
+			fmt.Fprintf(&message, "  %s version %d (id %d, %s)\n", record.Subject, record.Version, record.Id, record.SType)
+		}
+	}
+	if len(gd.deleted) != 0 {
+		sort.Slice(gd.deleted, func(i, j int) bool {
+			return lessSubjectVersion(gd.deleted[i].Subject, gd.deleted[i].Version, gd.deleted[j].Subject, gd.deleted[j].Version)
+		})
+		message.WriteString("\nDeleted:\n")
+		for _, subjectVersion := range gd.deleted {
+			fmt.Fprintf(&message, "  %s version %d\n", subjectVersion.Subject, subjectVersion.Version)
+		}
+	}
+	return message.String()
+}
@@ -0,0 +1,106 @@
+package client
+
+//
+// gitDestination_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackGit(t *testing.T) {
+	t.Run("TGitDestinationCommits", func(t *testing.T) { TGitDestinationCommits(t) })
+	t.Run("TGitDestinationReRegisterAndFilter", func(t *testing.T) { TGitDestinationReRegisterAndFilter(t) })
+}
+
+func TGitDestinationCommits(t *testing.T) {
+	GitAuthorName = "tester"
+	GitAuthorEmail = "tester@localhost"
+	gitDest := GitDestination{Path: t.TempDir()}
+	assert.Nil(t, gitDest.SetUp())
+
+	secondVersion := SchemaRecord{Subject: testingSubject, Schema: mockSchema, SType: "AVRO", Version: 2, Id: 10002}
+	assert.Nil(t, gitDest.RegisterSchema(SchemaRecord{Subject: testingSubject, Schema: mockSchema, SType: "AVRO", Version: 1, Id: 10001}))
+	assert.Nil(t, gitDest.RegisterSchema(secondVersion))
+	assert.Nil(t, gitDest.CommitChanges())
+
+	// Nothing changed, nothing to commit
+	assert.Nil(t, gitDest.CommitChanges())
+
+	assert.Nil(t, gitDest.DeleteSchema(testingSubject, 1))
+	assert.Nil(t, gitDest.CommitChanges())
+
+	state, err := gitDest.GetDestinationState()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]int64{testingSubject: {2}}, state)
+
+	repo, err := git.PlainOpen(gitDest.Path)
+	assert.Nil(t, err)
+	head, err := repo.Head()
+	assert.Nil(t, err)
+	lastCommit, err := repo.CommitObject(head.Hash())
+	assert.Nil(t, err)
+
+	assert.Equal(t, "Sync 0 added and 1 deleted schema versions\n\nDeleted:\n  test-key version 1\n", lastCommit.Message)
+	assert.Equal(t, "tester", lastCommit.Author.Name)
+	assert.Equal(t, 1, lastCommit.NumParents())
+
+	firstCommit, err := lastCommit.Parent(0)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(firstCommit.Message, "  test-key version 2 (id 10002, AVRO)\n"))
+
+	// The deleted version is gone from the committed tree, the manifest is committed along the schemas
+	tree, err := lastCommit.Tree()
+	assert.Nil(t, err)
+	_, err = tree.File("test-key-1-10001-AVRO")
+	assert.NotNil(t, err)
+	_, err = tree.File("test-key-2-10002-AVRO")
+	assert.Nil(t, err)
+	_, err = tree.File(ManifestFileName)
+	assert.Nil(t, err)
+
+	// The state is read back from the repository
+	reopened := GitDestination{Path: gitDest.Path}
+	assert.Nil(t, reopened.SetUp())
+	state, err = reopened.GetDestinationState()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]int64{testingSubject: {2}}, state)
+}
+
+func TGitDestinationReRegisterAndFilter(t *testing.T) {
+	defer func() { DisallowList = nil }()
+	gitDest := GitDestination{Path: t.TempDir()}
+	assert.Nil(t, gitDest.SetUp())
+
+	assert.Nil(t, gitDest.RegisterSchema(SchemaRecord{Subject: testingSubject, Schema: mockSchema, SType: "AVRO", Version: 1, Id: 10001}))
+	assert.Nil(t, gitDest.RegisterSchema(SchemaRecord{Subject: "filtered-value", Schema: mockSchema, SType: "AVRO", Version: 1, Id: 10002}))
+	assert.Nil(t, gitDest.CommitChanges())
+
+	// A version registered again under another ID replaces the file of the previous one
+	assert.Nil(t, gitDest.RegisterSchema(SchemaRecord{Subject: testingSubject, Schema: mockSchema, SType: "AVRO", Version: 1, Id: 10003}))
+	assert.Nil(t, gitDest.CommitChanges())
+
+	repo, err := git.PlainOpen(gitDest.Path)
+	assert.Nil(t, err)
+	head, err := repo.Head()
+	assert.Nil(t, err)
+	lastCommit, err := repo.CommitObject(head.Hash())
+	assert.Nil(t, err)
+	tree, err := lastCommit.Tree()
+	assert.Nil(t, err)
+	_, err = tree.File("test-key-1-10001-AVRO")
+	assert.NotNil(t, err)
+	_, err = tree.File("test-key-1-10003-AVRO")
+	assert.Nil(t, err)
+
+	// Subjects filtered out are not part of the state, so they are never deleted
+	DisallowList = map[string]bool{"filtered-value": true}
+	state, err := gitDest.GetDestinationState()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]int64{testingSubject: {1}}, state)
+}
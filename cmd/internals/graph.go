@@ -0,0 +1,368 @@
+package client
+
+//
+// graph.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+)
+
+/*
+The dependency graph has a node per subject version and an edge from every schema to each schema it references.
+Edges are read from the references of every schema, and for registries from /referencedby as well, which also
+finds the versions referencing a schema that are not read otherwise, such as soft deleted ones or subjects
+filtered out by the allow and disallow lists. References to subject versions missing from the source are dangling,
+versions of subjects filtered out are not.
+*/
+
+// Define GraphDirection Enum
+type GraphDirection int
+
+const (
+	BOTH_DIRECTIONS GraphDirection = iota
+	DEPENDENCIES
+	DEPENDENTS
+)
+
+func (gd GraphDirection) String() string {
+	return [...]string{"BOTH", "DEPENDENCIES", "DEPENDENTS"}[gd]
+}
+
+func ParseGraphDirection(direction string) (GraphDirection, error) {
+	for _, graphDirection := range []GraphDirection{BOTH_DIRECTIONS, DEPENDENCIES, DEPENDENTS} {
+		if strings.EqualFold(direction, graphDirection.String()) {
+			return graphDirection, nil
+		}
+	}
+	if direction == "" {
+		return BOTH_DIRECTIONS, nil
+	}
+	return BOTH_DIRECTIONS, fmt.Errorf("unknown graph direction %s, expected one of BOTH, DEPENDENCIES or DEPENDENTS", direction)
+}
+
+// A subject version of the graph, Missing when referenced but not found in the source
+type GraphNode struct {
+	Subject string `json:"subject"`
+	Version int64  `json:"version"`
+	Id      int64  `json:"id,omitempty"`
+	SType   string `json:"schemaType,omitempty"`
+	Missing bool   `json:"missing,omitempty"`
+}
+
+// A reference from a subject version to the subject version it references, by the name it is referenced with
+type GraphEdge struct {
+	From SubjectVersion `json:"from"`
+	To   SubjectVersion `json:"to"`
+	Name string         `json:"name,omitempty"`
+}
+
+type DependencyGraph struct {
+	Source   string      `json:"source"`
+	Nodes    []GraphNode `json:"nodes"`
+	Edges    []GraphEdge `json:"edges"`
+	Dangling []GraphEdge `json:"dangling"` // Edges to missing subject versions
+}
+
+// Limits a graph to the versions of a subject and the versions they reach in the given direction
+type GraphFilter struct {
+	Subject      string
+	Direction    GraphDirection
+	DanglingOnly bool // Keeps only the dangling edges and the nodes they link
+}
+
+// Builds the dependency graph of the given source spec, see openSchemaSnapshot for the accepted specs
+func BuildDependencyGraph(sourceSpec string, workingDirectory string, filter GraphFilter) *DependencyGraph {
+	listenForInterruption()
+
+	snapshot := openSchemaSnapshot(sourceSpec, workingDirectory)
+	log.Printf("Building the dependency graph of %s", snapshot.name)
+
+	var referencedBy func(subjectVersion SubjectVersion) []SubjectVersion
+	if snapshot.registry != nil {
+		referencedBy = func(subjectVersion SubjectVersion) []SubjectVersion {
+			referencing, err := snapshot.registry.GetReferencedBy(subjectVersion.Subject, subjectVersion.Version)
+			if err != nil {
+				log.Printf("Could not read the versions referencing %s version %d: %v", subjectVersion.Subject, subjectVersion.Version, err)
+			}
+			return referencing
+		}
+	}
+
+	graph := dependencyGraphOf(snapshot, referencedBy).filter(filter)
+	if len(graph.Dangling) != 0 {
+		log.Printf("Found %d dangling references to missing subject versions", len(graph.Dangling))
+	}
+	return graph
+}
+
+// Returns the graph of the given snapshot, reverse edges read with the given function when not nil
+func dependencyGraphOf(snapshot *schemaSnapshot, referencedBy func(subjectVersion SubjectVersion) []SubjectVersion) *DependencyGraph {
+	nodes := map[SubjectVersion]*GraphNode{}
+	edges := map[GraphEdge]bool{}
+	for subject, versions := range snapshot.subjects {
+		for _, version := range versions {
+			if CancelRun == true {
+				break
+			}
+			record := snapshot.getSchema(subject, version).setTypeIfEmpty()
+			from := SubjectVersion{Subject: subject, Version: version}
+			nodes[from] = &GraphNode{Subject: subject, Version: version, Id: record.Id, SType: record.SType}
+			for _, reference := range record.References {
+				edges[GraphEdge{From: from, To: SubjectVersion{Subject: reference.Subject, Version: reference.Version}, Name: reference.Name}] = true
+			}
+		}
+	}
+
+	if referencedBy != nil {
+		// References read from schemas already are kept, as they hold the name the schema is referenced with
+		found := map[[2]SubjectVersion]bool{}
+		for edge := range edges {
+			found[[2]SubjectVersion{edge.From, edge.To}] = true
+		}
+		for to := range nodes {
+			if CancelRun == true {
+				break
+			}
+			for _, from := range referencedBy(to) {
+				if found[[2]SubjectVersion{from, to}] {
+					continue
+				}
+				found[[2]SubjectVersion{from, to}] = true
+				edges[GraphEdge{From: from, To: to}] = true
+				if _, known := nodes[from]; !known {
+					nodes[from] = &GraphNode{Subject: from.Subject, Version: from.Version}
+				}
+			}
+		}
+	}
+
+	graph := &DependencyGraph{Source: snapshot.name, Nodes: []GraphNode{}, Edges: []GraphEdge{}, Dangling: []GraphEdge{}}
+	for edge := range edges {
+		if _, known := nodes[edge.To]; !known {
+			// Versions of subjects filtered out are not read, but they are not missing from the source
+			missing := snapshot.holds == nil || !snapshot.holds(edge.To)
+			nodes[edge.To] = &GraphNode{Subject: edge.To.Subject, Version: edge.To.Version, Missing: missing}
+		}
+		if nodes[edge.To].Missing {
+			graph.Dangling = append(graph.Dangling, edge)
+		}
+		graph.Edges = append(graph.Edges, edge)
+	}
+	for _, node := range nodes {
+		graph.Nodes = append(graph.Nodes, *node)
+	}
+	graph.sort()
+	return graph
+}
+
+func (dg *DependencyGraph) sort() {
+	sort.Slice(dg.Nodes, func(i, j int) bool {
+		return subjectVersionLess(SubjectVersion{Subject: dg.Nodes[i].Subject, Version: dg.Nodes[i].Version},
+			SubjectVersion{Subject: dg.Nodes[j].Subject, Version: dg.Nodes[j].Version})
+	})
+	for _, edges := range [][]GraphEdge{dg.Edges, dg.Dangling} {
+		sort.Slice(edges, func(i, j int) bool {
+			if edges[i].From != edges[j].From {
+				return subjectVersionLess(edges[i].From, edges[j].From)
+			}
+			if edges[i].To != edges[j].To {
+				return subjectVersionLess(edges[i].To, edges[j].To)
+			}
+			return edges[i].Name < edges[j].Name
+		})
+	}
+}
+
+func subjectVersionLess(left SubjectVersion, right SubjectVersion) bool {
+	if left.Subject != right.Subject {
+		return left.Subject < right.Subject
+	}
+	return left.Version < right.Version
+}
+
+// Returns the part of the graph the given filter keeps
+func (dg *DependencyGraph) filter(filter GraphFilter) *DependencyGraph {
+	if filter.Subject == "" && !filter.DanglingOnly {
+		return dg
+	}
+
+	kept := map[SubjectVersion]bool{}
+	if filter.Subject != "" {
+		roots := []SubjectVersion{}
+		for _, node := range dg.Nodes {
+			if node.Subject == filter.Subject {
+				roots = append(roots, SubjectVersion{Subject: node.Subject, Version: node.Version})
+			}
+		}
+		if len(roots) == 0 {
+			log.Printf("Subject %s is not in the dependency graph of %s", filter.Subject, dg.Source)
+		}
+		if filter.Direction != DEPENDENTS {
+			dg.reach(roots, kept, func(edge GraphEdge) (SubjectVersion, SubjectVersion) { return edge.From, edge.To })
+		}
+		if filter.Direction != DEPENDENCIES {
+			dg.reach(roots, kept, func(edge GraphEdge) (SubjectVersion, SubjectVersion) { return edge.To, edge.From })
+		}
+	} else {
+		for _, node := range dg.Nodes {
+			kept[SubjectVersion{Subject: node.Subject, Version: node.Version}] = true
+		}
+	}
+
+	filtered := &DependencyGraph{Source: dg.Source, Nodes: []GraphNode{}, Edges: []GraphEdge{}, Dangling: []GraphEdge{}}
+	edges := dg.Edges
+	if filter.DanglingOnly {
+		edges = dg.Dangling
+	}
+	linked := map[SubjectVersion]bool{}
+	for _, edge := range edges {
+		if kept[edge.From] && kept[edge.To] {
+			filtered.Edges = append(filtered.Edges, edge)
+			linked[edge.From], linked[edge.To] = true, true
+		}
+	}
+	for _, edge := range dg.Dangling {
+		if kept[edge.From] && kept[edge.To] {
+			filtered.Dangling = append(filtered.Dangling, edge)
+		}
+	}
+	for _, node := range dg.Nodes {
+		subjectVersion := SubjectVersion{Subject: node.Subject, Version: node.Version}
+		if kept[subjectVersion] && (!filter.DanglingOnly || linked[subjectVersion]) {
+			filtered.Nodes = append(filtered.Nodes, node)
+		}
+	}
+	return filtered
+}
+
+// Adds the subject versions reached from the given roots, following edges from the first to the second subject version
+// the given function returns, to the given set
+func (dg *DependencyGraph) reach(roots []SubjectVersion, reached map[SubjectVersion]bool,
+	follow func(edge GraphEdge) (SubjectVersion, SubjectVersion)) {
+	next := map[SubjectVersion][]SubjectVersion{}
+	for _, edge := range dg.Edges {
+		from, to := follow(edge)
+		next[from] = append(next[from], to)
+	}
+
+	visited := map[SubjectVersion]bool{}
+	queue := append([]SubjectVersion{}, roots...)
+	for len(queue) != 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+		reached[current] = true
+		queue = append(queue, next[current]...)
+	}
+}
+
+// Writes the graph in the given format: DOT, MERMAID or JSON
+func WriteDependencyGraph(graph *DependencyGraph, format string, out io.Writer) error {
+	switch strings.ToUpper(format) {
+	case "", "DOT":
+		return writeGraphDot(graph, out)
+	case "MERMAID":
+		return writeGraphMermaid(graph, out)
+	case "JSON":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(graph)
+	}
+	return fmt.Errorf("unknown graph format %s, expected one of DOT, MERMAID or JSON", format)
+}
+
+func graphNodeLabel(node GraphNode) string {
+	label := fmt.Sprintf("%s v%d", node.Subject, node.Version)
+	if node.Missing {
+		label += " (missing)"
+	}
+	return label
+}
+
+func writeGraphDot(graph *DependencyGraph, out io.Writer) error {
+	quote := func(text string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(text) + `"`
+	}
+	id := func(subjectVersion SubjectVersion) string {
+		return quote(fmt.Sprintf("%s/%d", subjectVersion.Subject, subjectVersion.Version))
+	}
+
+	var dot strings.Builder
+	dot.WriteString("digraph references {\n  rankdir=LR;\n  node [shape=box];\n")
+	for _, node := range graph.Nodes {
+		attributes := "label=" + quote(graphNodeLabel(node))
+		if node.Missing {
+			attributes += ", color=red, style=dashed"
+		}
+		fmt.Fprintf(&dot, "  %s [%s];\n", id(SubjectVersion{Subject: node.Subject, Version: node.Version}), attributes)
+	}
+	missing := graph.missing()
+	for _, edge := range graph.Edges {
+		attributes := []string{}
+		if edge.Name != "" {
+			attributes = append(attributes, "label="+quote(edge.Name))
+		}
+		if missing[edge.To] {
+			attributes = append(attributes, "color=red")
+		}
+		fmt.Fprintf(&dot, "  %s -> %s", id(edge.From), id(edge.To))
+		if len(attributes) != 0 {
+			fmt.Fprintf(&dot, " [%s]", strings.Join(attributes, ", "))
+		}
+		dot.WriteString(";\n")
+	}
+	dot.WriteString("}\n")
+
+	_, err := io.WriteString(out, dot.String())
+	return err
+}
+
+func writeGraphMermaid(graph *DependencyGraph, out io.Writer) error {
+	escape := strings.NewReplacer(`"`, "#quot;", "|", "#124;", "\n", " ")
+	ids := map[SubjectVersion]string{}
+
+	var mermaid strings.Builder
+	mermaid.WriteString("graph LR\n")
+	for i, node := range graph.Nodes {
+		subjectVersion := SubjectVersion{Subject: node.Subject, Version: node.Version}
+		ids[subjectVersion] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&mermaid, "  %s[\"%s\"]", ids[subjectVersion], escape.Replace(graphNodeLabel(node)))
+		if node.Missing {
+			mermaid.WriteString(":::missing")
+		}
+		mermaid.WriteString("\n")
+	}
+	for _, edge := range graph.Edges {
+		if edge.Name != "" {
+			fmt.Fprintf(&mermaid, "  %s -->|\"%s\"| %s\n", ids[edge.From], escape.Replace(edge.Name), ids[edge.To])
+		} else {
+			fmt.Fprintf(&mermaid, "  %s --> %s\n", ids[edge.From], ids[edge.To])
+		}
+	}
+	if len(graph.missing()) != 0 {
+		mermaid.WriteString("  classDef missing stroke:#d00,stroke-dasharray:5 5;\n")
+	}
+
+	_, err := io.WriteString(out, mermaid.String())
+	return err
+}
+
+func (dg *DependencyGraph) missing() map[SubjectVersion]bool {
+	missing := map[SubjectVersion]bool{}
+	for _, node := range dg.Nodes {
+		if node.Missing {
+			missing[SubjectVersion{Subject: node.Subject, Version: node.Version}] = true
+		}
+	}
+	return missing
+}
@@ -0,0 +1,217 @@
+package client
+
+//
+// graph_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackGraph(t *testing.T) {
+	t.Run("TParseGraphDirection", func(t *testing.T) { TParseGraphDirection(t) })
+	t.Run("TDependencyGraph", func(t *testing.T) { TDependencyGraph(t) })
+	t.Run("TDependencyGraphFilteredSubjects", func(t *testing.T) { TDependencyGraphFilteredSubjects(t) })
+	t.Run("TDependencyGraphReferencedBy", func(t *testing.T) { TDependencyGraphReferencedBy(t) })
+	t.Run("TFilterDependencyGraph", func(t *testing.T) { TFilterDependencyGraph(t) })
+	t.Run("TGetReferencedBy", func(t *testing.T) { TGetReferencedBy(t) })
+	t.Run("TWriteDependencyGraph", func(t *testing.T) { TWriteDependencyGraph(t) })
+}
+
+// Writes a backup of orders referencing customers, referencing addresses, and of a phone subject version that is missing
+func writeGraphBackup(t *testing.T) string {
+	return writeFlatBackup(t, []SchemaRecord{
+		{Subject: "address-value", Version: 1, Id: 1, SType: AVRO.String(), Schema: `{"type":"record","name":"Address","fields":[]}`},
+		{Subject: "customers-value", Version: 1, Id: 2, SType: AVRO.String(), Schema: `{"type":"record","name":"Customer","fields":[]}`,
+			References: []SchemaReference{{Name: "Address", Subject: "address-value", Version: 1}}},
+		{Subject: "orders-value", Version: 1, Id: 3, SType: AVRO.String(), Schema: `{"type":"record","name":"Order","fields":[]}`,
+			References: []SchemaReference{{Name: "Customer", Subject: "customers-value", Version: 1}, {Name: "Phone", Subject: "phone-value", Version: 4}}},
+		{Subject: "unrelated-value", Version: 1, Id: 4, SType: AVRO.String(), Schema: `{"type":"record","name":"Unrelated","fields":[]}`},
+	})
+}
+
+func graphEdge(from string, fromVersion int64, to string, toVersion int64, name string) GraphEdge {
+	return GraphEdge{From: SubjectVersion{Subject: from, Version: fromVersion}, To: SubjectVersion{Subject: to, Version: toVersion}, Name: name}
+}
+
+func graphNodeNames(graph *DependencyGraph) []string {
+	names := []string{}
+	for _, node := range graph.Nodes {
+		names = append(names, graphNodeLabel(node))
+	}
+	return names
+}
+
+func TParseGraphDirection(t *testing.T) {
+	direction, err := ParseGraphDirection("")
+	assert.Nil(t, err)
+	assert.Equal(t, BOTH_DIRECTIONS, direction)
+	direction, err = ParseGraphDirection("dependents")
+	assert.Nil(t, err)
+	assert.Equal(t, DEPENDENTS, direction)
+	_, err = ParseGraphDirection("SIDEWAYS")
+	assert.NotNil(t, err)
+}
+
+func TDependencyGraph(t *testing.T) {
+	backupDir := writeGraphBackup(t)
+	graph := BuildDependencyGraph(backupDir, "", GraphFilter{})
+
+	assert.Equal(t, backupDir, graph.Source)
+	assert.Equal(t, []GraphNode{
+		{Subject: "address-value", Version: 1, Id: 1, SType: "AVRO"},
+		{Subject: "customers-value", Version: 1, Id: 2, SType: "AVRO"},
+		{Subject: "orders-value", Version: 1, Id: 3, SType: "AVRO"},
+		{Subject: "phone-value", Version: 4, Missing: true},
+		{Subject: "unrelated-value", Version: 1, Id: 4, SType: "AVRO"},
+	}, graph.Nodes)
+	assert.Equal(t, []GraphEdge{
+		graphEdge("customers-value", 1, "address-value", 1, "Address"),
+		graphEdge("orders-value", 1, "customers-value", 1, "Customer"),
+		graphEdge("orders-value", 1, "phone-value", 4, "Phone"),
+	}, graph.Edges)
+	assert.Equal(t, []GraphEdge{graphEdge("orders-value", 1, "phone-value", 4, "Phone")}, graph.Dangling)
+}
+
+func TDependencyGraphFilteredSubjects(t *testing.T) {
+	DisallowList = map[string]bool{"customers-value": true}
+	defer func() { DisallowList = nil }()
+
+	// Versions of disallowed subjects are left out, without the references to them becoming dangling
+	graph := BuildDependencyGraph(writeGraphBackup(t), "", GraphFilter{})
+	assert.Equal(t, []GraphNode{
+		{Subject: "address-value", Version: 1, Id: 1, SType: "AVRO"},
+		{Subject: "customers-value", Version: 1},
+		{Subject: "orders-value", Version: 1, Id: 3, SType: "AVRO"},
+		{Subject: "phone-value", Version: 4, Missing: true},
+		{Subject: "unrelated-value", Version: 1, Id: 4, SType: "AVRO"},
+	}, graph.Nodes)
+	assert.Equal(t, []GraphEdge{graphEdge("orders-value", 1, "phone-value", 4, "Phone")}, graph.Dangling)
+	assert.Equal(t, []GraphEdge{graphEdge("orders-value", 1, "phone-value", 4, "Phone")},
+		BuildDependencyGraph(writeGraphBackup(t), "", GraphFilter{DanglingOnly: true}).Edges)
+}
+
+func TDependencyGraphReferencedBy(t *testing.T) {
+	snapshot := newLocalSnapshot(writeGraphBackup(t))
+	graph := dependencyGraphOf(snapshot, func(subjectVersion SubjectVersion) []SubjectVersion {
+		if subjectVersion == (SubjectVersion{Subject: "address-value", Version: 1}) {
+			// A soft deleted version, along with a version read from its references already
+			return []SubjectVersion{{Subject: "legacy-value", Version: 2}, {Subject: "customers-value", Version: 1}}
+		}
+		return nil
+	})
+
+	assert.Equal(t, []string{"address-value v1", "customers-value v1", "legacy-value v2", "orders-value v1", "phone-value v4 (missing)",
+		"unrelated-value v1"}, graphNodeNames(graph))
+	assert.Equal(t, []GraphEdge{
+		graphEdge("customers-value", 1, "address-value", 1, "Address"),
+		graphEdge("legacy-value", 2, "address-value", 1, ""),
+		graphEdge("orders-value", 1, "customers-value", 1, "Customer"),
+		graphEdge("orders-value", 1, "phone-value", 4, "Phone"),
+	}, graph.Edges)
+}
+
+func TFilterDependencyGraph(t *testing.T) {
+	graph := dependencyGraphOf(newLocalSnapshot(writeGraphBackup(t)), nil)
+
+	dependencies := graph.filter(GraphFilter{Subject: "customers-value", Direction: DEPENDENCIES})
+	assert.Equal(t, []string{"address-value v1", "customers-value v1"}, graphNodeNames(dependencies))
+	assert.Equal(t, []GraphEdge{graphEdge("customers-value", 1, "address-value", 1, "Address")}, dependencies.Edges)
+
+	dependents := graph.filter(GraphFilter{Subject: "customers-value", Direction: DEPENDENTS})
+	assert.Equal(t, []string{"customers-value v1", "orders-value v1"}, graphNodeNames(dependents))
+	assert.Equal(t, []GraphEdge{graphEdge("orders-value", 1, "customers-value", 1, "Customer")}, dependents.Edges)
+	assert.Equal(t, []GraphEdge{}, dependents.Dangling)
+
+	// The dependents of a subject are followed to their own dependents, not to their other dependencies
+	both := graph.filter(GraphFilter{Subject: "customers-value"})
+	assert.Equal(t, []string{"address-value v1", "customers-value v1", "orders-value v1"}, graphNodeNames(both))
+	assert.Equal(t, 2, len(both.Edges))
+
+	dangling := graph.filter(GraphFilter{DanglingOnly: true})
+	assert.Equal(t, []string{"orders-value v1", "phone-value v4 (missing)"}, graphNodeNames(dangling))
+	assert.Equal(t, []GraphEdge{graphEdge("orders-value", 1, "phone-value", 4, "Phone")}, dangling.Edges)
+	assert.Equal(t, dangling.Edges, dangling.Dangling)
+
+	assert.Equal(t, 0, len(graph.filter(GraphFilter{Subject: "customers-value", DanglingOnly: true}).Nodes))
+	assert.Equal(t, 0, len(graph.filter(GraphFilter{Subject: "missing-value"}).Nodes))
+}
+
+func TGetReferencedBy(t *testing.T) {
+	HttpCallTimeout = 60
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/subjects/address-value/versions/1/referencedby":
+			_, _ = w.Write([]byte(`[7, 8]`))
+		case "/schemas/ids/7/versions":
+			_, _ = w.Write([]byte(`[{"subject":"customers-value","version":1},{"subject":"buyers-value","version":3}]`))
+		case "/schemas/ids/8/versions":
+			_, _ = w.Write([]byte(`[{"subject":"orders-value","version":2}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error_code":40402,"message":"Version not found"}`))
+		}
+	}))
+	defer server.Close()
+	srClient := NewSchemaRegistryClient(server.URL, "key", "secret", "src")
+
+	referencing, err := srClient.GetReferencedBy("address-value", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []SubjectVersion{{Subject: "customers-value", Version: 1}, {Subject: "buyers-value", Version: 3},
+		{Subject: "orders-value", Version: 2}}, referencing)
+
+	_, err = srClient.GetReferencedBy("address-value", 2)
+	assert.Equal(t, "error code 40402: Version not found", err.Error())
+}
+
+func TWriteDependencyGraph(t *testing.T) {
+	graph := dependencyGraphOf(newLocalSnapshot(writeGraphBackup(t)), nil).filter(GraphFilter{Subject: "orders-value", Direction: DEPENDENCIES})
+
+	var dot bytes.Buffer
+	assert.Nil(t, WriteDependencyGraph(graph, "DOT", &dot))
+	assert.Equal(t, "digraph references {\n  rankdir=LR;\n  node [shape=box];\n"+
+		"  \"address-value/1\" [label=\"address-value v1\"];\n"+
+		"  \"customers-value/1\" [label=\"customers-value v1\"];\n"+
+		"  \"orders-value/1\" [label=\"orders-value v1\"];\n"+
+		"  \"phone-value/4\" [label=\"phone-value v4 (missing)\", color=red, style=dashed];\n"+
+		"  \"customers-value/1\" -> \"address-value/1\" [label=\"Address\"];\n"+
+		"  \"orders-value/1\" -> \"customers-value/1\" [label=\"Customer\"];\n"+
+		"  \"orders-value/1\" -> \"phone-value/4\" [label=\"Phone\", color=red];\n"+
+		"}\n", dot.String())
+
+	var mermaid bytes.Buffer
+	assert.Nil(t, WriteDependencyGraph(graph, "mermaid", &mermaid))
+	assert.Equal(t, "graph LR\n"+
+		"  n0[\"address-value v1\"]\n"+
+		"  n1[\"customers-value v1\"]\n"+
+		"  n2[\"orders-value v1\"]\n"+
+		"  n3[\"phone-value v4 (missing)\"]:::missing\n"+
+		"  n1 -->|\"Address\"| n0\n"+
+		"  n2 -->|\"Customer\"| n1\n"+
+		"  n2 -->|\"Phone\"| n3\n"+
+		"  classDef missing stroke:#d00,stroke-dasharray:5 5;\n", mermaid.String())
+
+	var jsonGraph bytes.Buffer
+	assert.Nil(t, WriteDependencyGraph(graph, "JSON", &jsonGraph))
+	decoded := DependencyGraph{}
+	assert.Nil(t, json.Unmarshal(jsonGraph.Bytes(), &decoded))
+	assert.Equal(t, *graph, decoded)
+
+	assert.NotNil(t, WriteDependencyGraph(graph, "SVG", &dot))
+
+	// Quotes are escaped
+	quoted := &DependencyGraph{Nodes: []GraphNode{{Subject: `a"b`, Version: 1}}, Edges: []GraphEdge{}}
+	dot.Reset()
+	mermaid.Reset()
+	assert.Nil(t, WriteDependencyGraph(quoted, "DOT", &dot))
+	assert.Nil(t, WriteDependencyGraph(quoted, "MERMAID", &mermaid))
+	assert.Contains(t, dot.String(), `"a\"b/1" [label="a\"b v1"];`)
+	assert.Equal(t, "graph LR\n  n0[\"a#quot;b v1\"]\n", mermaid.String())
+}
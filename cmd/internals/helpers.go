@@ -75,6 +75,15 @@ func referenceIsInSlice(i SchemaReference, list []SchemaReference) bool {
 	return false
 }
 
+func stringIsInSlice(value string, list []string) bool {
+	for _, current := range list {
+		if current == value {
+			return true
+		}
+	}
+	return false
+}
+
 // Returns an HTTP request with the given information to execute
 func GetNewRequest(method string, endpoint string, key string, secret string, headers map[string]string, reader io.Reader) *http.Request {
 	req, err := http.NewRequest(method, endpoint, reader)
@@ -421,15 +430,16 @@ func RegisterReferences(wrappingSchema SchemaRecord, srcClient *SchemaRegistryCl
 	}
 }
 
-func RegisterReferencesFromLocalFS(referencesToRegister []SchemaReference, dstClient *SchemaRegistryClient, pathToLookForReferences string) {
+func RegisterReferencesFromLocalFS(referencesToRegister []SchemaReference, dstClient *SchemaRegistryClient, pathToLookForReferences string,
+	compatibility *compatibilityGate) {
 
 	err := filepath.Walk(pathToLookForReferences,
 		func(path string, info os.FileInfo, err error) error {
 			check(err)
 			for _, oneRef := range referencesToRegister {
-				if !info.IsDir() && strings.Contains(info.Name(), fmt.Sprintf("%s-%d", url.QueryEscape(oneRef.Subject), oneRef.Version)) {
+				if !skipBackupFile(path, info) && strings.Contains(info.Name(), fmt.Sprintf("%s-%d", url.QueryEscape(oneRef.Subject), oneRef.Version)) {
 					log.Println(fmt.Sprintf("Writing referenced schema with Subject: %s and Version: %d. Filepath: %s", oneRef.Subject, oneRef.Version, path))
-					writeSchemaToSR(dstClient, path)
+					writeSchemaToSR(dstClient, path, compatibility)
 				}
 			}
 
@@ -470,3 +480,26 @@ func WriteFile(path string, filename string, contents string) {
 	_, err = f.WriteString(contents)
 	check(err)
 }
+
+// Returns an error if the given Schema Registry response body describes one
+func errorFromResponse(body []byte) error {
+	if body == nil {
+		return fmt.Errorf("no response received from Schema Registry")
+	}
+	errMsg := ErrorMessage{}
+	err := json.Unmarshal(body, &errMsg)
+	if err == nil && errMsg.ErrorCode != 0 {
+		return fmt.Errorf("error code %d: %s", errMsg.ErrorCode, errMsg.ErrorMessage)
+	}
+	return nil
+}
+
+// Returns the file reports should be written to, standard output is used when no path is given
+func OpenReportOutput(path string) *os.File {
+	if path == "" {
+		return os.Stdout
+	}
+	f, err := os.Create(path)
+	checkFail(err, "Could not create report file "+path)
+	return f
+}
@@ -0,0 +1,368 @@
+package client
+
+//
+// incremental.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+Incremental backups keep one directory per getLocalCopy run under the backup path, named after the time of the run.
+Each snapshot directory only holds the schema files added or changed since the previous snapshot, and a snapshot.json
+recording those changes along with the subject versions removed since then.
+The state of the registry at any snapshot is rebuilt by replaying the snapshots in order up to it.
+*/
+
+var SnapshotFileName = "snapshot.json"
+var snapshotNameLayout = "20060102T150405Z"
+
+// Describes the changes recorded by one incremental backup run
+type BackupSnapshot struct {
+	Name            string           `json:"name"`
+	SourceUrl       string           `json:"sourceUrl"`
+	ExporterVersion string           `json:"exporterVersion"`
+	CreatedAt       time.Time        `json:"createdAt"`
+	Previous        string           `json:"previous,omitempty"`
+	Changes         []ManifestEntry  `json:"changes"`
+	Removed         []SubjectVersion `json:"removed"`
+	Config          *RegistryConfig  `json:"config,omitempty"`
+}
+
+// Writes a new snapshot of the source registry holding only the changes since the last snapshot under the given path
+func WriteIncrementalToFS(srcClient *SchemaRegistryClient, definedPath string, workingDirectory string) {
+	listenForInterruption()
+
+	definedPath = CheckPath(definedPath, workingDirectory)
+
+	snapshots := listSnapshots(definedPath)
+	previousState := map[SubjectVersion]ManifestEntry{}
+	previous := ""
+	if len(snapshots) != 0 {
+		previous = snapshots[len(snapshots)-1]
+		previousState = snapshotState(definedPath, snapshots)
+	}
+
+	createdAt := time.Now().UTC()
+	snapshot := BackupSnapshot{
+		Name:            createdAt.Format(snapshotNameLayout),
+		SourceUrl:       srcClient.SRUrl,
+		ExporterVersion: Version,
+		CreatedAt:       createdAt,
+		Previous:        previous,
+		Changes:         []ManifestEntry{},
+		Removed:         []SubjectVersion{},
+	}
+	snapshotPath := filepath.Join(definedPath, snapshot.Name)
+	if fileExists(snapshotPath) {
+		log.Fatalln("A snapshot named " + snapshot.Name + " already exists, try again in a second.")
+	}
+	check(os.Mkdir(snapshotPath, 0755))
+
+	manifest := newManifestBuilder(srcClient.SRUrl)
+
+	log.Printf("Writing changes from %s since snapshot %s to path %s", srcClient.SRUrl, previousOrNone(previous), snapshotPath)
+	writeRegistryLocally(srcClient, snapshotPath, manifest)
+	snapshot.Config = manifest.manifest.Config
+
+	if CancelRun == true {
+		log.Println("Interrupted, removing partial snapshot " + snapshot.Name)
+		check(os.RemoveAll(snapshotPath))
+		return
+	}
+
+	// Only changed schema files are kept in the snapshot
+	current := map[SubjectVersion]bool{}
+	for _, entry := range manifest.manifest.Schemas {
+		key := SubjectVersion{Subject: entry.Subject, Version: entry.Version}
+		current[key] = true
+		if previousEntry, exists := previousState[key]; exists && sameManifestEntry(previousEntry, entry) {
+			removeSchemaFile(filepath.Join(snapshotPath, filepath.FromSlash(entry.Path)))
+			continue
+		}
+		snapshot.Changes = append(snapshot.Changes, entry)
+	}
+	for key := range previousState {
+		if !current[key] {
+			snapshot.Removed = append(snapshot.Removed, key)
+		}
+	}
+
+	if len(snapshot.Changes) == 0 && len(snapshot.Removed) == 0 && previous != "" &&
+		reflect.DeepEqual(snapshot.Config, readSnapshot(definedPath, previous).Config) {
+		log.Println("No changes since snapshot " + previousOrNone(previous) + ", no snapshot written")
+		check(os.RemoveAll(snapshotPath))
+	} else {
+		writeSnapshot(definedPath, snapshot)
+		log.Printf("Wrote snapshot %s with %d added or changed and %d removed schemas",
+			snapshot.Name, len(snapshot.Changes), len(snapshot.Removed))
+	}
+
+	if RetainSnapshots > 0 {
+		PruneSnapshots(definedPath, RetainSnapshots)
+	}
+}
+
+// Keeps only the given number of most recent snapshots. The oldest kept snapshot is rewritten
+// to hold the full state of the registry at its time, so later snapshots can still be restored.
+func PruneSnapshots(backupPath string, retain int) {
+	snapshots := listSnapshots(backupPath)
+	if retain <= 0 || len(snapshots) <= retain {
+		return
+	}
+
+	pruned := snapshots[:len(snapshots)-retain]
+	base := snapshots[len(snapshots)-retain]
+	state := snapshotState(backupPath, snapshots[:len(snapshots)-retain+1])
+
+	baseSnapshot := readSnapshot(backupPath, base)
+	baseSnapshot.Previous = ""
+	baseSnapshot.Changes = []ManifestEntry{}
+	baseSnapshot.Removed = []SubjectVersion{}
+	for _, entry := range sortedManifestEntries(state) {
+		// Entry paths start with the name of the snapshot holding them
+		pathParts := strings.SplitN(entry.Path, "/", 2)
+		snapshotName, relativePath := pathParts[0], pathParts[1]
+		if snapshotName != base {
+			copySchemaFile(filepath.Join(backupPath, filepath.FromSlash(entry.Path)),
+				filepath.Join(backupPath, base, filepath.FromSlash(relativePath)))
+		}
+		entry.Path = relativePath
+		baseSnapshot.Changes = append(baseSnapshot.Changes, entry)
+	}
+	writeSnapshot(backupPath, baseSnapshot)
+
+	for _, snapshotName := range pruned {
+		log.Println("Pruning snapshot " + snapshotName)
+		check(os.RemoveAll(filepath.Join(backupPath, snapshotName)))
+	}
+}
+
+// Returns the names of the snapshots under the given backup path, oldest first
+func listSnapshots(backupPath string) []string {
+	dirEntries, err := ioutil.ReadDir(backupPath)
+	if err != nil {
+		return []string{}
+	}
+
+	snapshots := []string{}
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() && fileExists(filepath.Join(backupPath, dirEntry.Name(), SnapshotFileName)) {
+			snapshots = append(snapshots, dirEntry.Name())
+		}
+	}
+	sort.Strings(snapshots)
+	return snapshots
+}
+
+// Returns whether the given backup path holds incremental snapshots
+func hasSnapshots(backupPath string) bool {
+	return len(listSnapshots(backupPath)) != 0
+}
+
+// Returns the snapshots to replay to restore the registry as of the given point in time.
+// The point in time is either a snapshot name or an RFC3339 timestamp, empty meaning the latest snapshot.
+func snapshotsUpTo(backupPath string, restoreAt string) ([]string, error) {
+	snapshots := listSnapshots(backupPath)
+	if restoreAt == "" {
+		return snapshots, nil
+	}
+
+	limit := restoreAt
+	if pointInTime, err := time.Parse(time.RFC3339, restoreAt); err == nil {
+		limit = pointInTime.UTC().Format(snapshotNameLayout)
+	} else if !snapshotIsListed(snapshots, restoreAt) {
+		// Other values would be compared with snapshot names as they are, silently restoring another point in time
+		return nil, fmt.Errorf("%s is neither an RFC3339 timestamp nor the name of a snapshot of %s", restoreAt, backupPath)
+	}
+
+	upTo := 0
+	for upTo < len(snapshots) && snapshots[upTo] <= limit {
+		upTo++
+	}
+	if upTo == 0 {
+		return nil, fmt.Errorf("no snapshot was taken at or before %s", restoreAt)
+	}
+	return snapshots[:upTo], nil
+}
+
+func snapshotIsListed(snapshots []string, name string) bool {
+	for _, snapshot := range snapshots {
+		if snapshot == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Replays the given snapshots, returning the resulting subject versions.
+// Entry paths are relative to the backup path.
+func snapshotState(backupPath string, snapshots []string) map[SubjectVersion]ManifestEntry {
+	state := map[SubjectVersion]ManifestEntry{}
+	for _, snapshotName := range snapshots {
+		snapshot := readSnapshot(backupPath, snapshotName)
+		for _, removed := range snapshot.Removed {
+			delete(state, removed)
+		}
+		for _, entry := range snapshot.Changes {
+			entry.Path = path.Join(snapshotName, entry.Path)
+			state[SubjectVersion{Subject: entry.Subject, Version: entry.Version}] = entry
+		}
+	}
+	return state
+}
+
+// Returns a manifest describing the registry as of the given point in time, see snapshotsUpTo
+func snapshotManifest(backupPath string, restoreAt string) (*BackupManifest, error) {
+	snapshots, err := snapshotsUpTo(backupPath, restoreAt)
+	if err != nil {
+		return nil, err
+	}
+	last := readSnapshot(backupPath, snapshots[len(snapshots)-1])
+
+	return &BackupManifest{
+		SourceUrl:       last.SourceUrl,
+		ExporterVersion: last.ExporterVersion,
+		CreatedAt:       last.CreatedAt,
+		Config:          last.Config,
+		Schemas:         sortedManifestEntries(snapshotState(backupPath, snapshots)),
+	}, nil
+}
+
+// Returns the manifest of the given backup: rebuilt from its snapshots for incremental backups,
+// read from its manifest.json, or rebuilt from its sidecars for SUBJECT layout backups without a manifest
+func readBackupManifest(backupPath string, restoreAt string) (*BackupManifest, bool) {
+	if hasSnapshots(backupPath) {
+		manifest, err := snapshotManifest(backupPath, restoreAt)
+		checkFail(err, "Could not select a snapshot to restore")
+		return manifest, true
+	}
+	if manifest, hasManifest := readManifest(backupPath); hasManifest {
+		return manifest, true
+	}
+	return sidecarManifest(backupPath)
+}
+
+func readSnapshot(backupPath string, snapshotName string) BackupSnapshot {
+	snapshotFile := filepath.Join(backupPath, snapshotName, SnapshotFileName)
+	contents, err := ioutil.ReadFile(snapshotFile)
+	check(err)
+
+	snapshot := BackupSnapshot{}
+	err = json.Unmarshal(contents, &snapshot)
+	checkFail(err, "Could not parse the backup snapshot "+snapshotFile)
+	return snapshot
+}
+
+func writeSnapshot(backupPath string, snapshot BackupSnapshot) {
+	sort.Slice(snapshot.Changes, func(i, j int) bool {
+		return lessSubjectVersion(snapshot.Changes[i].Subject, snapshot.Changes[i].Version,
+			snapshot.Changes[j].Subject, snapshot.Changes[j].Version)
+	})
+	sort.Slice(snapshot.Removed, func(i, j int) bool {
+		return lessSubjectVersion(snapshot.Removed[i].Subject, snapshot.Removed[i].Version,
+			snapshot.Removed[j].Subject, snapshot.Removed[j].Version)
+	})
+
+	snapshotJson, err := json.MarshalIndent(snapshot, "", "  ")
+	check(err)
+	err = ioutil.WriteFile(filepath.Join(backupPath, snapshot.Name, SnapshotFileName), snapshotJson, 0644)
+	check(err)
+}
+
+func sortedManifestEntries(state map[SubjectVersion]ManifestEntry) []ManifestEntry {
+	entries := []ManifestEntry{}
+	for _, entry := range state {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return lessSubjectVersion(entries[i].Subject, entries[i].Version, entries[j].Subject, entries[j].Version)
+	})
+	return entries
+}
+
+// Returns the live subject versions of the given entries allowed by -allowList and -disallowList. Destinations report
+// their state this way, as subjects filtered out would otherwise be mirrored as deletes on every sync.
+func stateOfEntries(entries []ManifestEntry) map[string][]int64 {
+	state := map[string][]int64{}
+	for _, entry := range entries {
+		if !entry.SoftDeleted && checkSubjectIsAllowed(entry.Subject) {
+			state[entry.Subject] = append(state[entry.Subject], entry.Version)
+		}
+	}
+	for _, versions := range state {
+		sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	}
+	return state
+}
+
+func lessSubjectVersion(leftSubject string, leftVersion int64, rightSubject string, rightVersion int64) bool {
+	if leftSubject != rightSubject {
+		return leftSubject < rightSubject
+	}
+	return leftVersion < rightVersion
+}
+
+// Returns whether two entries describe the same schema, regardless of where they are stored
+func sameManifestEntry(left ManifestEntry, right ManifestEntry) bool {
+	return left.Id == right.Id && left.SType == right.SType && left.Checksum == right.Checksum &&
+		left.SoftDeleted == right.SoftDeleted && formatReferences(left.References) == formatReferences(right.References)
+}
+
+// Removes a schema file of a backup, along with its sidecar if it has one
+func removeSchemaFile(schemaPath string) {
+	check(os.Remove(schemaPath))
+	if sidecarPath := sidecarPathOf(schemaPath); sidecarPath != "" && fileExists(sidecarPath) {
+		check(os.Remove(sidecarPath))
+	}
+}
+
+// Removes a schema file of the backup along with its sidecar, and its subject directory once empty
+func removeBackupFile(backupPath string, relativePath string) {
+	schemaPath := filepath.Join(backupPath, filepath.FromSlash(relativePath))
+	if !fileExists(schemaPath) {
+		return
+	}
+	removeSchemaFile(schemaPath)
+
+	subjectDir := filepath.Dir(schemaPath)
+	if subjectDir == filepath.Clean(backupPath) {
+		return
+	}
+	if remaining, err := ioutil.ReadDir(subjectDir); err == nil && len(remaining) == 0 {
+		checkDontFail(os.Remove(subjectDir))
+	}
+}
+
+// Copies a schema file of a backup, along with its sidecar if it has one
+func copySchemaFile(fromPath string, toPath string) {
+	check(os.MkdirAll(filepath.Dir(toPath), 0755))
+	contents, err := ioutil.ReadFile(fromPath)
+	check(err)
+	check(ioutil.WriteFile(toPath, contents, 0644))
+
+	if sidecarPath := sidecarPathOf(fromPath); sidecarPath != "" && fileExists(sidecarPath) {
+		contents, err := ioutil.ReadFile(sidecarPath)
+		check(err)
+		check(ioutil.WriteFile(sidecarPathOf(toPath), contents, 0644))
+	}
+}
+
+func previousOrNone(previous string) string {
+	if previous == "" {
+		return "(none)"
+	}
+	return previous
+}
@@ -0,0 +1,100 @@
+package client
+
+//
+// incremental_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackIncremental(t *testing.T) {
+	t.Run("TSnapshotReplay", func(t *testing.T) { TSnapshotReplay(t) })
+	t.Run("TSnapshotRestoreAt", func(t *testing.T) { TSnapshotRestoreAt(t) })
+	t.Run("TPruneSnapshots", func(t *testing.T) { TPruneSnapshots(t) })
+}
+
+// Writes three snapshots: version 1 and 2 are added, then version 2 is changed, then version 1 is removed
+func writeTestSnapshots(t *testing.T) string {
+	backupDir := t.TempDir()
+	writeTestSnapshot(t, backupDir, "20210101T000000Z", []SubjectVersion{{testingSubject, 1}, {testingSubject, 2}}, nil)
+	writeTestSnapshot(t, backupDir, "20210102T000000Z", []SubjectVersion{{testingSubject, 2}}, nil)
+	writeTestSnapshot(t, backupDir, "20210103T000000Z", nil, []SubjectVersion{{testingSubject, 1}})
+	return backupDir
+}
+
+func writeTestSnapshot(t *testing.T, backupDir string, name string, changed []SubjectVersion, removed []SubjectVersion) {
+	assert.Nil(t, os.Mkdir(filepath.Join(backupDir, name), 0755))
+	snapshot := BackupSnapshot{Name: name, Changes: []ManifestEntry{}, Removed: removed}
+	for _, subjectVersion := range changed {
+		fileName := fmt.Sprintf("%s-%d-%s", subjectVersion.Subject, subjectVersion.Version, name)
+		writeBackupFile(t, filepath.Join(backupDir, name), fileName, mockSchema)
+		snapshot.Changes = append(snapshot.Changes, ManifestEntry{
+			Subject: subjectVersion.Subject, Version: subjectVersion.Version, Id: 10001, SType: "AVRO", Path: fileName,
+		})
+	}
+	writeSnapshot(backupDir, snapshot)
+}
+
+func TSnapshotReplay(t *testing.T) {
+	backupDir := writeTestSnapshots(t)
+
+	assert.Equal(t, []string{"20210101T000000Z", "20210102T000000Z", "20210103T000000Z"}, listSnapshots(backupDir))
+
+	state := snapshotState(backupDir, listSnapshots(backupDir))
+	assert.Equal(t, 1, len(state))
+	assert.Equal(t, "20210102T000000Z/"+testingSubject+"-2-20210102T000000Z", state[SubjectVersion{testingSubject, 2}].Path)
+
+	manifest, hasManifest := readBackupManifest(backupDir, "")
+	assert.True(t, hasManifest)
+	record, err := manifest.Schemas[0].readRecord(backupDir)
+	assert.Nil(t, err)
+	assert.Equal(t, mockSchema, record.Schema)
+}
+
+func TSnapshotRestoreAt(t *testing.T) {
+	backupDir := writeTestSnapshots(t)
+
+	snapshots, err := snapshotsUpTo(backupDir, "20210101T000000Z")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"20210101T000000Z"}, snapshots)
+
+	snapshots, err = snapshotsUpTo(backupDir, "2021-01-02T12:00:00Z")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"20210101T000000Z", "20210102T000000Z"}, snapshots)
+
+	manifest, err := snapshotManifest(backupDir, "2021-01-02T12:00:00Z")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(manifest.Schemas))
+
+	_, err = snapshotsUpTo(backupDir, "2020-12-31T00:00:00Z")
+	assert.NotNil(t, err)
+
+	// Values that are neither timestamps nor snapshot names are not compared with snapshot names
+	_, err = snapshotsUpTo(backupDir, "2021-01-03")
+	assert.Equal(t, "2021-01-03 is neither an RFC3339 timestamp nor the name of a snapshot of "+backupDir, err.Error())
+	_, err = snapshotsUpTo(backupDir, "20210102T120000Z")
+	assert.NotNil(t, err)
+}
+
+func TPruneSnapshots(t *testing.T) {
+	backupDir := writeTestSnapshots(t)
+	before, _ := snapshotManifest(backupDir, "")
+
+	PruneSnapshots(backupDir, 1)
+
+	assert.Equal(t, []string{"20210103T000000Z"}, listSnapshots(backupDir))
+	after, _ := snapshotManifest(backupDir, "")
+	assert.Equal(t, len(before.Schemas), len(after.Schemas))
+	assert.Equal(t, before.Schemas[0].Version, after.Schemas[0].Version)
+
+	record, err := after.Schemas[0].readRecord(backupDir)
+	assert.Nil(t, err)
+	assert.Equal(t, mockSchema, record.Schema)
+}
@@ -0,0 +1,203 @@
+package client
+
+//
+// layout.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+/*
+Local backups are written in one of two layouts.
+FLAT writes one file per schema named subject-version-id-TYPE, with references at the end of the file.
+SUBJECT writes one directory per subject holding files named after their version with the native extension of
+their type (v3.avsc, v3.proto, v3.schema.json), JSON based schemas pretty printed, and their metadata in a
+sidecar file next to them (v3.meta.json).
+*/
+
+// Define BackupLayout Enum
+type BackupLayout int
+
+const (
+	FLAT BackupLayout = iota
+	SUBJECT
+)
+
+func (bl BackupLayout) String() string {
+	return [...]string{"FLAT", "SUBJECT"}[bl]
+}
+
+var sidecarExtension = ".meta.json"
+var nativeExtensions = map[string]string{
+	AVRO.String():     ".avsc",
+	PROTOBUF.String(): ".proto",
+	JSON.String():     ".schema.json",
+}
+
+// Metadata of a schema written in the SUBJECT layout
+type schemaSidecar struct {
+	Subject     string            `json:"subject"`
+	Version     int64             `json:"version"`
+	Id          int64             `json:"id"`
+	SType       string            `json:"schemaType"`
+	References  []SchemaReference `json:"references"`
+	SoftDeleted bool              `json:"softDeleted"`
+	SchemaFile  string            `json:"schemaFile"`
+}
+
+func ParseBackupLayout(layout string) (BackupLayout, error) {
+	switch strings.ToUpper(layout) {
+	case "", FLAT.String():
+		return FLAT, nil
+	case SUBJECT.String():
+		return SUBJECT, nil
+	}
+	return FLAT, fmt.Errorf("unknown backup layout %s, expected one of FLAT or SUBJECT", layout)
+}
+
+// Writes the given schema under the given path in the layout chosen with -backupLayout,
+// returning the path of the schema file
+func writeSchemaFile(pathToWrite string, record SchemaRecord, softDeleted bool) string {
+	schemaFile, files := renderSchemaFiles(record, softDeleted)
+	for relativePath, contents := range files {
+		fullPath := filepath.Join(pathToWrite, filepath.FromSlash(relativePath))
+		check(os.MkdirAll(filepath.Dir(fullPath), 0755))
+		check(ioutil.WriteFile(fullPath, contents, 0644))
+	}
+	return filepath.Join(pathToWrite, filepath.FromSlash(schemaFile))
+}
+
+// Returns the files describing the given schema in the layout chosen with -backupLayout, by their path
+// relative to the root of the backup, along with the path of the schema file
+func renderSchemaFiles(record SchemaRecord, softDeleted bool) (string, map[string][]byte) {
+	layout, err := ParseBackupLayout(BackupLayoutName)
+	checkFail(err, "Could not write schema")
+	if layout == SUBJECT {
+		return renderSubjectSchemaFiles(record, softDeleted)
+	}
+	return renderFlatSchemaFile(record)
+}
+
+func renderFlatSchemaFile(record SchemaRecord) (string, map[string][]byte) {
+	filename := fmt.Sprintf("%s-%d-%d-%s", url.QueryEscape(record.Subject), record.Version, record.Id, record.SType)
+
+	var contents bytes.Buffer
+	contents.WriteString(record.Schema)
+	if len(record.References) != 0 {
+		contents.WriteString("\n")
+		contents.WriteString(ReferenceSeparator)
+		contents.WriteString("\n")
+		for _, oneRef := range record.References {
+			jsonRepresentation, err := json.Marshal(oneRef)
+			check(err)
+			contents.Write(jsonRepresentation)
+			contents.WriteString("|\n")
+		}
+	}
+
+	return filename, map[string][]byte{filename: contents.Bytes()}
+}
+
+func renderSubjectSchemaFiles(record SchemaRecord, softDeleted bool) (string, map[string][]byte) {
+	record = record.setTypeIfEmpty().setReferenceIfEmpty()
+	subjectDir := url.QueryEscape(record.Subject)
+	schemaFile := fmt.Sprintf("v%d%s", record.Version, nativeExtensions[record.SType])
+
+	sidecar := schemaSidecar{
+		Subject:     record.Subject,
+		Version:     record.Version,
+		Id:          record.Id,
+		SType:       record.SType,
+		References:  record.References,
+		SoftDeleted: softDeleted,
+		SchemaFile:  schemaFile,
+	}
+	sidecarJson, err := json.MarshalIndent(sidecar, "", "  ")
+	check(err)
+
+	schemaPath := path.Join(subjectDir, schemaFile)
+	return schemaPath, map[string][]byte{
+		schemaPath:                []byte(prettySchema(record)),
+		sidecarPathOf(schemaPath): sidecarJson,
+	}
+}
+
+// Returns the path of the sidecar describing the given schema file, or an empty string for FLAT layout files
+func sidecarPathOf(schemaPath string) string {
+	for _, extension := range nativeExtensions {
+		if strings.HasSuffix(schemaPath, extension) {
+			return strings.TrimSuffix(schemaPath, extension) + sidecarExtension
+		}
+	}
+	return ""
+}
+
+// Returns whether the given path is a schema file or a sidecar written in the SUBJECT layout
+func isSubjectLayoutFile(path string) bool {
+	return strings.HasSuffix(path, sidecarExtension) || sidecarPathOf(path) != ""
+}
+
+// Returns the schema as registered from the contents of a schema file,
+// undoing the pretty printing of JSON based schemas in the SUBJECT layout
+func schemaFromFile(schemaPath string, stype string, contents []byte) string {
+	if sidecarPathOf(schemaPath) == "" || stype == PROTOBUF.String() {
+		return string(contents)
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, contents); err != nil {
+		return string(contents)
+	}
+	return compacted.String()
+}
+
+// Returns a manifest built from the sidecars of a SUBJECT layout backup, if the backup has any
+func sidecarManifest(backupPath string) (*BackupManifest, bool) {
+	manifest := BackupManifest{Schemas: []ManifestEntry{}}
+
+	err := filepath.Walk(backupPath,
+		func(path string, info os.FileInfo, err error) error {
+			check(err)
+			if info.IsDir() || !strings.HasSuffix(path, sidecarExtension) {
+				return nil
+			}
+
+			contents, err := ioutil.ReadFile(path)
+			check(err)
+			sidecar := schemaSidecar{}
+			if err := json.Unmarshal(contents, &sidecar); err != nil {
+				log.Printf("Could not parse sidecar %s: %v", path, err)
+				return nil
+			}
+
+			schemaPath, err := filepath.Rel(backupPath, filepath.Join(filepath.Dir(path), sidecar.SchemaFile))
+			check(err)
+			manifest.Schemas = append(manifest.Schemas, ManifestEntry{
+				Subject:     sidecar.Subject,
+				Version:     sidecar.Version,
+				Id:          sidecar.Id,
+				SType:       sidecar.SType,
+				References:  sidecar.References,
+				SoftDeleted: sidecar.SoftDeleted,
+				Path:        filepath.ToSlash(schemaPath),
+			})
+			return nil
+		})
+	check(err)
+
+	if len(manifest.Schemas) == 0 {
+		return nil, false
+	}
+	manifest.Schemas = sortedManifestEntries(manifest.entriesBySubjectVersion())
+	return &manifest, true
+}
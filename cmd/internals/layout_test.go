@@ -0,0 +1,63 @@
+package client
+
+//
+// layout_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackLayout(t *testing.T) {
+	t.Run("TParseBackupLayout", func(t *testing.T) { TParseBackupLayout(t) })
+	t.Run("TSubjectLayoutRoundTrip", func(t *testing.T) { TSubjectLayoutRoundTrip(t) })
+}
+
+func TParseBackupLayout(t *testing.T) {
+	layout, err := ParseBackupLayout("subject")
+	assert.Nil(t, err)
+	assert.Equal(t, SUBJECT, layout)
+
+	layout, err = ParseBackupLayout("")
+	assert.Nil(t, err)
+	assert.Equal(t, FLAT, layout)
+
+	_, err = ParseBackupLayout("NESTED")
+	assert.NotNil(t, err)
+}
+
+func TSubjectLayoutRoundTrip(t *testing.T) {
+	backupDir := t.TempDir()
+	record := SchemaRecord{Subject: testingSubject, Schema: mockSchema, SType: "AVRO", Version: 3, Id: 10003}
+
+	BackupLayoutName = SUBJECT.String()
+	defer func() { BackupLayoutName = "" }()
+	schemaPath := writeSchemaFile(backupDir, record, true)
+
+	assert.Equal(t, filepath.Join(backupDir, testingSubject, "v3.avsc"), schemaPath)
+	assert.True(t, fileExists(filepath.Join(backupDir, testingSubject, "v3.meta.json")))
+	contents, err := os.ReadFile(schemaPath)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(contents), "\n  \"type\": \"record\","))
+
+	manifest, hasManifest := sidecarManifest(backupDir)
+	assert.True(t, hasManifest)
+	assert.Equal(t, 1, len(manifest.Schemas))
+	assert.Equal(t, testingSubject+"/v3.avsc", manifest.Schemas[0].Path)
+	assert.True(t, manifest.Schemas[0].SoftDeleted)
+
+	restored, err := manifest.Schemas[0].readRecord(backupDir)
+	assert.Nil(t, err)
+	assert.Equal(t, record.setReferenceIfEmpty(), restored)
+
+	// The backup is read through its sidecars when it has no manifest
+	readBack, hasManifest := readBackupManifest(backupDir, "")
+	assert.True(t, hasManifest)
+	assert.Equal(t, manifest, readBack)
+}
@@ -0,0 +1,516 @@
+package client
+
+//
+// lint.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+-lint runs rules over the latest version of every AVRO subject of a registry, a local backup, or the path of a
+schema load. Every rule has a severity, error, warning or off, and rules with settings take them from the file
+given with -lintRules, a JSON object of rule name -> settings merged over the defaults:
+	record-doc       records have a doc
+	field-doc        fields have a doc
+	namespace        named types have a namespace matching pattern
+	forbidden-types  types, complex kinds (map, fixed...) or logical types listed in types are not used
+	enum-default     enums have a default, so readers can read symbols added later
+	field-case       field names follow case: camelCase, snake_case or PascalCase
+	max-nesting      records, arrays and maps are not nested deeper than max
+Protobuf and JSON schemas are not linted.
+*/
+
+// Settings of a lint rule, only the rules needing them use pattern, types, case and max
+type LintRuleConfig struct {
+	Severity string   `json:"severity,omitempty"`
+	Pattern  string   `json:"pattern,omitempty"`
+	Types    []string `json:"types,omitempty"`
+	Case     string   `json:"case,omitempty"`
+	Max      int      `json:"max,omitempty"`
+}
+
+// Lint rule name -> settings
+type LintRules map[string]LintRuleConfig
+
+const (
+	LINT_ERROR   = "error"
+	LINT_WARNING = "warning"
+	LINT_OFF     = "off"
+)
+
+var lintRuleDescriptions = map[string]string{
+	"record-doc":      "Records have a doc",
+	"field-doc":       "Fields have a doc",
+	"namespace":       "Named types have a namespace following the naming convention",
+	"forbidden-types": "Forbidden types are not used",
+	"enum-default":    "Enums have a default",
+	"field-case":      "Field names follow the naming case",
+	"max-nesting":     "Records, arrays and maps are not nested too deep",
+}
+
+func defaultLintRules() LintRules {
+	return LintRules{
+		"record-doc":      {Severity: LINT_WARNING},
+		"field-doc":       {Severity: LINT_WARNING},
+		"namespace":       {Severity: LINT_ERROR, Pattern: `^[a-z][a-z0-9_]*(\.[a-z][a-z0-9_]*)*$`},
+		"forbidden-types": {Severity: LINT_ERROR, Types: []string{}},
+		"enum-default":    {Severity: LINT_ERROR},
+		"field-case":      {Severity: LINT_WARNING, Case: "camelCase"},
+		"max-nesting":     {Severity: LINT_WARNING, Max: 5},
+	}
+}
+
+var lintFieldCases = map[string]*regexp.Regexp{
+	"camelCase":  regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`),
+	"snake_case": regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`),
+	"PascalCase": regexp.MustCompile(`^[A-Z][a-zA-Z0-9]*$`),
+}
+
+// Returns the default rules, with the settings of the given rules file merged over them
+func ReadLintRules(rulesPath string) (LintRules, error) {
+	rules := defaultLintRules()
+	if rulesPath == "" {
+		return rules, nil
+	}
+
+	contents, err := ioutil.ReadFile(rulesPath)
+	if err != nil {
+		return nil, err
+	}
+	configured := LintRules{}
+	if err := json.Unmarshal(contents, &configured); err != nil {
+		return nil, fmt.Errorf("%s: %w", rulesPath, describeJsonError(contents, err))
+	}
+
+	for name, config := range configured {
+		rule, known := rules[name]
+		if !known {
+			return nil, fmt.Errorf("%s: unknown lint rule %s", rulesPath, name)
+		}
+		if config.Severity != "" {
+			rule.Severity = strings.ToLower(config.Severity)
+		}
+		if config.Pattern != "" {
+			rule.Pattern = config.Pattern
+		}
+		if config.Types != nil {
+			rule.Types = config.Types
+		}
+		if config.Case != "" {
+			rule.Case = config.Case
+		}
+		if config.Max != 0 {
+			rule.Max = config.Max
+		}
+		rules[name] = rule
+	}
+
+	for name, rule := range rules {
+		if rule.Severity != LINT_ERROR && rule.Severity != LINT_WARNING && rule.Severity != LINT_OFF {
+			return nil, fmt.Errorf("%s: the severity of %s must be one of error, warning or off", rulesPath, name)
+		}
+	}
+	if _, err := regexp.Compile(rules["namespace"].Pattern); err != nil {
+		return nil, fmt.Errorf("%s: invalid namespace pattern: %w", rulesPath, err)
+	}
+	if _, known := lintFieldCases[rules["field-case"].Case]; !known {
+		return nil, fmt.Errorf("%s: the case of field-case must be one of camelCase, snake_case or PascalCase", rulesPath)
+	}
+	return rules, nil
+}
+
+// A rule broken by a schema
+type LintFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Pointer  string `json:"pointer"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message"`
+}
+
+// The findings of the latest version of one subject
+type SubjectLint struct {
+	Subject  string        `json:"subject"`
+	Version  int64         `json:"version,omitempty"`
+	File     string        `json:"file,omitempty"`
+	Findings []LintFinding `json:"findings"`
+}
+
+// The result of linting the subjects of a source
+type LintReport struct {
+	Source   string        `json:"source"`
+	Subjects []SubjectLint `json:"subjects"`
+}
+
+// Returns the number of findings of the report with the given severity
+func (lr LintReport) Count(severity string) int {
+	count := 0
+	for _, subject := range lr.Subjects {
+		for _, finding := range subject.Findings {
+			if finding.Severity == severity {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Lints the latest version of every AVRO subject of the given source: with a schema load type, the schemas of the
+// given path, read like the schema load reads them, otherwise a spec as accepted by openSchemaSnapshot
+func RunLint(sourceSpec string, schemaLoadType string, workingDirectory string, rules LintRules) LintReport {
+	listenForInterruption()
+
+	var report LintReport
+	if schemaLoadType != "" {
+		report = lintSchemaLoad(NewSchemaLoader(schemaLoadType, nil, sourceSpec, workingDirectory), rules)
+	} else {
+		report = lintSnapshot(openSchemaSnapshot(sourceSpec, workingDirectory), rules)
+	}
+
+	sort.Slice(report.Subjects, func(i, j int) bool { return report.Subjects[i].Subject < report.Subjects[j].Subject })
+	return report
+}
+
+func lintSnapshot(snapshot *schemaSnapshot, rules LintRules) LintReport {
+	log.Printf("Linting the subjects of %s", snapshot.name)
+	report := LintReport{Source: snapshot.name, Subjects: []SubjectLint{}}
+	for subject, versions := range snapshot.subjects {
+		if CancelRun == true {
+			break
+		}
+		if len(versions) == 0 {
+			continue
+		}
+		latest := versions[0]
+		for _, version := range versions {
+			if version > latest {
+				latest = version
+			}
+		}
+
+		record := snapshot.getSchema(subject, latest).setTypeIfEmpty()
+		if record.SType != AVRO.String() {
+			log.Printf("Not linting %s, only AVRO schemas are linted", subject)
+			continue
+		}
+		var schema interface{}
+		if err := json.Unmarshal([]byte(record.Schema), &schema); err != nil {
+			log.Printf("Could not lint %s: %v", subject, err)
+			continue
+		}
+		report.Subjects = append(report.Subjects, SubjectLint{Subject: subject, Version: latest, Findings: lintAvroSchema(schema, rules)})
+	}
+	return report
+}
+
+func lintSchemaLoad(loader *SchemaLoader, rules LintRules) LintReport {
+	log.Printf("Linting the schemas of %s", loader.path)
+	report := LintReport{Source: loader.path, Subjects: []SubjectLint{}}
+	if loader.schemasType != AVRO {
+		log.Printf("Not linting the schemas of %s, only AVRO schemas are linted", loader.path)
+		return report
+	}
+
+	loader.loadFromPath()
+	for desc, versions := range loader.schemaRecords {
+		if loader.inlineTypes[desc] || len(versions) == 0 {
+			continue
+		}
+		latest := int64(len(versions) - 1)
+		file := loader.schemaFiles[desc][latest]
+		subject := fullNameOf(desc)
+		if subjects := loader.namer.subjectsFor(subject); len(subjects) != 0 {
+			subject = subjects[0]
+		}
+
+		findings := lintAvroSchema(versions[latest], rules)
+		// Schema files hold a single schema, whose pointers are the ones of the file
+		if filepath.Ext(file) == ".avsc" || filepath.Ext(file) == ".json" {
+			if contents, err := ioutil.ReadFile(file); err == nil {
+				for i := range findings {
+					findings[i].Line = jsonLineOf(contents, strings.TrimPrefix(findings[i].Pointer, "#"))
+				}
+			}
+		}
+		report.Subjects = append(report.Subjects, SubjectLint{Subject: subject, File: file, Findings: findings})
+	}
+	return report
+}
+
+// Applies the given rules to an AVRO schema
+type avroLinter struct {
+	rules    LintRules
+	findings []LintFinding
+}
+
+// Returns the findings of the given rules over the given AVRO schema, in order of appearance
+func lintAvroSchema(schema interface{}, rules LintRules) []LintFinding {
+	linter := &avroLinter{rules: rules, findings: []LintFinding{}}
+	linter.lint(schema, "", "", 0)
+	return linter.findings
+}
+
+func (al *avroLinter) report(rule string, pointer string, format string, args ...interface{}) {
+	severity := al.rules[rule].Severity
+	if severity == LINT_OFF || severity == "" {
+		return
+	}
+	al.findings = append(al.findings, LintFinding{Rule: rule, Severity: severity, Pointer: "#" + pointer, Message: fmt.Sprintf(format, args...)})
+}
+
+// Lints the given schema, used within the given namespace, nested in depth records, arrays and maps
+func (al *avroLinter) lint(schema interface{}, pointer string, namespace string, depth int) {
+	switch typed := schema.(type) {
+	case string:
+		al.checkForbidden(typed, pointer)
+	case []interface{}:
+		al.checkForbidden("union", pointer)
+		for i, member := range typed {
+			al.lint(member, fmt.Sprintf("%s/%d", pointer, i), namespace, depth)
+		}
+	case map[string]interface{}:
+		kind, _ := typed["type"].(string)
+		if logicalType, hasLogicalType := typed["logicalType"].(string); hasLogicalType {
+			al.checkForbidden(logicalType, pointer+"/logicalType")
+		}
+
+		switch kind {
+		case "record", "error", "array", "map":
+			depth++
+			if maxDepth := al.rules["max-nesting"].Max; maxDepth > 0 && depth == maxDepth+1 {
+				al.report("max-nesting", pointer, "the %s is nested %d levels deep, more than %d", kind, depth, maxDepth)
+			}
+		}
+
+		switch kind {
+		case "record", "error", "enum", "fixed":
+			al.checkForbidden(kind, pointer)
+			namespace = avroNamespaceOf(typed, namespace)
+			name, _ := typed["name"].(string)
+			// Namespaces are checked where declared, nested types inheriting them
+			_, declaresNamespace := typed["namespace"]
+			if pointer == "" || declaresNamespace || strings.Contains(name, ".") {
+				al.checkNamespace(avroFullName(name, namespace), namespace, pointer)
+			}
+			if kind == "enum" {
+				if _, hasDefault := typed["default"]; !hasDefault {
+					al.report("enum-default", pointer, "enum %s has no default", avroFullName(name, namespace))
+				}
+			}
+			if kind == "record" || kind == "error" {
+				if !hasLintDoc(typed) {
+					al.report("record-doc", pointer, "record %s has no doc", avroFullName(name, namespace))
+				}
+				fields, _ := typed["fields"].([]interface{})
+				for i, field := range fields {
+					if fieldMap, isMap := field.(map[string]interface{}); isMap {
+						al.lintField(fieldMap, fmt.Sprintf("%s/fields/%d", pointer, i), namespace, depth)
+					}
+				}
+			}
+		case "array":
+			al.checkForbidden(kind, pointer)
+			al.lint(typed["items"], pointer+"/items", namespace, depth)
+		case "map":
+			al.checkForbidden(kind, pointer)
+			al.lint(typed["values"], pointer+"/values", namespace, depth)
+		default:
+			// A primitive type with attributes, or a name given as {"type": "com.mycorp.Name"}
+			al.lint(typed["type"], pointer+"/type", namespace, depth)
+		}
+	}
+}
+
+func (al *avroLinter) lintField(field map[string]interface{}, pointer string, namespace string, depth int) {
+	name, _ := field["name"].(string)
+	if !hasLintDoc(field) {
+		al.report("field-doc", pointer, "field %s has no doc", name)
+	}
+	fieldCase := al.rules["field-case"].Case
+	if pattern, known := lintFieldCases[fieldCase]; known && !pattern.MatchString(name) {
+		al.report("field-case", pointer+"/name", "field %s is not %s", name, fieldCase)
+	}
+	al.lint(field["type"], pointer+"/type", namespace, depth)
+}
+
+func (al *avroLinter) checkNamespace(fullName string, namespace string, pointer string) {
+	if namespace == "" {
+		al.report("namespace", pointer, "%s has no namespace", fullName)
+		return
+	}
+	if pattern, err := regexp.Compile(al.rules["namespace"].Pattern); err == nil && !pattern.MatchString(namespace) {
+		al.report("namespace", pointer, "the namespace %s of %s does not match %s", namespace, fullName, al.rules["namespace"].Pattern)
+	}
+}
+
+func (al *avroLinter) checkForbidden(typeName string, pointer string) {
+	if stringIsInSlice(typeName, al.rules["forbidden-types"].Types) {
+		al.report("forbidden-types", pointer, "the %s type is forbidden", typeName)
+	}
+}
+
+func hasLintDoc(definition map[string]interface{}) bool {
+	doc, isString := definition["doc"].(string)
+	return isString && strings.TrimSpace(doc) != ""
+}
+
+// Writes the lint report in the given format: TEXT, JSON or SARIF
+func WriteLintReport(report LintReport, format string, out io.Writer) error {
+	switch strings.ToUpper(format) {
+	case "", "TEXT":
+		return writeLintText(report, out)
+	case "JSON":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case "SARIF":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(lintSarif(report))
+	}
+	return fmt.Errorf("unknown report format %s, expected one of TEXT, JSON or SARIF", format)
+}
+
+func writeLintText(report LintReport, out io.Writer) error {
+	for _, subject := range report.Subjects {
+		if len(subject.Findings) == 0 {
+			continue
+		}
+		location := subject.File
+		if location == "" {
+			location = fmt.Sprintf("version %d", subject.Version)
+		}
+		if _, err := fmt.Fprintf(out, "%s (%s)\n", subject.Subject, location); err != nil {
+			return err
+		}
+		for _, finding := range subject.Findings {
+			position := finding.Pointer
+			if finding.Line != 0 {
+				position = fmt.Sprintf("line %d %s", finding.Line, finding.Pointer)
+			}
+			if _, err := fmt.Fprintf(out, "  %s %s: %s [%s]\n", strings.ToUpper(finding.Severity), position, finding.Message, finding.Rule); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintf(out, "Linted %d subjects of %s: %d errors, %d warnings\n",
+		len(report.Subjects), report.Source, report.Count(LINT_ERROR), report.Count(LINT_WARNING))
+	return err
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationUri string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	Id               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleId    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	Uri string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+// Returns the report as a SARIF 2.1.0 log, files given relative to the linted path
+func lintSarif(report LintReport) sarifLog {
+	rules := []sarifRule{}
+	for name, description := range lintRuleDescriptions {
+		rules = append(rules, sarifRule{Id: name, ShortDescription: sarifMessage{Text: description}})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Id < rules[j].Id })
+
+	results := []sarifResult{}
+	for _, subject := range report.Subjects {
+		for _, finding := range subject.Findings {
+			location := sarifLocation{LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: subject.Subject + finding.Pointer}}}
+			if subject.File != "" {
+				uri := subject.File
+				if relativePath, err := filepath.Rel(report.Source, subject.File); err == nil {
+					uri = filepath.ToSlash(relativePath)
+				}
+				location.PhysicalLocation = &sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{Uri: uri}}
+				if finding.Line != 0 {
+					location.PhysicalLocation.Region = &sarifRegion{StartLine: finding.Line}
+				}
+			}
+			results = append(results, sarifResult{
+				RuleId:    finding.Rule,
+				Level:     finding.Severity,
+				Message:   sarifMessage{Text: finding.Message},
+				Locations: []sarifLocation{location},
+			})
+		}
+	}
+
+	return sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "ccloud-schema-exporter",
+				Version:        Version,
+				InformationUri: "https://github.com/abraham-leal/ccloud-schema-exporter",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+}
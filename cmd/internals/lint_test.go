@@ -0,0 +1,165 @@
+package client
+
+//
+// lint_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackLint(t *testing.T) {
+	t.Run("TReadLintRules", func(t *testing.T) { TReadLintRules(t) })
+	t.Run("TLintAvroSchema", func(t *testing.T) { TLintAvroSchema(t) })
+	t.Run("TLintSchemaLoad", func(t *testing.T) { TLintSchemaLoad(t) })
+	t.Run("TLintBackup", func(t *testing.T) { TLintBackup(t) })
+	t.Run("TWriteLintReport", func(t *testing.T) { TWriteLintReport(t) })
+}
+
+const lintedSchema = `{
+  "type": "record",
+  "name": "Order",
+  "namespace": "com.Acme",
+  "fields": [
+    {"name": "order_id", "type": "string", "doc": "Identifier"},
+    {"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["OPEN"]}},
+    {"name": "lines", "doc": "Lines", "type": {"type": "array", "items": {"type": "record", "name": "Line", "namespace": "com.acme", "doc": "A line", "fields": [
+      {"name": "attributes", "doc": "Attributes", "type": {"type": "map", "values": "bytes"}}
+    ]}}}
+  ]
+}`
+
+func TReadLintRules(t *testing.T) {
+	rules, err := ReadLintRules("")
+	assert.Nil(t, err)
+	assert.Equal(t, defaultLintRules(), rules)
+
+	rulesDir := t.TempDir()
+	writeWatchedFile(t, rulesDir, "rules.json", `{"field-doc": {"severity": "ERROR"}, "forbidden-types": {"types": ["bytes"]}, "field-case": {"case": "snake_case"}}`)
+	rules, err = ReadLintRules(filepath.Join(rulesDir, "rules.json"))
+	assert.Nil(t, err)
+	assert.Equal(t, LintRuleConfig{Severity: LINT_ERROR}, rules["field-doc"])
+	assert.Equal(t, LintRuleConfig{Severity: LINT_ERROR, Types: []string{"bytes"}}, rules["forbidden-types"])
+	assert.Equal(t, LintRuleConfig{Severity: LINT_WARNING, Case: "snake_case"}, rules["field-case"])
+	assert.Equal(t, defaultLintRules()["namespace"], rules["namespace"])
+
+	for contents, expected := range map[string]string{
+		`{"record-docs": {}}`:                     "unknown lint rule record-docs",
+		`{"record-doc": {"severity": "fatal"}}`:   "the severity of record-doc must be one of error, warning or off",
+		`{"field-case": {"case": "kebab-case"}}`:  "the case of field-case must be one of camelCase, snake_case or PascalCase",
+		`{"namespace": {"pattern": "^com\\.(("}}`: "invalid namespace pattern",
+		"{\n\"record-doc\": {]\n}":                "line 2",
+	} {
+		writeWatchedFile(t, rulesDir, "invalid.json", contents)
+		_, err = ReadLintRules(filepath.Join(rulesDir, "invalid.json"))
+		assert.Contains(t, err.Error(), expected)
+	}
+}
+
+func TLintAvroSchema(t *testing.T) {
+	rules := defaultLintRules()
+	rules["forbidden-types"] = LintRuleConfig{Severity: LINT_ERROR, Types: []string{"bytes", "map"}}
+	rules["max-nesting"] = LintRuleConfig{Severity: LINT_WARNING, Max: 2}
+
+	assert.Equal(t, []LintFinding{
+		{Rule: "namespace", Severity: LINT_ERROR, Pointer: "#", Message: "the namespace com.Acme of com.Acme.Order does not match ^[a-z][a-z0-9_]*(\\.[a-z][a-z0-9_]*)*$"},
+		{Rule: "record-doc", Severity: LINT_WARNING, Pointer: "#", Message: "record com.Acme.Order has no doc"},
+		{Rule: "field-case", Severity: LINT_WARNING, Pointer: "#/fields/0/name", Message: "field order_id is not camelCase"},
+		{Rule: "field-doc", Severity: LINT_WARNING, Pointer: "#/fields/1", Message: "field status has no doc"},
+		{Rule: "enum-default", Severity: LINT_ERROR, Pointer: "#/fields/1/type", Message: "enum com.Acme.Status has no default"},
+		{Rule: "max-nesting", Severity: LINT_WARNING, Pointer: "#/fields/2/type/items", Message: "the record is nested 3 levels deep, more than 2"},
+		{Rule: "forbidden-types", Severity: LINT_ERROR, Pointer: "#/fields/2/type/items/fields/0/type", Message: "the map type is forbidden"},
+		{Rule: "forbidden-types", Severity: LINT_ERROR, Pointer: "#/fields/2/type/items/fields/0/type/values", Message: "the bytes type is forbidden"},
+	}, lintAvroSchema(avroSchemaOf(t, lintedSchema), rules))
+
+	// Rules turned off report nothing
+	for name := range rules {
+		rules[name] = LintRuleConfig{Severity: LINT_OFF, Types: rules[name].Types, Case: rules[name].Case, Max: rules[name].Max}
+	}
+	assert.Equal(t, []LintFinding{}, lintAvroSchema(avroSchemaOf(t, lintedSchema), rules))
+
+	// Schemas without a namespace, and logical types
+	rules = defaultLintRules()
+	rules["forbidden-types"] = LintRuleConfig{Severity: LINT_ERROR, Types: []string{"timestamp-millis"}}
+	assert.Equal(t, []LintFinding{
+		{Rule: "namespace", Severity: LINT_ERROR, Pointer: "#", Message: "Event has no namespace"},
+		{Rule: "forbidden-types", Severity: LINT_ERROR, Pointer: "#/fields/0/type/logicalType", Message: "the timestamp-millis type is forbidden"},
+	}, lintAvroSchema(avroSchemaOf(t, `{"type":"record","name":"Event","doc":"An event","fields":[
+		{"name":"at","doc":"Time","type":{"type":"long","logicalType":"timestamp-millis"}}]}`), rules))
+}
+
+func TLintSchemaLoad(t *testing.T) {
+	schemaDir := t.TempDir()
+	writeWatchedFile(t, schemaDir, "order.avsc", lintedSchema)
+	writeWatchedFile(t, schemaDir, "clean.avsc", `{"type":"record","name":"Clean","namespace":"com.acme","doc":"Clean","fields":[]}`)
+
+	report := RunLint(schemaDir, AVRO.String(), "", defaultLintRules())
+	assert.Equal(t, schemaDir, report.Source)
+	assert.Equal(t, 2, len(report.Subjects))
+	assert.Equal(t, SubjectLint{Subject: "com.acme.Clean-value", File: filepath.Join(schemaDir, "clean.avsc"), Findings: []LintFinding{}},
+		report.Subjects[1])
+
+	order := report.Subjects[0]
+	assert.Equal(t, "com.Acme.Order-value", order.Subject)
+	assert.Equal(t, []int{1, 1, 6, 7, 7}, []int{order.Findings[0].Line, order.Findings[1].Line, order.Findings[2].Line,
+		order.Findings[3].Line, order.Findings[4].Line})
+	assert.Equal(t, 2, report.Count(LINT_ERROR))
+	assert.Equal(t, 3, report.Count(LINT_WARNING))
+
+	// Only AVRO schemas are linted
+	assert.Equal(t, 0, len(RunLint(schemaDir, PROTOBUF.String(), "", defaultLintRules()).Subjects))
+}
+
+func TLintBackup(t *testing.T) {
+	backupDir := t.TempDir()
+	writeBackupFile(t, backupDir, "orders-1-10001-AVRO", `{"type":"record","name":"Order","namespace":"com.acme","fields":[]}`)
+	writeBackupFile(t, backupDir, "orders-2-10002-AVRO", `{"type":"record","name":"Order","namespace":"com.acme","doc":"Orders","fields":[]}`)
+	writeBackupFile(t, backupDir, "proto-1-10003-PROTOBUF", `syntax = "proto3";`)
+
+	report := RunLint(backupDir, "", "", defaultLintRules())
+	assert.Equal(t, []SubjectLint{{Subject: "orders", Version: 2, Findings: []LintFinding{}}}, report.Subjects)
+}
+
+func TWriteLintReport(t *testing.T) {
+	report := LintReport{Source: "/schemas", Subjects: []SubjectLint{
+		{Subject: "orders-value", File: "/schemas/orders/order.avsc", Findings: []LintFinding{
+			{Rule: "enum-default", Severity: LINT_ERROR, Pointer: "#/fields/1/type", Line: 7, Message: "enum Status has no default"},
+		}},
+		{Subject: "payments-value", Version: 3, Findings: []LintFinding{
+			{Rule: "record-doc", Severity: LINT_WARNING, Pointer: "#", Message: "record Payment has no doc"},
+		}},
+		{Subject: "clean-value", Version: 1, Findings: []LintFinding{}},
+	}}
+
+	var text bytes.Buffer
+	assert.Nil(t, WriteLintReport(report, "TEXT", &text))
+	assert.Equal(t, "orders-value (/schemas/orders/order.avsc)\n"+
+		"  ERROR line 7 #/fields/1/type: enum Status has no default [enum-default]\n"+
+		"payments-value (version 3)\n"+
+		"  WARNING #: record Payment has no doc [record-doc]\n"+
+		"Linted 3 subjects of /schemas: 1 errors, 1 warnings\n", text.String())
+
+	var sarif bytes.Buffer
+	assert.Nil(t, WriteLintReport(report, "sarif", &sarif))
+	decoded := sarifLog{}
+	assert.Nil(t, json.Unmarshal(sarif.Bytes(), &decoded))
+	assert.Equal(t, "2.1.0", decoded.Version)
+	assert.Equal(t, len(lintRuleDescriptions), len(decoded.Runs[0].Tool.Driver.Rules))
+	assert.Equal(t, []sarifResult{
+		{RuleId: "enum-default", Level: "error", Message: sarifMessage{Text: "enum Status has no default"}, Locations: []sarifLocation{{
+			PhysicalLocation: &sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{Uri: "orders/order.avsc"}, Region: &sarifRegion{StartLine: 7}},
+			LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: "orders-value#/fields/1/type"}},
+		}}},
+		{RuleId: "record-doc", Level: "warning", Message: sarifMessage{Text: "record Payment has no doc"}, Locations: []sarifLocation{{
+			LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: "payments-value#"}},
+		}}},
+	}, decoded.Runs[0].Results)
+
+	assert.NotNil(t, WriteLintReport(report, "JUNIT", &text))
+}
@@ -0,0 +1,198 @@
+package client
+
+//
+// localFSCustom.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+/*
+FSDestination and FSSource expose a local backup directory, in the same files, layout and manifest as
+getLocalCopy, through the CustomDestination and CustomSource interfaces. This allows continuous sync
+to a directory, mirroring deletes with -syncDeletes, and continuous sync from a directory into a registry.
+Both default to -localPath, or to the SchemaRegistryBackup folder of the current path.
+*/
+
+type FSDestination struct {
+	Path     string
+	manifest *manifestBuilder
+	changed  bool
+}
+
+func NewFSDestination() FSDestination {
+	return FSDestination{}
+}
+
+// Opens the backup directory, creating it if needed, and loads the schemas it already holds
+func (fd *FSDestination) SetUp() error {
+	backupPath, err := resolveBackupDirectory(fd.Path)
+	if err != nil {
+		return err
+	}
+	fd.Path = backupPath
+	if err := os.MkdirAll(fd.Path, 0755); err != nil {
+		return err
+	}
+	if hasSnapshots(fd.Path) {
+		return fmt.Errorf("%s holds an incremental backup, which can only be written with -getLocalCopy -incremental", fd.Path)
+	}
+	log.Println("Starting filesystem destination at " + fd.Path)
+
+	fd.manifest = newManifestBuilder(SrcSRUrl)
+	existing, hasManifest := readBackupManifest(fd.Path, "")
+	if !hasManifest {
+		existing = legacyManifest(fd.Path)
+	}
+	fd.manifest.manifest.Schemas = existing.Schemas
+	fd.manifest.manifest.Config = existing.Config
+	fd.changed = false
+	return nil
+}
+
+func (fd *FSDestination) RegisterSchema(record SchemaRecord) error {
+	if entry, exists := fd.manifest.remove(record.Subject, record.Version); exists {
+		removeBackupFile(fd.Path, entry.Path)
+	}
+	schemaPath := writeSchemaFile(fd.Path, record, false)
+	fd.manifest.add(record, false, fd.Path, schemaPath)
+	fd.changed = true
+	return nil
+}
+
+func (fd *FSDestination) DeleteSchema(subject string, version int64) error {
+	entry, exists := fd.manifest.remove(subject, version)
+	if !exists {
+		return fmt.Errorf("subject %s with version %d is not in %s", subject, version, fd.Path)
+	}
+	removeBackupFile(fd.Path, entry.Path)
+	fd.changed = true
+	return nil
+}
+
+// Returns the subject versions held by the directory
+func (fd *FSDestination) GetDestinationState() (map[string][]int64, error) {
+	fd.manifest.lock.Lock()
+	defer fd.manifest.lock.Unlock()
+	return stateOfEntries(fd.manifest.manifest.Schemas), nil
+}
+
+// Writes the manifest if any schema changed since it was last written
+func (fd *FSDestination) CommitChanges() error {
+	if !fd.changed {
+		return nil
+	}
+	fd.manifest.write(fd.Path)
+	fd.changed = false
+	log.Printf("Wrote manifest with %d schemas to %s", len(fd.manifest.manifest.Schemas), fd.Path)
+	return nil
+}
+
+func (fd *FSDestination) TearDown() error {
+	return fd.CommitChanges()
+}
+
+/*
+FSSource is a CustomSource reading a backup directory. The backup is read again on every sync run,
+through its manifest, latest incremental snapshot (or -restoreAt), sidecars or file names.
+*/
+
+type FSSource struct {
+	Path    string
+	entries map[SubjectVersion]ManifestEntry
+}
+
+func NewFSSource() FSSource {
+	return FSSource{}
+}
+
+func (fs *FSSource) SetUp() error {
+	backupPath, err := resolveBackupDirectory(fs.Path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(backupPath); err != nil {
+		return err
+	}
+	fs.Path = backupPath
+	log.Println("Starting filesystem source at " + fs.Path)
+	return fs.refresh()
+}
+
+// Reads the backup again, as it may have changed since the last read
+func (fs *FSSource) refresh() error {
+	manifest, hasManifest := readBackupManifest(fs.Path, RestoreAt)
+	if !hasManifest {
+		manifest = legacyManifest(fs.Path)
+	}
+	fs.entries = manifest.entriesBySubjectVersion()
+	return nil
+}
+
+func (fs *FSSource) GetSchema(subject string, version int64) (id int64, stype string, schema string, references []SchemaReference, err error) {
+	entry, exists := fs.entries[SubjectVersion{Subject: subject, Version: version}]
+	if !exists {
+		return 0, "", "", nil, fmt.Errorf("subject %s with version %d is not in %s", subject, version, fs.Path)
+	}
+	record, err := entry.readRecord(fs.Path)
+	if err != nil {
+		return 0, "", "", nil, err
+	}
+	return record.Id, record.SType, record.Schema, record.References, nil
+}
+
+func (fs *FSSource) GetSourceState() (map[string][]int64, error) {
+	if err := fs.refresh(); err != nil {
+		return nil, err
+	}
+	return stateOfEntries(sortedManifestEntries(fs.entries)), nil
+}
+
+func (fs *FSSource) TearDown() error {
+	return nil
+}
+
+// Returns the absolute path of the given backup directory, defaulting to -localPath
+func resolveBackupDirectory(backupPath string) (string, error) {
+	if backupPath == "" {
+		backupPath = PathToWrite
+		if backupPath == "" {
+			backupPath = "SchemaRegistryBackup"
+		}
+	}
+	if filepath.IsAbs(backupPath) {
+		return backupPath, nil
+	}
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(workingDirectory, backupPath), nil
+}
+
+// Returns a manifest built from the file names of a backup written before manifests existed
+func legacyManifest(backupPath string) *BackupManifest {
+	manifest := BackupManifest{Schemas: []ManifestEntry{}}
+	err := walkBackupFiles(backupPath, func(relativePath string, fullPath string, info os.FileInfo) error {
+		if skipBackupFile(fullPath, info) {
+			return nil
+		}
+		record := readLocalSchemaFile(fullPath)
+		manifest.Schemas = append(manifest.Schemas, ManifestEntry{
+			Subject:    record.Subject,
+			Version:    record.Version,
+			Id:         record.Id,
+			SType:      record.SType,
+			References: record.References,
+			Path:       relativePath,
+		})
+		return nil
+	})
+	check(err)
+	return &manifest
+}
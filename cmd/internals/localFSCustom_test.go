@@ -0,0 +1,93 @@
+package client
+
+//
+// localFSCustom_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackLocalFS(t *testing.T) {
+	t.Run("TFSDestinationMirrorsDeletes", func(t *testing.T) { TFSDestinationMirrorsDeletes(t) })
+	t.Run("TFSSourceReadsLegacyBackup", func(t *testing.T) { TFSSourceReadsLegacyBackup(t) })
+	t.Run("TFSFiltersSubjects", func(t *testing.T) { TFSFiltersSubjects(t) })
+}
+
+func TFSDestinationMirrorsDeletes(t *testing.T) {
+	BackupLayoutName = SUBJECT.String()
+	defer func() { BackupLayoutName = "" }()
+
+	fsDest := FSDestination{Path: t.TempDir()}
+	assert.Nil(t, fsDest.SetUp())
+	assert.Nil(t, fsDest.RegisterSchema(SchemaRecord{Subject: testingSubject, Schema: mockSchema, SType: "AVRO", Version: 1, Id: 10001}))
+	assert.Nil(t, fsDest.RegisterSchema(SchemaRecord{Subject: "other-key", Schema: mockSchema, SType: "AVRO", Version: 1, Id: 10002}))
+	assert.Nil(t, fsDest.CommitChanges())
+
+	assert.Nil(t, fsDest.DeleteSchema("other-key", 1))
+	assert.NotNil(t, fsDest.DeleteSchema("other-key", 1))
+	assert.Nil(t, fsDest.TearDown())
+
+	assert.True(t, fileExists(filepath.Join(fsDest.Path, testingSubject, "v1.avsc")))
+	assert.False(t, fileExists(filepath.Join(fsDest.Path, "other-key", "v1.avsc")))
+	assert.NoDirExists(t, filepath.Join(fsDest.Path, "other-key"))
+
+	// A new destination on the same directory picks up where the previous one stopped
+	reopened := FSDestination{Path: fsDest.Path}
+	assert.Nil(t, reopened.SetUp())
+	state, err := reopened.GetDestinationState()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]int64{testingSubject: {1}}, state)
+
+	fsSrc := FSSource{Path: fsDest.Path}
+	assert.Nil(t, fsSrc.SetUp())
+	srcState, err := fsSrc.GetSourceState()
+	assert.Nil(t, err)
+	assert.Equal(t, state, srcState)
+
+	id, stype, schema, references, err := fsSrc.GetSchema(testingSubject, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10001), id)
+	assert.Equal(t, "AVRO", stype)
+	assert.Equal(t, mockSchema, schema)
+	assert.Equal(t, []SchemaReference{}, references)
+}
+
+func TFSSourceReadsLegacyBackup(t *testing.T) {
+	backupPath := t.TempDir()
+	reference := SchemaReference{Name: "ref", Subject: "ref-key", Version: 1}
+	writeSchemaFile(backupPath, SchemaRecord{Subject: "ref-key", Schema: mockSchema, SType: "AVRO", Version: 1, Id: 10003}, false)
+	writeSchemaFile(backupPath, SchemaRecord{Subject: testingSubject, Schema: mockSchema, SType: "AVRO", Version: 3, Id: 10004,
+		References: []SchemaReference{reference}}, false)
+
+	fsSrc := FSSource{Path: backupPath}
+	assert.Nil(t, fsSrc.SetUp())
+	state, err := fsSrc.GetSourceState()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]int64{testingSubject: {3}, "ref-key": {1}}, state)
+
+	id, _, schema, references, err := fsSrc.GetSchema(testingSubject, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10004), id)
+	assert.Equal(t, mockSchema, schema)
+	assert.Equal(t, []SchemaReference{reference}, references)
+}
+
+func TFSFiltersSubjects(t *testing.T) {
+	DisallowList = map[string]bool{"other-key": true}
+	defer func() { DisallowList = nil }()
+
+	fsDest := FSDestination{Path: t.TempDir()}
+	assert.Nil(t, fsDest.SetUp())
+	assert.Nil(t, fsDest.RegisterSchema(SchemaRecord{Subject: testingSubject, Schema: mockSchema, SType: "AVRO", Version: 1, Id: 10001}))
+	assert.Nil(t, fsDest.RegisterSchema(SchemaRecord{Subject: "other-key", Schema: mockSchema, SType: "AVRO", Version: 1, Id: 10002}))
+
+	// Disallowed subjects are left alone rather than reported, so they are never mirrored as deletes
+	state, err := fsDest.GetDestinationState()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]int64{testingSubject: {1}}, state)
+}
@@ -7,13 +7,13 @@ package client
 
 import (
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,34 +25,81 @@ func WriteToFS(srcClient *SchemaRegistryClient, definedPath string, workingDirec
 
 	definedPath = CheckPath(definedPath, workingDirectory)
 
+	manifest := newManifestBuilder(srcClient.SRUrl)
+
+	log.Printf("Writing schemas from %s to path %s", srcClient.SRUrl, definedPath)
+	writeRegistryLocally(srcClient, definedPath, manifest)
+
+	manifest.write(definedPath)
+}
+
+// Writes every schema of the source registry, soft deleted ones included, and its configuration to the given path
+func writeRegistryLocally(srcClient *SchemaRegistryClient, pathToWrite string, manifest *manifestBuilder) {
 	srcSubjects := GetCurrentSubjectState(srcClient)
+	softDeleted := srcClient.GetSoftDeletedIDs()
 	var aGroup sync.WaitGroup
 
-	log.Printf("Writing schemas from %s to path %s", srcClient.SRUrl, definedPath)
 	for srcSubject, srcVersions := range srcSubjects {
 		for _, v := range srcVersions {
 			aGroup.Add(1)
-			go writeSchemaLocally(srcClient, definedPath, srcSubject, v, &aGroup)
+			go writeSchemaLocally(srcClient, pathToWrite, srcSubject, v, false, manifest, &aGroup)
 			time.Sleep(time.Duration(1) * time.Millisecond)
 		}
 	}
+
+	softDeletedSubjects := map[string]bool{}
+	for _, subjectVersions := range softDeleted {
+		for srcSubject, srcVersions := range subjectVersions {
+			softDeletedSubjects[srcSubject] = true
+			for _, v := range srcVersions {
+				aGroup.Add(1)
+				go writeSchemaLocally(srcClient, pathToWrite, srcSubject, v, true, manifest, &aGroup)
+				time.Sleep(time.Duration(1) * time.Millisecond)
+			}
+		}
+	}
 	aGroup.Wait()
+
+	subjects := []string{}
+	for srcSubject := range srcSubjects {
+		subjects = append(subjects, srcSubject)
+	}
+	for srcSubject := range softDeletedSubjects {
+		if _, live := srcSubjects[srcSubject]; !live {
+			subjects = append(subjects, srcSubject)
+		}
+	}
+	manifest.setConfig(captureRegistryConfig(srcClient, subjects))
 }
 
 func WriteFromFS(dstClient *SchemaRegistryClient, definedPath string, workingDirectory string) {
 	listenForInterruption()
 
 	definedPath = CheckPath(definedPath, workingDirectory)
+	compatibility, err := newCompatibilityGate(CompatibilityLevelName)
+	checkFail(err, "Could not set up the compatibility checks of the restore")
+	compatibility.withRegistry(dstClient)
 
-	err := filepath.Walk(definedPath,
-		func(path string, info os.FileInfo, err error) error {
-			check(err)
-			if !info.IsDir() {
-				writeSchemaToSR(dstClient, path)
-			}
-			return nil
-		})
-	check(err)
+	manifest, hasManifest := readBackupManifest(definedPath, RestoreAt)
+	if hasManifest {
+		log.Printf("Restoring from the manifest of the backup taken from %s", manifest.SourceUrl)
+		writeFromManifest(dstClient, manifest, definedPath, compatibility)
+	} else {
+		schemaFiles := []string{}
+		err := filepath.Walk(definedPath,
+			func(path string, info os.FileInfo, err error) error {
+				check(err)
+				if !skipBackupFile(path, info) {
+					schemaFiles = append(schemaFiles, path)
+				}
+				return nil
+			})
+		check(err)
+		// Versions are checked against the versions written before them, not against the ones sorting before them
+		for _, schemaFile := range sortedBySubjectVersion(schemaFiles) {
+			writeSchemaToSR(dstClient, schemaFile, compatibility)
+		}
+	}
 
 	if CancelRun != true {
 		log.Println("Destination Schema Registry Restored From Backup")
@@ -61,39 +108,85 @@ func WriteFromFS(dstClient *SchemaRegistryClient, definedPath string, workingDir
 	}
 }
 
-// Writes the provided file to Schema Registry
-func writeSchemaToSR(dstClient *SchemaRegistryClient, filepath string) {
+// Returns the given schema files sorted by the subject and version in their names
+func sortedBySubjectVersion(schemaFiles []string) []string {
+	subjectVersions := map[string]SubjectVersion{}
+	for _, schemaFile := range schemaFiles {
+		_, version, subject, _ := parseFileName(schemaFile)
+		unescapedSubject, err := url.QueryUnescape(subject)
+		if err != nil {
+			unescapedSubject = subject
+		}
+		subjectVersions[schemaFile] = SubjectVersion{Subject: unescapedSubject, Version: version}
+	}
+	sorted := append([]string{}, schemaFiles...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		first, second := subjectVersions[sorted[i]], subjectVersions[sorted[j]]
+		if first.Subject != second.Subject {
+			return first.Subject < second.Subject
+		}
+		return first.Version < second.Version
+	})
+	return sorted
+}
+
+// Writes the provided file to Schema Registry, unless incompatible with the versions of its subject written before
+func writeSchemaToSR(dstClient *SchemaRegistryClient, filepath string, compatibility *compatibilityGate) {
 	if CancelRun == true {
 		return
 	}
+	_, _, subject, _ := parseFileName(filepath)
+	unescapedSubject, err := url.QueryUnescape(subject)
+	checkDontFail(err)
+	if checkSubjectIsAllowed(unescapedSubject) {
+		record := readLocalSchemaFile(filepath)
+		if len(record.References) != 0 {
+			RegisterReferencesFromLocalFS(record.References, dstClient, path.Dir(filepath), compatibility)
+		}
+		if !compatibility.allows(record.Subject, record.Version, record.SType, record.Schema) {
+			return
+		}
+
+		log.Printf("Registering Schema with Subject: %s. Version: %v, and ID: %v", record.Subject, record.Version, record.Id)
+		dstClient.RegisterSchemaBySubjectAndIDAndVersion(record.Schema, record.Subject, record.Id, record.Version, record.SType, record.References)
+	}
+}
+
+// Reads a schema file written by getLocalCopy, metadata is taken from the file name
+// and references from the end of the file
+func readLocalSchemaFile(filepath string) SchemaRecord {
 	id, version, subject, stype := parseFileName(filepath)
-	if checkSubjectIsAllowed(subject) {
-		rawSchema, err := ioutil.ReadFile(filepath)
-		fileString := string(rawSchema)
-		check(err)
+	rawSchema, err := ioutil.ReadFile(filepath)
+	check(err)
+	fileString := string(rawSchema)
 
-		referenceArray := []SchemaReference{}
-
-		if strings.Contains(fileString, ReferenceSeparator) {
-			referenceStart := strings.LastIndex(fileString, ReferenceSeparator) + len(ReferenceSeparator)
-			referenceString := strings.TrimSpace(strings.ReplaceAll(fileString[referenceStart:], "\n", ""))
-			referenceCollection := strings.Split(referenceString, "|")
-			for _, reference := range referenceCollection {
-				if len(reference) != 0 {
-					thisReference := SchemaReference{}
-					err := json.Unmarshal([]byte(reference), &thisReference)
-					check(err)
-					referenceArray = append(referenceArray, thisReference)
-				}
+	referenceArray := []SchemaReference{}
+
+	if strings.Contains(fileString, ReferenceSeparator) {
+		referenceStart := strings.LastIndex(fileString, ReferenceSeparator) + len(ReferenceSeparator)
+		referenceString := strings.TrimSpace(strings.ReplaceAll(fileString[referenceStart:], "\n", ""))
+		referenceCollection := strings.Split(referenceString, "|")
+		for _, reference := range referenceCollection {
+			if len(reference) != 0 {
+				thisReference := SchemaReference{}
+				err := json.Unmarshal([]byte(reference), &thisReference)
+				check(err)
+				referenceArray = append(referenceArray, thisReference)
 			}
-			RegisterReferencesFromLocalFS(referenceArray, dstClient, path.Dir(filepath))
-			fileString = fileString[:strings.LastIndex(fileString, ReferenceSeparator)-1]
 		}
+		fileString = fileString[:strings.LastIndex(fileString, ReferenceSeparator)-1]
+	}
 
-		unescapedSubject, err := url.QueryUnescape(subject)
-		checkDontFail(err)
-		log.Printf("Registering Schema with Subject: %s. Version: %v, and ID: %v", unescapedSubject, version, id)
-		dstClient.RegisterSchemaBySubjectAndIDAndVersion(fileString, unescapedSubject, id, version, stype, referenceArray)
+	unescapedSubject, err := url.QueryUnescape(subject)
+	checkDontFail(err)
+
+	return SchemaRecord{
+		Subject:    unescapedSubject,
+		Schema:     fileString,
+		SType:      stype,
+		Version:    version,
+		Id:         id,
+		References: referenceArray,
 	}
 }
 
@@ -122,8 +215,9 @@ func parseFileName(filepath string) (int64, int64, string, string) {
 }
 
 // Writes the provided schema in the given path
-func writeSchemaLocally(srcClient *SchemaRegistryClient, pathToWrite string, subject string, version int64, wg *sync.WaitGroup) {
-	rawSchema := srcClient.GetSchema(subject, version, false)
+func writeSchemaLocally(srcClient *SchemaRegistryClient, pathToWrite string, subject string, version int64,
+	softDeleted bool, manifest *manifestBuilder, wg *sync.WaitGroup) {
+	rawSchema := srcClient.GetSchema(subject, version, softDeleted)
 	defer wg.Done()
 	if CancelRun == true {
 		return
@@ -132,32 +226,8 @@ func writeSchemaLocally(srcClient *SchemaRegistryClient, pathToWrite string, sub
 	log.Printf("Writing schema: %s with version: %d and ID: %d",
 		rawSchema.Subject, rawSchema.Version, rawSchema.Id)
 
-	filename := fmt.Sprintf("%s-%d-%d-%s", url.QueryEscape(rawSchema.Subject), rawSchema.Version, rawSchema.Id, rawSchema.SType)
-	f, err := os.Create(filepath.Join(pathToWrite, filename))
-
-	check(err)
-	defer f.Close()
-
-	_, err = f.WriteString(rawSchema.Schema)
-	check(err)
-	if len(rawSchema.References) != 0 {
-		_, err = f.WriteString("\n")
-		check(err)
-		_, err = f.WriteString(ReferenceSeparator)
-		check(err)
-		_, err = f.WriteString("\n")
-		check(err)
-		for _, oneRef := range rawSchema.References {
-			jsonRepresentation, err := json.Marshal(oneRef)
-			check(err)
-			_, err = f.Write(jsonRepresentation)
-			check(err)
-			_, err = f.WriteString("|\n")
-			check(err)
-		}
-	}
-
-	_ = f.Sync()
+	fullPath := writeSchemaFile(pathToWrite, rawSchema, softDeleted)
+	manifest.add(rawSchema, softDeleted, pathToWrite, fullPath)
 }
 
 // Returns a valid local FS path to write the schemas to
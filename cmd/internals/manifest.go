@@ -0,0 +1,342 @@
+package client
+
+//
+// manifest.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ManifestFileName = "manifest.json"
+
+// Describes every schema held by a local backup
+type BackupManifest struct {
+	SourceUrl       string          `json:"sourceUrl"`
+	ExporterVersion string          `json:"exporterVersion"`
+	CreatedAt       time.Time       `json:"createdAt"`
+	Config          *RegistryConfig `json:"config,omitempty"`
+	Schemas         []ManifestEntry `json:"schemas"`
+}
+
+// Compatibility levels and modes of a registry, subjects only hold the levels set for themselves
+type RegistryConfig struct {
+	Compatibility string                   `json:"compatibility,omitempty"`
+	Mode          string                   `json:"mode,omitempty"`
+	Subjects      map[string]SubjectConfig `json:"subjects,omitempty"`
+}
+
+type SubjectConfig struct {
+	Compatibility string `json:"compatibility,omitempty"`
+	Mode          string `json:"mode,omitempty"`
+}
+
+// Describes one subject version held by a local backup
+type ManifestEntry struct {
+	Subject     string            `json:"subject"`
+	Version     int64             `json:"version"`
+	Id          int64             `json:"id"`
+	SType       string            `json:"schemaType"`
+	References  []SchemaReference `json:"references"`
+	SoftDeleted bool              `json:"softDeleted"`
+	Path        string            `json:"path"`
+	Checksum    string            `json:"sha256"`
+}
+
+// Collects manifest entries from concurrent schema writes
+type manifestBuilder struct {
+	manifest BackupManifest
+	lock     sync.Mutex
+}
+
+func newManifestBuilder(sourceUrl string) *manifestBuilder {
+	return &manifestBuilder{manifest: BackupManifest{
+		SourceUrl:       sourceUrl,
+		ExporterVersion: Version,
+		CreatedAt:       time.Now().UTC(),
+		Schemas:         []ManifestEntry{},
+	}}
+}
+
+// Adds the given record, written to the given file of the backup, to the manifest
+func (mb *manifestBuilder) add(record SchemaRecord, softDeleted bool, backupPath string, filePath string) {
+	contents, err := ioutil.ReadFile(filePath)
+	check(err)
+	relativePath, err := filepath.Rel(backupPath, filePath)
+	check(err)
+	mb.addContents(record, softDeleted, filepath.ToSlash(relativePath), contents)
+}
+
+// Adds the given record, stored with the given contents at the given path relative to the backup, to the manifest
+func (mb *manifestBuilder) addContents(record SchemaRecord, softDeleted bool, relativePath string, contents []byte) {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+	mb.manifest.Schemas = append(mb.manifest.Schemas, ManifestEntry{
+		Subject:     record.Subject,
+		Version:     record.Version,
+		Id:          record.Id,
+		SType:       record.SType,
+		References:  record.setReferenceIfEmpty().References,
+		SoftDeleted: softDeleted,
+		Path:        relativePath,
+		Checksum:    checksumOf(contents),
+	})
+}
+
+// Removes the given subject version from the manifest, returning its entry if it was present
+func (mb *manifestBuilder) remove(subject string, version int64) (ManifestEntry, bool) {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+	for i, entry := range mb.manifest.Schemas {
+		if entry.Subject == subject && entry.Version == version {
+			mb.manifest.Schemas = append(mb.manifest.Schemas[:i], mb.manifest.Schemas[i+1:]...)
+			return entry, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// Sets the registry configuration recorded by the manifest
+func (mb *manifestBuilder) setConfig(config *RegistryConfig) {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+	mb.manifest.Config = config
+}
+
+// Writes the manifest at the root of the backup
+func (mb *manifestBuilder) write(backupPath string) {
+	err := ioutil.WriteFile(filepath.Join(backupPath, ManifestFileName), mb.marshal(), 0644)
+	check(err)
+	log.Printf("Wrote manifest with %d schemas", len(mb.manifest.Schemas))
+}
+
+// Returns the manifest as written in backups, schemas sorted by subject and version
+func (mb *manifestBuilder) marshal() []byte {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	sort.Slice(mb.manifest.Schemas, func(i, j int) bool {
+		return lessSubjectVersion(mb.manifest.Schemas[i].Subject, mb.manifest.Schemas[i].Version,
+			mb.manifest.Schemas[j].Subject, mb.manifest.Schemas[j].Version)
+	})
+
+	manifestJson, err := json.MarshalIndent(mb.manifest, "", "  ")
+	check(err)
+	return manifestJson
+}
+
+// Returns the manifest of the given backup, if it has one
+func readManifest(backupPath string) (*BackupManifest, bool) {
+	manifestPath := filepath.Join(backupPath, ManifestFileName)
+	if !fileExists(manifestPath) {
+		return nil, false
+	}
+
+	contents, err := ioutil.ReadFile(manifestPath)
+	check(err)
+
+	manifest := BackupManifest{}
+	err = json.Unmarshal(contents, &manifest)
+	checkFail(err, "Could not parse the backup manifest "+manifestPath)
+
+	return &manifest, true
+}
+
+// Reads the schema of a manifest entry, making sure the file has not changed since it was written
+func (me ManifestEntry) readRecord(backupPath string) (SchemaRecord, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(backupPath, filepath.FromSlash(me.Path)))
+	if err != nil {
+		return SchemaRecord{}, err
+	}
+	return me.recordFromContents(contents)
+}
+
+// Returns the schema of a manifest entry given the contents of its file, making sure they match its checksum
+func (me ManifestEntry) recordFromContents(contents []byte) (SchemaRecord, error) {
+	if me.Checksum != "" && checksumOf(contents) != me.Checksum {
+		return SchemaRecord{}, fmt.Errorf("checksum of %s does not match the manifest", me.Path)
+	}
+
+	schema := schemaFromFile(me.Path, me.SType, contents)
+	// Older backups keep references at the end of the schema file
+	if strings.Contains(schema, ReferenceSeparator) {
+		schema = schema[:strings.LastIndex(schema, ReferenceSeparator)-1]
+	}
+
+	return SchemaRecord{
+		Subject:    me.Subject,
+		Schema:     schema,
+		SType:      me.SType,
+		Version:    me.Version,
+		Id:         me.Id,
+		References: me.References,
+	}.setTypeIfEmpty().setReferenceIfEmpty(), nil
+}
+
+// Returns the entries of the manifest indexed by subject version
+func (bm *BackupManifest) entriesBySubjectVersion() map[SubjectVersion]ManifestEntry {
+	entries := map[SubjectVersion]ManifestEntry{}
+	for _, entry := range bm.Schemas {
+		entries[SubjectVersion{Subject: entry.Subject, Version: entry.Version}] = entry
+	}
+	return entries
+}
+
+// Registers every schema described in the manifest, references first, versions incompatible with the versions of their
+// subject registered before them excepted.
+// Soft deleted schemas are deleted again once everything is registered, then the registry configuration is restored.
+func writeFromManifest(dstClient *SchemaRegistryClient, manifest *BackupManifest, backupPath string, compatibility *compatibilityGate) {
+	entries := manifest.entriesBySubjectVersion()
+	written := map[SubjectVersion]bool{}
+
+	for _, entry := range manifest.Schemas {
+		if CancelRun == true {
+			return
+		}
+		if checkSubjectIsAllowed(entry.Subject) {
+			writeManifestEntryToSR(dstClient, entry, entries, backupPath, written, compatibility)
+		}
+	}
+
+	for _, entry := range manifest.Schemas {
+		if CancelRun == true {
+			return
+		}
+		if entry.SoftDeleted && written[SubjectVersion{Subject: entry.Subject, Version: entry.Version}] {
+			log.Printf("Soft deleting Schema with Subject: %s. Version: %v", entry.Subject, entry.Version)
+			dstClient.PerformSoftDelete(entry.Subject, entry.Version)
+		}
+	}
+
+	restoreRegistryConfig(dstClient, manifest.Config)
+}
+
+// Returns the global configuration of the registry, along with the configuration set for the given subjects
+func captureRegistryConfig(srcClient *SchemaRegistryClient, subjects []string) *RegistryConfig {
+	config := RegistryConfig{
+		Compatibility: srcClient.GetGlobalCompatibility(),
+		Mode:          srcClient.GetGlobalMode(),
+		Subjects:      map[string]SubjectConfig{},
+	}
+	for _, subject := range subjects {
+		subjectConfig := SubjectConfig{
+			Compatibility: srcClient.GetSubjectCompatibility(subject),
+			Mode:          srcClient.GetSubjectMode(subject),
+		}
+		if subjectConfig != (SubjectConfig{}) {
+			config.Subjects[subject] = subjectConfig
+		}
+	}
+	return &config
+}
+
+// Applies the given configuration to the registry. Subjects come first, and the global mode last,
+// as the destination has to stay in IMPORT mode while schemas are registered.
+// Modes are only set with -restoreModes, as leaving IMPORT mode makes any later restore into the destination fail.
+func restoreRegistryConfig(dstClient *SchemaRegistryClient, config *RegistryConfig) {
+	if config == nil {
+		return
+	}
+
+	for _, subject := range sortedSubjectConfigs(config.Subjects) {
+		if !checkSubjectIsAllowed(subject) {
+			continue
+		}
+		subjectConfig := config.Subjects[subject]
+		if subjectConfig.Compatibility != "" {
+			log.Printf("Setting compatibility of subject %s to %s", subject, subjectConfig.Compatibility)
+			dstClient.SetSubjectCompatibility(subject, subjectConfig.Compatibility)
+		}
+		if subjectConfig.Mode != "" && RestoreModes {
+			log.Printf("Setting mode of subject %s to %s", subject, subjectConfig.Mode)
+			dstClient.SetSubjectMode(subject, subjectConfig.Mode)
+		} else if subjectConfig.Mode != "" {
+			log.Printf("Mode of subject %s was %s in the backup, use -restoreModes to set it", subject, subjectConfig.Mode)
+		}
+	}
+
+	if config.Compatibility != "" {
+		log.Printf("Setting global compatibility to %s", config.Compatibility)
+		dstClient.putLevel("config", CompatRecord{Compatibility: config.Compatibility})
+	}
+	if config.Mode != "" && RestoreModes {
+		log.Printf("Setting global mode to %s", config.Mode)
+		dstClient.putLevel("mode", ModeRecord{Mode: config.Mode})
+	} else if config.Mode != "" {
+		log.Printf("Global mode was %s in the backup, use -restoreModes to set it. The destination stays in IMPORT mode", config.Mode)
+	}
+}
+
+func sortedSubjectConfigs(subjects map[string]SubjectConfig) []string {
+	sorted := []string{}
+	for subject := range subjects {
+		sorted = append(sorted, subject)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func writeManifestEntryToSR(dstClient *SchemaRegistryClient, entry ManifestEntry, entries map[SubjectVersion]ManifestEntry,
+	backupPath string, written map[SubjectVersion]bool, compatibility *compatibilityGate) {
+	key := SubjectVersion{Subject: entry.Subject, Version: entry.Version}
+	if written[key] {
+		return
+	}
+	// Marked while its references are written to stop reference cycles, and unmarked if it could not be registered
+	written[key] = true
+
+	for _, reference := range entry.References {
+		referenceEntry, exists := entries[SubjectVersion{Subject: reference.Subject, Version: reference.Version}]
+		if !exists {
+			log.Printf("Reference %s with version %d of subject %s is not in the backup", reference.Subject, reference.Version, entry.Subject)
+			continue
+		}
+		log.Println(fmt.Sprintf("Writing referenced schema with Subject: %s and Version: %d", reference.Subject, reference.Version))
+		writeManifestEntryToSR(dstClient, referenceEntry, entries, backupPath, written, compatibility)
+	}
+
+	record, err := entry.readRecord(backupPath)
+	if err != nil {
+		log.Printf("Could not read schema with Subject: %s and Version: %d from backup: %v", entry.Subject, entry.Version, err)
+		delete(written, key)
+		return
+	}
+	if !compatibility.allows(record.Subject, record.Version, record.SType, record.Schema) {
+		delete(written, key)
+		return
+	}
+
+	log.Printf("Registering Schema with Subject: %s. Version: %v, and ID: %v", record.Subject, record.Version, record.Id)
+	responseBody := dstClient.RegisterSchemaBySubjectAndIDAndVersion(record.Schema, record.Subject, record.Id, record.Version, record.SType, record.References)
+	if err := errorFromResponse(responseBody); err != nil {
+		log.Printf("Could not register schema with Subject: %s and Version: %d: %v", record.Subject, record.Version, err)
+		delete(written, key)
+	}
+}
+
+func checksumOf(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns whether the given path is the manifest of a backup
+func isManifestFile(path string) bool {
+	return filepath.Base(path) == ManifestFileName
+}
+
+// Returns whether the given path should be ignored when reading the schema files of a backup
+func skipBackupFile(path string, info os.FileInfo) bool {
+	return info.IsDir() || isManifestFile(path) || filepath.Base(path) == SnapshotFileName || isSubjectLayoutFile(path)
+}
@@ -0,0 +1,153 @@
+package client
+
+//
+// manifest_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackManifest(t *testing.T) {
+	t.Run("TManifestRoundTrip", func(t *testing.T) { TManifestRoundTrip(t) })
+	t.Run("TManifestChecksum", func(t *testing.T) { TManifestChecksum(t) })
+	t.Run("TManifestSoftDeletesAndConfig", func(t *testing.T) { TManifestSoftDeletesAndConfig(t) })
+	t.Run("TManifestRestore", func(t *testing.T) { TManifestRestore(t) })
+}
+
+func TManifestRoundTrip(t *testing.T) {
+	backupDir := t.TempDir()
+	writeBackupFile(t, backupDir, "test-key-1-10001-AVRO", mockSchema+"\n"+ReferenceSeparator+"\n{}|\n")
+
+	builder := newManifestBuilder("http://source")
+	builder.add(schema1, false, backupDir, filepath.Join(backupDir, "test-key-1-10001-AVRO"))
+	builder.write(backupDir)
+
+	manifest, hasManifest := readManifest(backupDir)
+	assert.True(t, hasManifest)
+	assert.Equal(t, "http://source", manifest.SourceUrl)
+	assert.Equal(t, Version, manifest.ExporterVersion)
+	assert.Equal(t, 1, len(manifest.Schemas))
+	assert.Equal(t, "test-key-1-10001-AVRO", manifest.Schemas[0].Path)
+
+	record, err := manifest.Schemas[0].readRecord(backupDir)
+	assert.Nil(t, err)
+	assert.Equal(t, mockSchema, record.Schema)
+	assert.Equal(t, schema1.References, record.References)
+	assert.Equal(t, schema1.Id, record.Id)
+
+	// Manifest files are not schemas
+	snapshot := newLocalSnapshot(backupDir)
+	assert.Equal(t, map[string][]int64{testingSubject: {1}}, snapshot.subjects)
+}
+
+func TManifestChecksum(t *testing.T) {
+	backupDir := t.TempDir()
+	schemaPath := filepath.Join(backupDir, "test-key-1-10001-AVRO")
+	writeBackupFile(t, backupDir, "test-key-1-10001-AVRO", mockSchema)
+
+	builder := newManifestBuilder("http://source")
+	builder.add(schema1, false, backupDir, schemaPath)
+	builder.write(backupDir)
+
+	err := os.WriteFile(schemaPath, []byte(schemaToReferenceDTwo), 0644)
+	assert.Nil(t, err)
+
+	manifest, _ := readManifest(backupDir)
+	_, err = manifest.Schemas[0].readRecord(backupDir)
+	assert.NotNil(t, err)
+}
+
+func TManifestSoftDeletesAndConfig(t *testing.T) {
+	backupDir := t.TempDir()
+	writeBackupFile(t, backupDir, "test-key-1-10001-AVRO", mockSchema)
+	writeBackupFile(t, backupDir, "test-key-2-10002-AVRO", mockSchema)
+
+	config := &RegistryConfig{
+		Compatibility: "BACKWARD",
+		Mode:          "READWRITE",
+		Subjects:      map[string]SubjectConfig{testingSubject: {Compatibility: "NONE"}},
+	}
+	softDeletedSchema := schema1
+	softDeletedSchema.Version = 2
+	softDeletedSchema.Id = 10002
+
+	builder := newManifestBuilder("http://source")
+	builder.add(schema1, false, backupDir, filepath.Join(backupDir, "test-key-1-10001-AVRO"))
+	builder.add(softDeletedSchema, true, backupDir, filepath.Join(backupDir, "test-key-2-10002-AVRO"))
+	builder.setConfig(config)
+	builder.write(backupDir)
+
+	manifest, _ := readManifest(backupDir)
+	assert.Equal(t, config, manifest.Config)
+	assert.False(t, manifest.Schemas[0].SoftDeleted)
+	assert.True(t, manifest.Schemas[1].SoftDeleted)
+
+	// Soft deleted schemas are not part of the live state of a backup
+	snapshot := newLocalSnapshot(backupDir)
+	assert.Equal(t, map[string][]int64{testingSubject: {1}}, snapshot.subjects)
+}
+
+func TManifestRestore(t *testing.T) {
+	HttpCallTimeout = 60
+	defer func() { RestoreModes = false }()
+	var lock sync.Mutex
+	registrations := map[string]int{}
+	configured := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if r.Method == http.MethodPut {
+			configured = append(configured, r.URL.Path)
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		registrations[r.URL.Path]++
+		// The first registration of the referenced schema fails
+		if r.URL.Path == "/subjects/address-value/versions" && registrations[r.URL.Path] == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"error_code":50001,"message":"Error in the backend data store"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":1}`))
+	}))
+	defer server.Close()
+	dstClient := NewSchemaRegistryClient(server.URL, "key", "secret", "dst")
+
+	backupDir := t.TempDir()
+	builder := newManifestBuilder("http://source")
+	for _, record := range []SchemaRecord{
+		{Subject: "customers-value", Version: 1, Id: 2, SType: AVRO.String(), Schema: mockSchema,
+			References: []SchemaReference{{Name: "Address", Subject: "address-value", Version: 1}}},
+		{Subject: "address-value", Version: 1, Id: 1, SType: AVRO.String(), Schema: mockSchema},
+	} {
+		name := fmt.Sprintf("%s-%d-%d-%s", record.Subject, record.Version, record.Id, record.SType)
+		writeBackupFile(t, backupDir, name, record.Schema)
+		builder.add(record, false, backupDir, filepath.Join(backupDir, name))
+	}
+	builder.setConfig(&RegistryConfig{Compatibility: "BACKWARD", Mode: "READWRITE",
+		Subjects: map[string]SubjectConfig{"address-value": {Compatibility: "FULL", Mode: "READONLY"}}})
+	builder.write(backupDir)
+	manifest, _ := readManifest(backupDir)
+	compatibility, _ := newCompatibilityGate("NONE")
+
+	// A failed registration is tried again, and modes are not set, keeping the destination in IMPORT mode
+	writeFromManifest(dstClient, manifest, backupDir, compatibility)
+	assert.Equal(t, 2, registrations["/subjects/address-value/versions"])
+	assert.Equal(t, 1, registrations["/subjects/customers-value/versions"])
+	assert.Equal(t, []string{"/config/address-value", "/config"}, configured)
+
+	configured = []string{}
+	RestoreModes = true
+	writeFromManifest(dstClient, manifest, backupDir, compatibility)
+	assert.Equal(t, []string{"/config/address-value", "/mode/address-value", "/config", "/mode"}, configured)
+}
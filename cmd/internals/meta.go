@@ -35,6 +35,43 @@ var AllowList StringArrayFlag
 var DisallowList StringArrayFlag
 var ReferenceSeparator = "=====References====="
 var SchemaLoadType string
+var WatchSchemaLoad bool
+var SubjectNameStrategyName string
+var ReferenceSubjectStrategyName string
+var TopicMappingPath string
+var KeySchemas bool
+var SchemaVersionOrder string
+var AvroSchemaFormName string
+var CompatibilityLevelName string
+var LintSource string
+var LintRulesPath string
+var FanOutDestinations StringArrayFlag
+var FanInSources StringArrayFlag
+var FanInPlacement string
+var VerifyConfig bool
+var ReportFormat string
+var ReportOutput string
+var DiffLeft string
+var DiffRight string
+var BreakingFrom string
+var BreakingTo string
+var CatalogSource string
+var CatalogPath string
+var CatalogFormatName string
+var GraphSource string
+var GraphFormat string
+var GraphSubject string
+var GraphDirectionName string
+var GraphDanglingOnly bool
+var ArchiveRecipient string
+var ArchiveIdentity string
+var IncrementalBackup bool
+var RestoreAt string
+var RestoreModes bool
+var RetainSnapshots int
+var BackupLayoutName string
+var GitAuthorName string
+var GitAuthorEmail string
 
 // Define RunMode Enum
 type RunMode int
@@ -45,10 +82,18 @@ const (
 	TOLOCAL
 	FROMLOCAL
 	SCHEMALOAD
+	MERGE
+	VERIFY
+	DIFF
+	CHECKCOMPAT
+	LINT
+	BREAKING
+	CATALOG
+	GRAPH
 )
 
 func (r RunMode) String() string {
-	return [...]string{"SYNC", "BATCH", "TOLOCAL", "FROMLOCAL"}[r]
+	return [...]string{"SYNC", "BATCH", "TOLOCAL", "FROMLOCAL", "SCHEMALOAD", "MERGE", "VERIFY", "DIFF", "CHECKCOMPAT", "LINT", "BREAKING", "CATALOG", "GRAPH"}[r]
 }
 
 // Define Mode Enum
@@ -102,3 +147,24 @@ var (
 		Help: "The total number of hard deleted schemas",
 	})
 )
+
+var (
+	fanOutSchemasRegistered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "schema_exporter_fanout_registered_schemas",
+		Help: "The total number of registered schemas per fan-out destination",
+	}, []string{"destination"})
+)
+
+var (
+	fanOutFailedSyncs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "schema_exporter_fanout_failed_syncs",
+		Help: "The total number of failed sync cycles per fan-out destination",
+	}, []string{"destination"})
+)
+
+var (
+	fanOutLastSuccessfulSync = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "schema_exporter_fanout_last_successful_sync_timestamp_seconds",
+		Help: "The unix time of the last successful sync cycle per fan-out destination",
+	}, []string{"destination"})
+)
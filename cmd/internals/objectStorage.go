@@ -0,0 +1,371 @@
+package client
+
+//
+// objectStorage.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+/*
+S3Destination and S3Source keep a backup in an S3 compatible bucket, in the same files, layout and manifest
+as getLocalCopy, under an optional prefix. They are configured through the S3_OPTIONS environment variable,
+a semicolon separated list of key=value options:
+	endpoint     Host (and port) of the object storage. Defaults to s3.amazonaws.com
+	bucket       Bucket holding the backup. Required
+	prefix       Prefix of every object of the backup
+	region       Region of the bucket
+	secure       Whether to use HTTPS. Defaults to true
+	sse          Server-side encryption of written objects: AES256 or aws:kms
+	kmsKeyId     KMS key used with sse=aws:kms
+	accessKey    Access key, along with secretKey and the optional sessionToken. Defaults to the AWS_ and MINIO_
+	             environment variables, then to the IAM role of the host
+*/
+
+type S3Options struct {
+	Endpoint     string
+	Bucket       string
+	Prefix       string
+	Region       string
+	Secure       bool
+	SSE          string
+	KMSKeyId     string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// Returns the options in the S3_OPTIONS environment variable
+func S3OptionsFromEnv() S3Options {
+	return parseS3Options(os.Getenv("S3_OPTIONS"))
+}
+
+func parseS3Options(optionsVar string) S3Options {
+	optionsMap := map[string]string{}
+	if optionsVar != "" {
+		for _, option := range strings.Split(optionsVar, ";") {
+			splitOption := strings.SplitN(option, "=", 2)
+			if len(splitOption) == 2 {
+				optionsMap[strings.TrimSpace(splitOption[0])] = strings.TrimSpace(splitOption[1])
+			}
+		}
+	}
+
+	options := S3Options{
+		Endpoint:     optionsMap["endpoint"],
+		Bucket:       optionsMap["bucket"],
+		Prefix:       strings.Trim(optionsMap["prefix"], "/"),
+		Region:       optionsMap["region"],
+		Secure:       true,
+		SSE:          optionsMap["sse"],
+		KMSKeyId:     optionsMap["kmsKeyId"],
+		AccessKey:    optionsMap["accessKey"],
+		SecretKey:    optionsMap["secretKey"],
+		SessionToken: optionsMap["sessionToken"],
+	}
+	if options.Endpoint == "" {
+		options.Endpoint = "s3.amazonaws.com"
+	}
+	if secure, err := strconv.ParseBool(optionsMap["secure"]); err == nil {
+		options.Secure = secure
+	}
+	return options
+}
+
+// The objects of a backup in a bucket
+type s3Bucket struct {
+	client  *minio.Client
+	options S3Options
+	sse     encrypt.ServerSide
+}
+
+func newS3Bucket(options S3Options) (*s3Bucket, error) {
+	if options.Bucket == "" {
+		return nil, fmt.Errorf("no bucket has been specified in S3_OPTIONS")
+	}
+
+	var creds *credentials.Credentials
+	if options.AccessKey != "" {
+		creds = credentials.NewStaticV4(options.AccessKey, options.SecretKey, options.SessionToken)
+	} else {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+		})
+	}
+
+	minioClient, err := minio.New(options.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: options.Secure,
+		Region: options.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var sse encrypt.ServerSide
+	switch strings.ToLower(options.SSE) {
+	case "":
+	case "aes256":
+		sse = encrypt.NewSSE()
+	case "aws:kms":
+		sse, err = encrypt.NewSSEKMS(options.KMSKeyId, nil)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown server-side encryption %s, expected one of AES256 or aws:kms", options.SSE)
+	}
+
+	return &s3Bucket{client: minioClient, options: options, sse: sse}, nil
+}
+
+func (b *s3Bucket) key(name string) string {
+	if b.options.Prefix == "" {
+		return name
+	}
+	return path.Join(b.options.Prefix, name)
+}
+
+func (b *s3Bucket) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), time.Duration(HttpCallTimeout)*time.Second)
+}
+
+func (b *s3Bucket) put(name string, contents []byte) error {
+	ctx, cancel := b.context()
+	defer cancel()
+	_, err := b.client.PutObject(ctx, b.options.Bucket, b.key(name), bytes.NewReader(contents), int64(len(contents)),
+		minio.PutObjectOptions{ServerSideEncryption: b.sse, ContentType: "application/octet-stream"})
+	return err
+}
+
+// Returns the contents of the given object, and whether it exists
+func (b *s3Bucket) get(name string) ([]byte, bool, error) {
+	ctx, cancel := b.context()
+	defer cancel()
+	object, err := b.client.GetObject(ctx, b.options.Bucket, b.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, false, err
+	}
+	defer object.Close()
+
+	contents, err := ioutil.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return contents, true, nil
+}
+
+func (b *s3Bucket) remove(name string) error {
+	ctx, cancel := b.context()
+	defer cancel()
+	return b.client.RemoveObject(ctx, b.options.Bucket, b.key(name), minio.RemoveObjectOptions{})
+}
+
+// Returns the manifest of the backup in the bucket, if it has one
+func (b *s3Bucket) readManifest() (*BackupManifest, bool, error) {
+	contents, exists, err := b.get(ManifestFileName)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+	manifest := BackupManifest{}
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return nil, false, fmt.Errorf("could not parse the backup manifest: %w", err)
+	}
+	return &manifest, true, nil
+}
+
+/*
+S3Destination is a CustomDestination writing schemas to a bucket.
+The manifest is written once all changes of a sync run or batch export are applied.
+*/
+
+type S3Destination struct {
+	Options  S3Options
+	bucket   *s3Bucket
+	manifest *manifestBuilder
+	changed  bool
+}
+
+func NewS3Destination() S3Destination {
+	return S3Destination{Options: S3OptionsFromEnv()}
+}
+
+func (sd *S3Destination) SetUp() error {
+	bucket, err := newS3Bucket(sd.Options)
+	if err != nil {
+		return err
+	}
+	sd.bucket = bucket
+	log.Printf("Starting S3 Destination with bucket: %s and prefix: %s", sd.Options.Bucket, sd.Options.Prefix)
+
+	sd.manifest = newManifestBuilder(SrcSRUrl)
+	existing, hasManifest, err := bucket.readManifest()
+	if err != nil {
+		return err
+	}
+	if hasManifest {
+		sd.manifest.manifest.Schemas = existing.Schemas
+		sd.manifest.manifest.Config = existing.Config
+	}
+	return nil
+}
+
+func (sd *S3Destination) RegisterSchema(record SchemaRecord) error {
+	schemaFile, files := renderSchemaFiles(record, false)
+	for name, contents := range files {
+		if err := sd.bucket.put(name, contents); err != nil {
+			return err
+		}
+	}
+	previous, replaced := sd.manifest.remove(record.Subject, record.Version)
+	sd.manifest.addContents(record, false, schemaFile, files[schemaFile])
+	sd.changed = true
+	// The previous object was overwritten unless the version moved to another key, under another ID
+	if replaced && previous.Path != schemaFile {
+		return sd.removeObjects(previous)
+	}
+	return nil
+}
+
+func (sd *S3Destination) DeleteSchema(subject string, version int64) error {
+	entry, exists := sd.manifest.remove(subject, version)
+	if !exists {
+		return fmt.Errorf("subject %s with version %d is not in the bucket", subject, version)
+	}
+	sd.changed = true
+	return sd.removeObjects(entry)
+}
+
+// Removes the object of the given entry, along with its sidecar if it has one
+func (sd *S3Destination) removeObjects(entry ManifestEntry) error {
+	if err := sd.bucket.remove(entry.Path); err != nil {
+		return err
+	}
+	if sidecarPath := sidecarPathOf(entry.Path); sidecarPath != "" {
+		return sd.bucket.remove(sidecarPath)
+	}
+	return nil
+}
+
+// Returns the subject versions held by the bucket
+func (sd *S3Destination) GetDestinationState() (map[string][]int64, error) {
+	sd.manifest.lock.Lock()
+	defer sd.manifest.lock.Unlock()
+	return stateOfEntries(sd.manifest.manifest.Schemas), nil
+}
+
+// Writes the manifest if any schema changed since it was last written
+func (sd *S3Destination) CommitChanges() error {
+	if !sd.changed {
+		return nil
+	}
+
+	manifestJson := sd.manifest.marshal()
+	if err := sd.bucket.put(ManifestFileName, manifestJson); err != nil {
+		return err
+	}
+	sd.changed = false
+	log.Printf("Wrote manifest with %d schemas to bucket %s", len(sd.manifest.manifest.Schemas), sd.Options.Bucket)
+	return nil
+}
+
+func (sd *S3Destination) TearDown() error {
+	return sd.CommitChanges()
+}
+
+/*
+S3Source is a CustomSource reading the schemas of a backup in a bucket through its manifest.
+*/
+
+type S3Source struct {
+	Options S3Options
+	bucket  *s3Bucket
+	entries map[SubjectVersion]ManifestEntry
+}
+
+func NewS3Source() S3Source {
+	return S3Source{Options: S3OptionsFromEnv()}
+}
+
+func (ss *S3Source) SetUp() error {
+	bucket, err := newS3Bucket(ss.Options)
+	if err != nil {
+		return err
+	}
+	ss.bucket = bucket
+	log.Printf("Starting S3 Source with bucket: %s and prefix: %s", ss.Options.Bucket, ss.Options.Prefix)
+	return ss.refresh()
+}
+
+// Reads the manifest of the bucket again, as the backup may have changed since the last read
+func (ss *S3Source) refresh() error {
+	manifest, hasManifest, err := ss.bucket.readManifest()
+	if err != nil {
+		return err
+	}
+	ss.entries = map[SubjectVersion]ManifestEntry{}
+	if hasManifest {
+		ss.entries = manifest.entriesBySubjectVersion()
+	}
+	return nil
+}
+
+func (ss *S3Source) GetSchema(subject string, version int64) (id int64, stype string, schema string, references []SchemaReference, err error) {
+	entry, exists := ss.entries[SubjectVersion{Subject: subject, Version: version}]
+	if !exists {
+		return 0, "", "", nil, fmt.Errorf("subject %s with version %d is not in the bucket", subject, version)
+	}
+
+	contents, exists, err := ss.bucket.get(entry.Path)
+	if err != nil {
+		return 0, "", "", nil, err
+	}
+	if !exists {
+		return 0, "", "", nil, fmt.Errorf("object %s of the manifest is missing from the bucket", entry.Path)
+	}
+
+	record, err := entry.recordFromContents(contents)
+	if err != nil {
+		return 0, "", "", nil, err
+	}
+	return record.Id, record.SType, record.Schema, record.References, nil
+}
+
+func (ss *S3Source) GetSourceState() (map[string][]int64, error) {
+	if err := ss.refresh(); err != nil {
+		return nil, err
+	}
+	state := map[string][]int64{}
+	for _, entry := range sortedManifestEntries(ss.entries) {
+		if !entry.SoftDeleted {
+			state[entry.Subject] = append(state[entry.Subject], entry.Version)
+		}
+	}
+	return state, nil
+}
+
+func (ss *S3Source) TearDown() error {
+	return nil
+}
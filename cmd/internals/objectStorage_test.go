@@ -0,0 +1,187 @@
+package client
+
+//
+// objectStorage_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackObjectStorage(t *testing.T) {
+	t.Run("TParseS3Options", func(t *testing.T) { TParseS3Options(t) })
+	t.Run("TS3RoundTrip", func(t *testing.T) { TS3RoundTrip(t) })
+	t.Run("TS3ReRegisterAndFilter", func(t *testing.T) { TS3ReRegisterAndFilter(t) })
+}
+
+func TParseS3Options(t *testing.T) {
+	options := parseS3Options("endpoint=localhost:9000;bucket=backups;prefix=/registry/;secure=false;sse=AES256")
+
+	assert.Equal(t, "localhost:9000", options.Endpoint)
+	assert.Equal(t, "backups", options.Bucket)
+	assert.Equal(t, "registry", options.Prefix)
+	assert.False(t, options.Secure)
+	assert.Equal(t, "AES256", options.SSE)
+
+	options = parseS3Options("bucket=backups")
+	assert.Equal(t, "s3.amazonaws.com", options.Endpoint)
+	assert.True(t, options.Secure)
+}
+
+func TS3RoundTrip(t *testing.T) {
+	HttpCallTimeout = 60
+	store := newFakeObjectStore()
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	options := S3Options{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Bucket:    "backups",
+		Prefix:    "registry",
+		Region:    "us-east-1",
+		SSE:       "AES256",
+		AccessKey: "access",
+		SecretKey: "secret",
+	}
+
+	destination := S3Destination{Options: options}
+	assert.Nil(t, destination.SetUp())
+	assert.Nil(t, destination.RegisterSchema(SchemaRecord{Subject: testingSubject, Schema: mockSchema, SType: "AVRO", Version: 1, Id: 10001}))
+	assert.Nil(t, destination.RegisterSchema(SchemaRecord{Subject: testingSubject, Schema: mockSchema, SType: "AVRO", Version: 2, Id: 10002}))
+	assert.Nil(t, destination.DeleteSchema(testingSubject, 1))
+	assert.Nil(t, destination.TearDown())
+
+	assert.Equal(t, []string{"/backups/registry/manifest.json", "/backups/registry/test-key-2-10002-AVRO"}, store.keys())
+	assert.Equal(t, "AES256", store.putHeaders["/backups/registry/test-key-2-10002-AVRO"].Get("X-Amz-Server-Side-Encryption"))
+
+	source := S3Source{Options: options}
+	assert.Nil(t, source.SetUp())
+	state, err := source.GetSourceState()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]int64{testingSubject: {2}}, state)
+
+	id, stype, schema, references, err := source.GetSchema(testingSubject, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10002), id)
+	assert.Equal(t, "AVRO", stype)
+	assert.Equal(t, mockSchema, schema)
+	assert.Equal(t, []SchemaReference{}, references)
+
+	_, _, _, _, err = source.GetSchema(testingSubject, 1)
+	assert.NotNil(t, err)
+}
+
+func TS3ReRegisterAndFilter(t *testing.T) {
+	HttpCallTimeout = 60
+	defer func() { BackupLayoutName, DisallowList = "", nil }()
+	store := newFakeObjectStore()
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	destination := S3Destination{Options: S3Options{Endpoint: strings.TrimPrefix(server.URL, "http://"), Bucket: "backups",
+		Region: "us-east-1", AccessKey: "access", SecretKey: "secret"}}
+	assert.Nil(t, destination.SetUp())
+
+	BackupLayoutName = SUBJECT.String()
+	assert.Nil(t, destination.RegisterSchema(SchemaRecord{Subject: testingSubject, Schema: mockSchema, SType: "AVRO", Version: 1, Id: 10001}))
+	assert.Nil(t, destination.RegisterSchema(SchemaRecord{Subject: "filtered-value", Schema: mockSchema, SType: "AVRO", Version: 1, Id: 10002}))
+	assert.Equal(t, []string{"/backups/filtered-value/v1.avsc", "/backups/filtered-value/v1.meta.json",
+		"/backups/test-key/v1.avsc", "/backups/test-key/v1.meta.json"}, store.keys())
+
+	// A version registered again at another key replaces the previous object and its sidecar
+	BackupLayoutName = FLAT.String()
+	assert.Nil(t, destination.RegisterSchema(SchemaRecord{Subject: testingSubject, Schema: mockSchema, SType: "AVRO", Version: 1, Id: 10003}))
+	assert.Nil(t, destination.RegisterSchema(SchemaRecord{Subject: testingSubject, Schema: mockSchema, SType: "AVRO", Version: 1, Id: 10004}))
+	assert.Equal(t, []string{"/backups/filtered-value/v1.avsc", "/backups/filtered-value/v1.meta.json",
+		"/backups/test-key-1-10004-AVRO"}, store.keys())
+
+	// Subjects filtered out are not part of the state, so they are never deleted
+	DisallowList = map[string]bool{"filtered-value": true}
+	state, err := destination.GetDestinationState()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]int64{testingSubject: {1}}, state)
+}
+
+// A minimal S3 compatible object store, keeping objects in memory by path
+type fakeObjectStore struct {
+	lock       sync.Mutex
+	objects    map[string][]byte
+	putHeaders map[string]http.Header
+}
+
+func newFakeObjectStore() *fakeObjectStore {
+	return &fakeObjectStore{objects: map[string][]byte{}, putHeaders: map[string]http.Header{}}
+}
+
+func (fs *fakeObjectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			body = decodeAwsChunked(body)
+		}
+		fs.objects[r.URL.Path] = body
+		fs.putHeaders[r.URL.Path] = r.Header
+		w.Header().Set("ETag", "\"etag\"")
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		contents, exists := fs.objects[r.URL.Path]
+		if !exists {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>"))
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(contents)))
+		w.Header().Set("ETag", "\"etag\"")
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		_, _ = w.Write(contents)
+	case http.MethodDelete:
+		delete(fs.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (fs *fakeObjectStore) keys() []string {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	keys := []string{}
+	for key := range fs.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Decodes a body sent with the aws-chunked content encoding
+func decodeAwsChunked(body []byte) []byte {
+	decoded := []byte{}
+	for len(body) > 0 {
+		headerEnd := bytes.Index(body, []byte("\r\n"))
+		size, err := strconv.ParseInt(strings.SplitN(string(body[:headerEnd]), ";", 2)[0], 16, 64)
+		if err != nil || size == 0 {
+			break
+		}
+		body = body[headerEnd+2:]
+		decoded = append(decoded, body[:size]...)
+		body = body[size+2:]
+	}
+	return decoded
+}
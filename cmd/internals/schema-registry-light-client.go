@@ -13,6 +13,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"sort"
 	"sync"
 	"time"
 )
@@ -537,3 +538,234 @@ func (src *SchemaRegistryClient) schemaIsRegisteredUnderSubject(subject string,
 
 	return true
 }
+
+// Returns the version the given schema is registered with under the subject, and whether it is registered at all
+func (src *SchemaRegistryClient) lookupSchemaVersion(subject string, schemaType string, schema string, references []SchemaReference) (int64, bool) {
+	endpoint := fmt.Sprintf("%s/subjects/%s", src.SRUrl, url.QueryEscape(subject))
+
+	schemaJSON, err := json.Marshal(SchemaToRegister{Schema: schema, SType: schemaType, References: references})
+	if err != nil {
+		log.Printf(err.Error())
+		return 0, false
+	}
+
+	req := GetNewRequest("POST", endpoint, src.SRApiKey, src.SRApiSecret, nil, bytes.NewReader(schemaJSON))
+	res, err := httpClient.Do(req)
+	if err != nil {
+		log.Printf(err.Error())
+		return 0, false
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, false
+	}
+
+	registered := SchemaRecord{}
+	if err := json.NewDecoder(res.Body).Decode(&registered); err != nil {
+		return 0, false
+	}
+	return registered.Version, true
+}
+
+// Tests the given schema against the latest version of the subject with the compatibility level of the subject,
+// returning false when the subject has no version to test against
+func (src *SchemaRegistryClient) TestCompatibility(subject string, schemaType string, schema string, references []SchemaReference) (CompatibilityResponse, bool, error) {
+	endpoint := fmt.Sprintf("%s/compatibility/subjects/%s/versions/latest?verbose=true", src.SRUrl, url.QueryEscape(subject))
+	result := CompatibilityResponse{}
+
+	schemaJSON, err := json.Marshal(SchemaToRegister{Schema: schema, SType: schemaType, References: references})
+	if err != nil {
+		return result, false, err
+	}
+
+	req := GetNewRequest("POST", endpoint, src.SRApiKey, src.SRApiSecret, nil, bytes.NewReader(schemaJSON))
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return result, false, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return result, false, err
+	}
+	if res.StatusCode != http.StatusOK {
+		errMsg := ErrorMessage{}
+		// Subject not found, or version not found
+		if json.Unmarshal(body, &errMsg) == nil && (errMsg.ErrorCode == 40401 || errMsg.ErrorCode == 40402) {
+			return result, false, nil
+		}
+		if err := errorFromResponse(body); err != nil {
+			return result, false, err
+		}
+		return result, false, fmt.Errorf(statusError, res.StatusCode, req.Method, endpoint)
+	}
+
+	err = json.Unmarshal(body, &result)
+	return result, true, err
+}
+
+// Returns the live versions of the given subject, oldest first, or none when the subject is not registered
+func (src *SchemaRegistryClient) getSubjectSchemas(subject string) ([]SchemaRecord, error) {
+	endpoint := fmt.Sprintf("%s/subjects/%s/versions", src.SRUrl, url.QueryEscape(subject))
+	req := GetNewRequest("GET", endpoint, src.SRApiKey, src.SRApiSecret, nil, nil)
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		errMsg := ErrorMessage{}
+		// Subject not found
+		if json.Unmarshal(body, &errMsg) == nil && errMsg.ErrorCode == 40401 {
+			return []SchemaRecord{}, nil
+		}
+		if err := errorFromResponse(body); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf(statusError, res.StatusCode, req.Method, endpoint)
+	}
+
+	versions := []int64{}
+	if err := json.Unmarshal(body, &versions); err != nil {
+		return nil, err
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	records := []SchemaRecord{}
+	for _, version := range versions {
+		records = append(records, src.GetSchema(subject, version, false))
+	}
+	return records, nil
+}
+
+// Returns the subject versions referencing the given subject version, soft deleted ones included
+func (src *SchemaRegistryClient) GetReferencedBy(subject string, version int64) ([]SubjectVersion, error) {
+	ids := []int64{}
+	endpoint := fmt.Sprintf("%s/subjects/%s/versions/%d/referencedby", src.SRUrl, url.QueryEscape(subject), version)
+	if err := src.getJson(endpoint, &ids); err != nil {
+		return nil, err
+	}
+
+	referencing := []SubjectVersion{}
+	for _, id := range ids {
+		subjectVersions := []SubjectVersion{}
+		if err := src.getJson(fmt.Sprintf("%s/schemas/ids/%d/versions", src.SRUrl, id), &subjectVersions); err != nil {
+			return nil, err
+		}
+		referencing = append(referencing, subjectVersions...)
+	}
+	return referencing, nil
+}
+
+// Decodes the response of a GET request to the given endpoint into the given value
+func (src *SchemaRegistryClient) getJson(endpoint string, value interface{}) error {
+	req := GetNewRequest("GET", endpoint, src.SRApiKey, src.SRApiSecret, nil, nil)
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		if err := errorFromResponse(body); err != nil {
+			return err
+		}
+		return fmt.Errorf(statusError, res.StatusCode, req.Method, endpoint)
+	}
+	return json.Unmarshal(body, value)
+}
+
+// Returns the compatibility level set for the given subject, or an empty string if the subject follows the global level
+func (src *SchemaRegistryClient) GetSubjectCompatibility(subject string) string {
+	return src.getSubjectLevel("config", subject)["compatibilityLevel"]
+}
+
+// Returns the mode set for the given subject, or an empty string if the subject follows the global mode
+func (src *SchemaRegistryClient) GetSubjectMode(subject string) string {
+	return src.getSubjectLevel("mode", subject)["mode"]
+}
+
+// Queries a subject level configuration endpoint, a subject without its own configuration returns an empty map
+func (src *SchemaRegistryClient) getSubjectLevel(end string, subject string) map[string]string {
+	endpoint := fmt.Sprintf("%s/%s/%s?defaultToGlobal=false", src.SRUrl, end, url.QueryEscape(subject))
+	req := GetNewRequest("GET", endpoint, src.SRApiKey, src.SRApiSecret, nil, nil)
+
+	response := map[string]string{}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		log.Printf(err.Error())
+		return response
+	}
+	defer res.Body.Close()
+
+	// No configuration has been set for this subject
+	if res.StatusCode == 404 {
+		return response
+	}
+	handleNotSuccess(res.Body, res.StatusCode, req.Method, endpoint)
+
+	body, err := ioutil.ReadAll(res.Body)
+	checkDontFail(err)
+
+	err = json.Unmarshal(body, &response)
+	checkDontFail(err)
+
+	return response
+}
+
+// Returns the global compatibility level of the backing Schema Registry
+func (src *SchemaRegistryClient) GetGlobalCompatibility() string {
+	response, _ := handleEndpointQuery("config", src)
+	return response["compatibilityLevel"]
+}
+
+// Returns the global mode of the backing Schema Registry
+func (src *SchemaRegistryClient) GetGlobalMode() string {
+	response, _ := handleEndpointQuery("mode", src)
+	return response["mode"]
+}
+
+// Allows to set a compatibility level for the given subject, returns true if successful
+func (src *SchemaRegistryClient) SetSubjectCompatibility(subject string, compatibility string) bool {
+	return src.putLevel(fmt.Sprintf("config/%s", url.QueryEscape(subject)), CompatRecord{Compatibility: compatibility})
+}
+
+// Allows to set a mode for the given subject, returns true if successful
+func (src *SchemaRegistryClient) SetSubjectMode(subject string, mode string) bool {
+	return src.putLevel(fmt.Sprintf("mode/%s", url.QueryEscape(subject)), ModeRecord{Mode: mode})
+}
+
+// Sends the given record to a configuration endpoint, returns true if successful
+func (src *SchemaRegistryClient) putLevel(end string, record interface{}) bool {
+	endpoint := fmt.Sprintf("%s/%s", src.SRUrl, end)
+
+	toSend, err := json.Marshal(record)
+	if err != nil {
+		log.Printf(err.Error())
+		return false
+	}
+
+	req := GetNewRequest("PUT", endpoint, src.SRApiKey, src.SRApiSecret, nil, bytes.NewReader(toSend))
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		log.Printf(err.Error())
+		return false
+	}
+	defer res.Body.Close()
+
+	handleNotSuccess(res.Body, res.StatusCode, req.Method, endpoint)
+
+	return res.StatusCode == 200
+}
@@ -0,0 +1,319 @@
+package client
+
+//
+// schemaLoadAvro.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+/*
+AVRO schema loads resolve every name an AVRO schema uses, at any depth: field types, unions, array items and
+map values, including those of records, arrays and maps defined inline. Names are resolved the way AVRO does:
+a name holding a dot is a full name, other names take the namespace of the closest enclosing named type.
+Names of types the schema defines inline, or their aliases, need no reference. Other names are references to
+schemas of the load, found by their full name or one of their aliases, in which case the schema is registered
+with the full name instead.
+Named types defined inline in a file become schemas of the load as well, so other files may reference them,
+unless a file of the load declares them. They are only registered when referenced.
+*/
+
+var avroFileExtensions = []string{".avsc", ".json", ".avdl", ".avpr"}
+
+func isAvroSchemaFile(path string) bool {
+	for _, extension := range avroFileExtensions {
+		if strings.HasSuffix(path, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the named types declared by the given schema (.avsc or .json), protocol (.avpr) or IDL (.avdl) file,
+// or an error listing every problem found in them by line
+func readAvroSchemaFile(path string) ([]map[string]interface{}, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var schemas []map[string]interface{}
+	lineOf := func(pointer string) int { return jsonLineOf(contents, pointer) }
+	switch filepath.Ext(path) {
+	case ".avdl":
+		var lines map[string]int
+		if schemas, lines, err = parseAvroIdl(string(contents)); err != nil {
+			return nil, err
+		}
+		lineOf = func(pointer string) int { return closestLineOf(lines, pointer) }
+	case ".avpr":
+		if schemas, err = parseAvroProtocol(contents); err != nil {
+			return nil, describeJsonError(contents, err)
+		}
+	default:
+		var schema map[string]interface{}
+		if err := json.Unmarshal(contents, &schema); err != nil {
+			return nil, describeJsonError(contents, err)
+		}
+		schemas = []map[string]interface{}{schema}
+	}
+
+	problems := []string{}
+	for i, schema := range schemas {
+		for _, problem := range validateAvroSchema(schema) {
+			pointer := problem.pointer
+			if filepath.Ext(path) == ".avdl" || filepath.Ext(path) == ".avpr" {
+				pointer = fmt.Sprintf("/types/%d%s", i, pointer)
+			}
+			problems = append(problems, fmt.Sprintf("line %d: #%s: %s", lineOf(pointer), pointer, problem.message))
+		}
+	}
+	if len(problems) != 0 {
+		return nil, fmt.Errorf("not a valid AVRO schema:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return schemas, nil
+}
+
+// Returns the line of the given JSON pointer in the given lines, or of its closest parent found
+func closestLineOf(lines map[string]int, pointer string) int {
+	for ; pointer != ""; pointer = pointer[:strings.LastIndex(pointer, "/")] {
+		if line, found := lines[pointer]; found {
+			return line
+		}
+	}
+	return 0
+}
+
+// Adds the line of syntax errors to the given JSON decoding error
+func describeJsonError(contents []byte, err error) error {
+	if syntaxError, isSyntaxError := err.(*json.SyntaxError); isSyntaxError {
+		return fmt.Errorf("line %d: %w", bytes.Count(contents[:syntaxError.Offset], []byte("\n"))+1, err)
+	}
+	return err
+}
+
+// Resolves the names an AVRO schema uses against the named types it defines
+type avroWalker struct {
+	defined    map[string]bool   // Full names and aliases of the named types defined by the schema
+	aliases    map[string]string // Full aliases of the named types of the load -> their full name
+	references []string          // Full names of the named types the schema references, in order of appearance
+}
+
+// Returns a walker for the given schema, with its named types defined
+func newAvroWalker(schema interface{}, aliases map[string]string) *avroWalker {
+	walker := &avroWalker{defined: map[string]bool{}, aliases: aliases, references: []string{}}
+	walkAvroNamedTypes(schema, "", func(fullName string, namespace string, definition map[string]interface{}) {
+		walker.defined[fullName] = true
+		for _, alias := range avroAliasesOf(definition, namespace) {
+			walker.defined[alias] = true
+		}
+	})
+	return walker
+}
+
+// Returns a copy of the given schema with names given by an alias replaced by their full name,
+// collecting the names referencing types the schema does not define
+func (aw *avroWalker) resolve(schema interface{}, namespace string) interface{} {
+	switch typed := schema.(type) {
+	case string:
+		if _, native := nativeTypes[typed]; native {
+			return typed
+		}
+		fullName := avroFullName(typed, namespace)
+		if aw.defined[fullName] {
+			return typed
+		}
+		if target, isAlias := aw.aliases[fullName]; isAlias && target != fullName {
+			log.Printf("Resolved %s to %s through one of its aliases", fullName, target)
+			fullName = target
+			typed = target
+		}
+		if !stringIsInSlice(fullName, aw.references) {
+			aw.references = append(aw.references, fullName)
+		}
+		return typed
+	case []interface{}:
+		resolved := make([]interface{}, len(typed))
+		for i, oneType := range typed {
+			resolved[i] = aw.resolve(oneType, namespace)
+		}
+		return resolved
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(typed))
+		for key, value := range typed {
+			resolved[key] = value
+		}
+		switch typed["type"] {
+		case "record", "error":
+			recordNamespace := avroNamespaceOf(typed, namespace)
+			if fields, isArray := typed["fields"].([]interface{}); isArray {
+				resolvedFields := make([]interface{}, len(fields))
+				for i, field := range fields {
+					resolvedFields[i] = field
+					if fieldMap, isMap := field.(map[string]interface{}); isMap {
+						resolvedField := make(map[string]interface{}, len(fieldMap))
+						for key, value := range fieldMap {
+							resolvedField[key] = value
+						}
+						resolvedField["type"] = aw.resolve(fieldMap["type"], recordNamespace)
+						resolvedFields[i] = resolvedField
+					}
+				}
+				resolved["fields"] = resolvedFields
+			}
+		case "enum", "fixed":
+		case "array":
+			resolved["items"] = aw.resolve(typed["items"], namespace)
+		case "map":
+			resolved["values"] = aw.resolve(typed["values"], namespace)
+		default:
+			// A type with attributes, such as a logical type, or a name given as {"type": "com.mycorp.Name"}
+			if oneType, exists := typed["type"]; exists {
+				resolved["type"] = aw.resolve(oneType, namespace)
+			}
+		}
+		return resolved
+	}
+	return schema
+}
+
+// Calls visit with every named type (record, error, enum or fixed) the given schema defines, at any depth,
+// along with its full name and namespace
+func walkAvroNamedTypes(schema interface{}, namespace string, visit func(fullName string, namespace string, definition map[string]interface{})) {
+	switch typed := schema.(type) {
+	case []interface{}:
+		for _, oneType := range typed {
+			walkAvroNamedTypes(oneType, namespace, visit)
+		}
+	case map[string]interface{}:
+		switch typed["type"] {
+		case "record", "error", "enum", "fixed":
+			name, _ := typed["name"].(string)
+			typeNamespace := avroNamespaceOf(typed, namespace)
+			if name != "" {
+				visit(avroFullName(name, typeNamespace), typeNamespace, typed)
+			}
+			if fields, isArray := typed["fields"].([]interface{}); isArray {
+				for _, field := range fields {
+					if fieldMap, isMap := field.(map[string]interface{}); isMap {
+						walkAvroNamedTypes(fieldMap["type"], typeNamespace, visit)
+					}
+				}
+			}
+		case "array":
+			walkAvroNamedTypes(typed["items"], namespace, visit)
+		case "map":
+			walkAvroNamedTypes(typed["values"], namespace, visit)
+		default:
+			walkAvroNamedTypes(typed["type"], namespace, visit)
+		}
+	}
+}
+
+// Returns the full name of the given name used within the given namespace
+func avroFullName(name string, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// Returns the namespace of the given named type, defined within the given namespace
+func avroNamespaceOf(definition map[string]interface{}, namespace string) string {
+	name, _ := definition["name"].(string)
+	if lastDot := strings.LastIndex(name, "."); lastDot != -1 {
+		return name[:lastDot]
+	}
+	if ownNamespace, hasNamespace := definition["namespace"].(string); hasNamespace {
+		return ownNamespace
+	}
+	return namespace
+}
+
+// Returns the full names of the aliases of the given named type
+func avroAliasesOf(definition map[string]interface{}, namespace string) []string {
+	aliases := []string{}
+	if declared, isArray := definition["aliases"].([]interface{}); isArray {
+		for _, alias := range declared {
+			if aliasName, isString := alias.(string); isString {
+				aliases = append(aliases, avroFullName(aliasName, namespace))
+			}
+		}
+	}
+	return aliases
+}
+
+// Adds the named types defined inline in the files of the load as schemas of the load, unless a file declares
+// them, and indexes the aliases of every schema. A type defined inline gets a new version every time its
+// definition changes between the versions of the schema defining it.
+func (sl *SchemaLoader) indexAvroNamedTypes() {
+	sl.inlineTypes = map[SchemaDescriptor]bool{}
+	sl.avroAliases = map[string]string{}
+
+	for _, desc := range sortedDescriptors(descriptorSet(sl.schemaRecords)) {
+		versions := sl.schemaRecords[desc]
+		for version := int64(0); version < int64(len(versions)); version++ {
+			walkAvroNamedTypes(versions[version], "", func(fullName string, namespace string, definition map[string]interface{}) {
+				inlineDesc := GetAvroSchemaDescriptor(fullName)
+				if inlineDesc == desc || inlineDesc.name == "" {
+					return
+				}
+				if _, declaredByFile := sl.schemaRecords[inlineDesc]; declaredByFile && !sl.inlineTypes[inlineDesc] {
+					return
+				}
+				sl.addInlineVersion(inlineDesc, definition, sl.schemaFiles[desc][version])
+			})
+		}
+	}
+
+	for desc, versions := range sl.schemaRecords {
+		latest := versions[int64(len(versions)-1)]
+		for _, alias := range avroAliasesOf(latest, desc.namespace) {
+			sl.avroAliases[alias] = fullNameOf(desc)
+		}
+	}
+}
+
+// Adds the given definition of a named type found inline in the given file as its next version, if it changed
+func (sl *SchemaLoader) addInlineVersion(desc SchemaDescriptor, definition map[string]interface{}, file string) {
+	standalone := make(map[string]interface{}, len(definition))
+	for key, value := range definition {
+		standalone[key] = value
+	}
+	standalone["name"] = desc.name
+	standalone["namespace"] = desc.namespace
+
+	if !sl.inlineTypes[desc] {
+		sl.inlineTypes[desc] = true
+		sl.schemaRecords[desc] = map[int64]map[string]interface{}{}
+		sl.schemaFiles[desc] = map[int64]string{}
+	}
+	versions := sl.schemaRecords[desc]
+	if len(versions) != 0 {
+		previous, err := json.Marshal(versions[int64(len(versions)-1)])
+		check(err)
+		current, err := json.Marshal(standalone)
+		check(err)
+		if string(previous) == string(current) {
+			return
+		}
+	}
+	sl.schemaRecords[desc][int64(len(versions))] = standalone
+	sl.schemaFiles[desc][int64(len(versions))] = file
+}
+
+func descriptorSet(records map[SchemaDescriptor]map[int64]map[string]interface{}) map[SchemaDescriptor]bool {
+	descriptors := map[SchemaDescriptor]bool{}
+	for desc := range records {
+		descriptors[desc] = true
+	}
+	return descriptors
+}
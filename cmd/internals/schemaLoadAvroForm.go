@@ -0,0 +1,205 @@
+package client
+
+//
+// schemaLoadAvroForm.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+AVRO schema loads register schemas in one of two forms, chosen with -avroSchemaForm, so that a schema read
+from differently written files is always registered the same way and never creates a new version:
+	NORMALIZED  the schema as written, without whitespace, the attributes of every type and field in a fixed
+	            order (type, name, namespace, doc, aliases, fields...), other attributes sorted by name
+	CANONICAL   the Parsing Canonical Form of the AVRO specification: full names, no namespace, doc, aliases,
+	            defaults or logical types. As defaults and logical types are dropped, it suits registries
+	            only holding schemas for comparison
+*/
+
+// Define AvroSchemaForm enum
+type AvroSchemaForm int
+
+const (
+	NORMALIZED AvroSchemaForm = iota
+	CANONICAL
+)
+
+func (asf AvroSchemaForm) String() string {
+	return [...]string{"NORMALIZED", "CANONICAL"}[asf]
+}
+
+func ParseAvroSchemaForm(form string) (AvroSchemaForm, error) {
+	switch strings.ToUpper(form) {
+	case "", NORMALIZED.String():
+		return NORMALIZED, nil
+	case CANONICAL.String():
+		return CANONICAL, nil
+	}
+	return NORMALIZED, fmt.Errorf("unknown AVRO schema form %s, expected one of NORMALIZED or CANONICAL", form)
+}
+
+// Order of the attributes of types and fields in the NORMALIZED form, other attributes following sorted by name
+var avroTypeAttributeOrder = []string{"type", "name", "namespace", "doc", "aliases", "fields", "symbols", "items",
+	"values", "size", "default", "logicalType", "precision", "scale"}
+var avroFieldAttributeOrder = []string{"name", "type", "doc", "default", "order", "aliases"}
+
+// Order of the attributes kept by the Parsing Canonical Form
+var avroCanonicalAttributeOrder = []string{"name", "type", "fields", "symbols", "items", "values", "size"}
+
+// Returns the given schema in the given form
+func avroSchemaInForm(schema interface{}, form AvroSchemaForm) string {
+	var written bytes.Buffer
+	if form == CANONICAL {
+		writeAvroCanonicalForm(&written, schema, "")
+	} else {
+		writeAvroNormalizedForm(&written, schema, avroTypeAttributeOrder)
+	}
+	return written.String()
+}
+
+func writeAvroNormalizedForm(written *bytes.Buffer, schema interface{}, attributeOrder []string) {
+	switch typed := schema.(type) {
+	case []interface{}:
+		written.WriteString("[")
+		for i, member := range typed {
+			if i != 0 {
+				written.WriteString(",")
+			}
+			writeAvroNormalizedForm(written, member, avroTypeAttributeOrder)
+		}
+		written.WriteString("]")
+	case map[string]interface{}:
+		written.WriteString("{")
+		for i, key := range orderedAttributes(typed, attributeOrder) {
+			if i != 0 {
+				written.WriteString(",")
+			}
+			writeJsonValue(written, key)
+			written.WriteString(":")
+			switch key {
+			case "type", "items", "values":
+				writeAvroNormalizedForm(written, typed[key], avroTypeAttributeOrder)
+			case "fields":
+				fields, _ := typed[key].([]interface{})
+				written.WriteString("[")
+				for j, field := range fields {
+					if j != 0 {
+						written.WriteString(",")
+					}
+					writeAvroNormalizedForm(written, field, avroFieldAttributeOrder)
+				}
+				written.WriteString("]")
+			default:
+				writeJsonValue(written, typed[key])
+			}
+		}
+		written.WriteString("}")
+	default:
+		writeJsonValue(written, schema)
+	}
+}
+
+// Returns the attributes of the given object, the given attributes first in their order, then the others sorted
+func orderedAttributes(object map[string]interface{}, order []string) []string {
+	attributes := []string{}
+	for _, attribute := range order {
+		if _, exists := object[attribute]; exists {
+			attributes = append(attributes, attribute)
+		}
+	}
+	others := []string{}
+	for attribute := range object {
+		if !stringIsInSlice(attribute, order) {
+			others = append(others, attribute)
+		}
+	}
+	sort.Strings(others)
+	return append(attributes, others...)
+}
+
+func writeAvroCanonicalForm(written *bytes.Buffer, schema interface{}, namespace string) {
+	switch typed := schema.(type) {
+	case string:
+		if avroPrimitiveTypes[typed] {
+			writeJsonValue(written, typed)
+		} else {
+			writeJsonValue(written, avroFullName(typed, namespace))
+		}
+	case []interface{}:
+		written.WriteString("[")
+		for i, member := range typed {
+			if i != 0 {
+				written.WriteString(",")
+			}
+			writeAvroCanonicalForm(written, member, namespace)
+		}
+		written.WriteString("]")
+	case map[string]interface{}:
+		oneType := typed["type"]
+		switch oneType {
+		case "record", "error", "enum", "fixed", "array", "map":
+		default:
+			// Primitive types with attributes, and names given as objects, are written as their type
+			writeAvroCanonicalForm(written, oneType, namespace)
+			return
+		}
+
+		typeNamespace := avroNamespaceOf(typed, namespace)
+		written.WriteString("{")
+		first := true
+		for _, key := range avroCanonicalAttributeOrder {
+			if _, exists := typed[key]; !exists {
+				continue
+			}
+			if !first {
+				written.WriteString(",")
+			}
+			first = false
+			writeJsonValue(written, key)
+			written.WriteString(":")
+			switch key {
+			case "name":
+				name, _ := typed["name"].(string)
+				writeJsonValue(written, avroFullName(name, typeNamespace))
+			case "fields":
+				fields, _ := typed["fields"].([]interface{})
+				written.WriteString("[")
+				for j, field := range fields {
+					fieldMap, _ := field.(map[string]interface{})
+					if j != 0 {
+						written.WriteString(",")
+					}
+					written.WriteString(`{"name":`)
+					writeJsonValue(written, fieldMap["name"])
+					written.WriteString(`,"type":`)
+					writeAvroCanonicalForm(written, fieldMap["type"], typeNamespace)
+					written.WriteString("}")
+				}
+				written.WriteString("]")
+			case "items", "values":
+				writeAvroCanonicalForm(written, typed[key], namespace)
+			default:
+				writeJsonValue(written, typed[key])
+			}
+		}
+		written.WriteString("}")
+	default:
+		writeJsonValue(written, schema)
+	}
+}
+
+// Writes the given JSON value without whitespace, and without escaping HTML characters
+func writeJsonValue(written *bytes.Buffer, value interface{}) {
+	encoder := json.NewEncoder(written)
+	encoder.SetEscapeHTML(false)
+	check(encoder.Encode(value))
+	// Encode ends values with a newline
+	written.Truncate(written.Len() - 1)
+}
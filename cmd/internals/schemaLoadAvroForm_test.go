@@ -0,0 +1,74 @@
+package client
+
+//
+// schemaLoadAvroForm_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackSchemaLoadAvroForm(t *testing.T) {
+	t.Run("TParseAvroSchemaForm", func(t *testing.T) { TParseAvroSchemaForm(t) })
+	t.Run("TAvroNormalizedForm", func(t *testing.T) { TAvroNormalizedForm(t) })
+	t.Run("TAvroCanonicalForm", func(t *testing.T) { TAvroCanonicalForm(t) })
+}
+
+func avroSchemaOf(t *testing.T, schema string) interface{} {
+	var parsed interface{}
+	assert.Nil(t, json.Unmarshal([]byte(schema), &parsed))
+	return parsed
+}
+
+func TParseAvroSchemaForm(t *testing.T) {
+	form, err := ParseAvroSchemaForm("")
+	assert.Nil(t, err)
+	assert.Equal(t, NORMALIZED, form)
+	form, err = ParseAvroSchemaForm("canonical")
+	assert.Nil(t, err)
+	assert.Equal(t, CANONICAL, form)
+	_, err = ParseAvroSchemaForm("PRETTY")
+	assert.NotNil(t, err)
+}
+
+func TAvroNormalizedForm(t *testing.T) {
+	written := avroSchemaOf(t, `{
+		"fields": [
+			{"type": "string", "doc": "<id>", "name": "id"},
+			{"default": [], "name": "lines", "type": {"items": "Line", "type": "array"}}
+		],
+		"name": "Order",
+		"namespace": "com.acme",
+		"type": "record",
+		"x-owner": "sales"
+	}`)
+	reordered := avroSchemaOf(t, `{"type":"record","x-owner":"sales","namespace":"com.acme","name":"Order","fields":[
+		{"name":"id","doc":"<id>","type":"string"},{"type":{"type":"array","items":"Line"},"name":"lines","default":[]}]}`)
+
+	expected := `{"type":"record","name":"Order","namespace":"com.acme","fields":[{"name":"id","type":"string","doc":"<id>"},` +
+		`{"name":"lines","type":{"type":"array","items":"Line"},"default":[]}],"x-owner":"sales"}`
+	assert.Equal(t, expected, avroSchemaInForm(written, NORMALIZED))
+	assert.Equal(t, expected, avroSchemaInForm(reordered, NORMALIZED))
+}
+
+func TAvroCanonicalForm(t *testing.T) {
+	schema := avroSchemaOf(t, `{"type":"record","name":"Order","namespace":"com.acme","doc":"An order","aliases":["Purchase"],"fields":[
+		{"name":"id","type":{"type":"string","logicalType":"uuid"},"doc":"Identifier"},
+		{"name":"status","type":{"type":"enum","name":"Status","symbols":["OPEN","CLOSED"],"default":"OPEN"}},
+		{"name":"hash","type":{"type":"fixed","name":"Hash","namespace":"com.acme.crypto","size":16}},
+		{"name":"previous","type":["null","Order"],"default":null},
+		{"name":"tags","type":{"type":"map","values":{"type":"array","items":"Status"}}}
+	]}`)
+
+	assert.Equal(t, `{"name":"com.acme.Order","type":"record","fields":[{"name":"id","type":"string"},`+
+		`{"name":"status","type":{"name":"com.acme.Status","type":"enum","symbols":["OPEN","CLOSED"]}},`+
+		`{"name":"hash","type":{"name":"com.acme.crypto.Hash","type":"fixed","size":16}},`+
+		`{"name":"previous","type":["null","com.acme.Order"]},`+
+		`{"name":"tags","type":{"type":"map","values":{"type":"array","items":"com.acme.Status"}}}]}`,
+		avroSchemaInForm(schema, CANONICAL))
+	assert.Equal(t, `"long"`, avroSchemaInForm(avroSchemaOf(t, `{"type":"long"}`), CANONICAL))
+}
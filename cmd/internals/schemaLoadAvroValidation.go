@@ -0,0 +1,512 @@
+package client
+
+//
+// schemaLoadAvroValidation.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+AVRO schema loads check every schema before registering it, so a malformed file is reported with every
+problem found, by line and JSON pointer, instead of being rejected by Schema Registry. The checks cover
+names and namespaces, the structure of records, enums, fixed types, arrays, maps and unions, defaults
+matching the type of their field (the first type of unions), and logical types applying to the right types.
+Names of types the schema does not define are references, checked when the schema is registered.
+*/
+
+var avroNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var avroPrimitiveTypes = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true, "float": true, "double": true, "bytes": true, "string": true,
+}
+
+// Types each logical type applies to
+var avroLogicalTypeBases = map[string][]string{
+	"decimal":                {"bytes", "fixed"},
+	"uuid":                   {"string", "fixed"},
+	"date":                   {"int"},
+	"time-millis":            {"int"},
+	"time-micros":            {"long"},
+	"timestamp-millis":       {"long"},
+	"timestamp-micros":       {"long"},
+	"timestamp-nanos":        {"long"},
+	"local-timestamp-millis": {"long"},
+	"local-timestamp-micros": {"long"},
+	"local-timestamp-nanos":  {"long"},
+	"duration":               {"fixed"},
+}
+
+var avroFieldOrders = map[string]bool{"ascending": true, "descending": true, "ignore": true}
+
+// A problem found in a schema, at the given JSON pointer
+type avroProblem struct {
+	pointer string
+	message string
+}
+
+type avroValidator struct {
+	defined  map[string]map[string]interface{} // Full name -> definition of the named types defined by the schema
+	problems []avroProblem
+}
+
+// Returns the problems found in the given schema
+func validateAvroSchema(schema interface{}) []avroProblem {
+	validator := &avroValidator{defined: map[string]map[string]interface{}{}, problems: []avroProblem{}}
+	validator.validate(schema, "", "")
+	return validator.problems
+}
+
+func (av *avroValidator) report(pointer string, format string, args ...interface{}) {
+	av.problems = append(av.problems, avroProblem{pointer: pointer, message: fmt.Sprintf(format, args...)})
+}
+
+func (av *avroValidator) validate(schema interface{}, namespace string, pointer string) {
+	switch typed := schema.(type) {
+	case string:
+		if _, native := nativeTypes[typed]; !native && !isValidAvroFullName(typed) {
+			av.report(pointer, "invalid type name %q", typed)
+		}
+	case []interface{}:
+		av.validateUnion(typed, namespace, pointer)
+	case map[string]interface{}:
+		oneType, hasType := typed["type"]
+		if !hasType {
+			av.report(pointer, "a schema object must have a type")
+			return
+		}
+		switch oneType {
+		case "record", "error":
+			recordNamespace := av.validateNamedType(typed, namespace, pointer)
+			av.validateFields(typed, recordNamespace, pointer)
+		case "enum":
+			av.validateNamedType(typed, namespace, pointer)
+			av.validateEnum(typed, pointer)
+		case "fixed":
+			av.validateNamedType(typed, namespace, pointer)
+			if size, isInteger := avroInteger(typed["size"]); !isInteger || size < 0 {
+				av.report(pointer+"/size", "the size of a fixed type must be a non-negative integer")
+			}
+		case "array":
+			if items, hasItems := typed["items"]; hasItems {
+				av.validate(items, namespace, pointer+"/items")
+			} else {
+				av.report(pointer, "an array must have items")
+			}
+		case "map":
+			if values, hasValues := typed["values"]; hasValues {
+				av.validate(values, namespace, pointer+"/values")
+			} else {
+				av.report(pointer, "a map must have values")
+			}
+		default:
+			av.validate(oneType, namespace, pointer+"/type")
+		}
+		av.validateLogicalType(typed, pointer)
+	default:
+		av.report(pointer, "a schema must be a type name, a union or an object")
+	}
+}
+
+func (av *avroValidator) validateUnion(union []interface{}, namespace string, pointer string) {
+	if len(union) == 0 {
+		av.report(pointer, "a union must hold at least one type")
+	}
+	seen := map[string]bool{}
+	for i, member := range union {
+		memberPointer := fmt.Sprintf("%s/%d", pointer, i)
+		if _, isUnion := member.([]interface{}); isUnion {
+			av.report(memberPointer, "a union may not hold another union")
+			continue
+		}
+		av.validate(member, namespace, memberPointer)
+		key := avroUnionKey(member, namespace)
+		if seen[key] {
+			av.report(memberPointer, "the union holds %s twice", key)
+		}
+		seen[key] = true
+	}
+}
+
+// Returns what identifies a type in a union: its name for named types, its type otherwise
+func avroUnionKey(member interface{}, namespace string) string {
+	switch typed := member.(type) {
+	case string:
+		if avroPrimitiveTypes[typed] {
+			return typed
+		}
+		return avroFullName(typed, namespace)
+	case map[string]interface{}:
+		switch typed["type"] {
+		case "record", "error", "enum", "fixed":
+			name, _ := typed["name"].(string)
+			return avroFullName(name, avroNamespaceOf(typed, namespace))
+		}
+		return avroUnionKey(typed["type"], namespace)
+	}
+	return fmt.Sprintf("%v", member)
+}
+
+// Checks the name and namespace of a named type, returning its namespace
+func (av *avroValidator) validateNamedType(definition map[string]interface{}, namespace string, pointer string) string {
+	if ownNamespace, hasNamespace := definition["namespace"]; hasNamespace {
+		namespaceString, isString := ownNamespace.(string)
+		if !isString || (namespaceString != "" && !isValidAvroFullName(namespaceString)) {
+			av.report(pointer+"/namespace", "invalid namespace %v", ownNamespace)
+		}
+	}
+	typeNamespace := avroNamespaceOf(definition, namespace)
+
+	name, isString := definition["name"].(string)
+	if !isString || !isValidAvroFullName(name) {
+		av.report(pointer+"/name", "a %v must have a valid name, found %v", definition["type"], definition["name"])
+		return typeNamespace
+	}
+	fullName := avroFullName(name, typeNamespace)
+	if _, defined := av.defined[fullName]; defined {
+		av.report(pointer+"/name", "%s is defined twice", fullName)
+	}
+	av.defined[fullName] = definition
+	return typeNamespace
+}
+
+func (av *avroValidator) validateFields(record map[string]interface{}, namespace string, pointer string) {
+	fields, isArray := record["fields"].([]interface{})
+	if !isArray {
+		av.report(pointer, "a record must have an array of fields")
+		return
+	}
+	names := map[string]bool{}
+	for i, field := range fields {
+		fieldPointer := fmt.Sprintf("%s/fields/%d", pointer, i)
+		fieldMap, isMap := field.(map[string]interface{})
+		if !isMap {
+			av.report(fieldPointer, "a field must be an object")
+			continue
+		}
+		name, isString := fieldMap["name"].(string)
+		if !isString || !avroNamePattern.MatchString(name) {
+			av.report(fieldPointer+"/name", "invalid field name %v", fieldMap["name"])
+		} else if names[name] {
+			av.report(fieldPointer+"/name", "field %s is defined twice", name)
+		}
+		names[name] = true
+
+		fieldType, hasType := fieldMap["type"]
+		if !hasType {
+			av.report(fieldPointer, "field %v must have a type", fieldMap["name"])
+			continue
+		}
+		av.validate(fieldType, namespace, fieldPointer+"/type")
+		if order, hasOrder := fieldMap["order"]; hasOrder {
+			if orderString, isString := order.(string); !isString || !avroFieldOrders[orderString] {
+				av.report(fieldPointer+"/order", "the order of a field must be ascending, descending or ignore")
+			}
+		}
+		if defaultValue, hasDefault := fieldMap["default"]; hasDefault {
+			if problem := av.defaultProblem(fieldType, defaultValue, namespace); problem != "" {
+				av.report(fieldPointer+"/default", "%s", problem)
+			}
+		}
+	}
+}
+
+func (av *avroValidator) validateEnum(enum map[string]interface{}, pointer string) {
+	symbols, isArray := enum["symbols"].([]interface{})
+	if !isArray {
+		av.report(pointer, "an enum must have an array of symbols")
+		return
+	}
+	seen := map[string]bool{}
+	for i, symbol := range symbols {
+		symbolString, isString := symbol.(string)
+		if !isString || !avroNamePattern.MatchString(symbolString) {
+			av.report(fmt.Sprintf("%s/symbols/%d", pointer, i), "invalid symbol %v", symbol)
+		} else if seen[symbolString] {
+			av.report(fmt.Sprintf("%s/symbols/%d", pointer, i), "symbol %s is listed twice", symbolString)
+		}
+		seen[symbolString] = true
+	}
+	if defaultSymbol, hasDefault := enum["default"]; hasDefault {
+		if symbolString, isString := defaultSymbol.(string); !isString || !seen[symbolString] {
+			av.report(pointer+"/default", "the default %v is not a symbol of the enum", defaultSymbol)
+		}
+	}
+}
+
+func (av *avroValidator) validateLogicalType(schema map[string]interface{}, pointer string) {
+	logicalType, isString := schema["logicalType"].(string)
+	bases, known := avroLogicalTypeBases[logicalType]
+	if !isString || !known {
+		// Unknown logical types are ignored by AVRO, leaving the underlying type
+		return
+	}
+	baseType, _ := schema["type"].(string)
+	if !stringIsInSlice(baseType, bases) {
+		av.report(pointer+"/logicalType", "the %s logical type applies to %s, not %v", logicalType, strings.Join(bases, " or "), schema["type"])
+		return
+	}
+
+	size, _ := avroInteger(schema["size"])
+	switch {
+	case logicalType == "decimal":
+		precision, isInteger := avroInteger(schema["precision"])
+		if !isInteger || precision <= 0 {
+			av.report(pointer+"/precision", "the precision of a decimal must be a positive integer")
+			return
+		}
+		scale, hasScale := int64(0), false
+		if _, hasScale = schema["scale"]; hasScale {
+			if scale, isInteger = avroInteger(schema["scale"]); !isInteger || scale < 0 || scale > precision {
+				av.report(pointer+"/scale", "the scale of a decimal must be an integer between 0 and its precision")
+			}
+		}
+		if baseType == "fixed" && float64(precision) > math.Floor(math.Log10(math.Pow(2, float64(8*size-1))-1)) {
+			av.report(pointer+"/precision", "a fixed type of %d bytes can not hold a precision of %d", size, precision)
+		}
+	case logicalType == "uuid" && baseType == "fixed" && size != 16:
+		av.report(pointer+"/size", "a uuid fixed type must have a size of 16")
+	case logicalType == "duration" && size != 12:
+		av.report(pointer+"/size", "a duration fixed type must have a size of 12")
+	}
+}
+
+// Returns why the given default does not match the given type, or an empty string if it does
+func (av *avroValidator) defaultProblem(schema interface{}, value interface{}, namespace string) string {
+	mismatch := func(typeName string) string {
+		return fmt.Sprintf("the default %s does not match the type %s", mustMarshal(value), typeName)
+	}
+
+	switch typed := schema.(type) {
+	case string:
+		if definition, defined := av.defined[avroFullName(typed, namespace)]; defined && !avroPrimitiveTypes[typed] {
+			return av.defaultProblem(definition, value, namespace)
+		}
+		if !avroPrimitiveTypes[typed] {
+			// A referenced type, checked when registered
+			return ""
+		}
+		if !avroPrimitiveDefaultMatches(typed, value) {
+			return mismatch(typed)
+		}
+	case []interface{}:
+		// Defaults of unions match their first type
+		if len(typed) != 0 {
+			return av.defaultProblem(typed[0], value, namespace)
+		}
+	case map[string]interface{}:
+		switch typed["type"] {
+		case "record", "error":
+			object, isObject := value.(map[string]interface{})
+			if !isObject {
+				return mismatch(fmt.Sprintf("%v", typed["name"]))
+			}
+			recordNamespace := avroNamespaceOf(typed, namespace)
+			fields, _ := typed["fields"].([]interface{})
+			for _, field := range fields {
+				fieldMap, _ := field.(map[string]interface{})
+				fieldValue, hasValue := object[fmt.Sprintf("%v", fieldMap["name"])]
+				if !hasValue {
+					if _, fieldHasDefault := fieldMap["default"]; !fieldHasDefault {
+						return fmt.Sprintf("the default %s misses field %v", mustMarshal(value), fieldMap["name"])
+					}
+					continue
+				}
+				if problem := av.defaultProblem(fieldMap["type"], fieldValue, recordNamespace); problem != "" {
+					return problem
+				}
+			}
+		case "enum":
+			symbol, isString := value.(string)
+			symbols, _ := typed["symbols"].([]interface{})
+			if !isString || !stringIsInSlice(symbol, avroStrings(symbols)) {
+				return mismatch(fmt.Sprintf("%v", typed["name"]))
+			}
+		case "fixed":
+			if _, isString := value.(string); !isString {
+				return mismatch(fmt.Sprintf("%v", typed["name"]))
+			}
+		case "array":
+			items, isArray := value.([]interface{})
+			if !isArray {
+				return mismatch("array")
+			}
+			for _, item := range items {
+				if problem := av.defaultProblem(typed["items"], item, namespace); problem != "" {
+					return problem
+				}
+			}
+		case "map":
+			values, isObject := value.(map[string]interface{})
+			if !isObject {
+				return mismatch("map")
+			}
+			for _, key := range sortedKeys(values) {
+				if problem := av.defaultProblem(typed["values"], values[key], namespace); problem != "" {
+					return problem
+				}
+			}
+		default:
+			return av.defaultProblem(typed["type"], value, namespace)
+		}
+	}
+	return ""
+}
+
+func avroPrimitiveDefaultMatches(primitive string, value interface{}) bool {
+	switch primitive {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, isBool := value.(bool)
+		return isBool
+	case "int":
+		integer, isInteger := avroInteger(value)
+		return isInteger && integer >= math.MinInt32 && integer <= math.MaxInt32
+	case "long":
+		_, isInteger := avroInteger(value)
+		return isInteger
+	case "float", "double":
+		_, isNumber := avroNumber(value)
+		return isNumber
+	case "bytes", "string":
+		_, isString := value.(string)
+		return isString
+	}
+	return false
+}
+
+// Returns the given JSON value as a number, as decoded from JSON or read from AVRO IDL
+func avroNumber(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case float64:
+		return number, true
+	case int64:
+		return float64(number), true
+	case int:
+		return float64(number), true
+	case json.Number:
+		parsed, err := number.Float64()
+		return parsed, err == nil
+	}
+	return 0, false
+}
+
+func avroInteger(value interface{}) (int64, bool) {
+	number, isNumber := avroNumber(value)
+	if !isNumber || number != math.Trunc(number) {
+		return 0, false
+	}
+	return int64(number), true
+}
+
+func avroStrings(values []interface{}) []string {
+	stringValues := []string{}
+	for _, value := range values {
+		if valueString, isString := value.(string); isString {
+			stringValues = append(stringValues, valueString)
+		}
+	}
+	return stringValues
+}
+
+func mustMarshal(value interface{}) []byte {
+	valueJson, err := json.Marshal(value)
+	check(err)
+	return valueJson
+}
+
+// Returns whether the given name is a valid AVRO name, possibly qualified by a namespace
+func isValidAvroFullName(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if !avroNamePattern.MatchString(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the line of the value at the given JSON pointer in the given JSON contents, or of its closest
+// parent found, or 0 if the contents can not be read
+func jsonLineOf(contents []byte, pointer string) int {
+	type container struct {
+		object    bool
+		key       string
+		index     int
+		expectKey bool
+	}
+	stack := []*container{}
+	currentPointer := func() string {
+		var current strings.Builder
+		for _, frame := range stack {
+			if frame.object {
+				current.WriteString("/" + escapeJsonPointer(frame.key))
+			} else {
+				current.WriteString("/" + strconv.Itoa(frame.index))
+			}
+		}
+		return current.String()
+	}
+	valueDone := func() {
+		if len(stack) != 0 {
+			if top := stack[len(stack)-1]; top.object {
+				top.expectKey = true
+			} else {
+				top.index++
+			}
+		}
+	}
+
+	closestLine := 0
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	for {
+		start := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			return closestLine
+		}
+		if delim, isDelim := token.(json.Delim); isDelim && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			valueDone()
+			continue
+		}
+		if len(stack) != 0 && stack[len(stack)-1].object && stack[len(stack)-1].expectKey {
+			stack[len(stack)-1].key, _ = token.(string)
+			stack[len(stack)-1].expectKey = false
+			continue
+		}
+
+		// The token starts a value
+		valuePointer := currentPointer()
+		if valuePointer == pointer {
+			return lineAtOffset(contents, start)
+		}
+		if strings.HasPrefix(pointer, valuePointer+"/") || valuePointer == "" {
+			closestLine = lineAtOffset(contents, start)
+		}
+		switch token {
+		case json.Delim('{'):
+			stack = append(stack, &container{object: true, expectKey: true})
+		case json.Delim('['):
+			stack = append(stack, &container{})
+		default:
+			valueDone()
+		}
+	}
+}
+
+// Returns the line of the first value starting at or after the given offset
+func lineAtOffset(contents []byte, offset int64) int {
+	for offset < int64(len(contents)) && strings.ContainsRune(" \t\r\n,:", rune(contents[offset])) {
+		offset++
+	}
+	return bytes.Count(contents[:offset], []byte("\n")) + 1
+}
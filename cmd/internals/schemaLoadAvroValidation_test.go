@@ -0,0 +1,149 @@
+package client
+
+//
+// schemaLoadAvroValidation_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackSchemaLoadAvroValidation(t *testing.T) {
+	t.Run("TValidateAvroSchema", func(t *testing.T) { TValidateAvroSchema(t) })
+	t.Run("TValidateAvroDefaults", func(t *testing.T) { TValidateAvroDefaults(t) })
+	t.Run("TValidateAvroLogicalTypes", func(t *testing.T) { TValidateAvroLogicalTypes(t) })
+	t.Run("TAvroProblemsByLine", func(t *testing.T) { TAvroProblemsByLine(t) })
+}
+
+// Returns the problems found in the given schema, as pointer: message
+func avroProblemsOf(t *testing.T, schema string) []string {
+	var parsed interface{}
+	assert.Nil(t, json.Unmarshal([]byte(schema), &parsed))
+	problems := []string{}
+	for _, problem := range validateAvroSchema(parsed) {
+		problems = append(problems, "#"+problem.pointer+": "+problem.message)
+	}
+	return problems
+}
+
+func TValidateAvroSchema(t *testing.T) {
+	assert.Equal(t, []string{}, avroProblemsOf(t, nestedAvroSchema))
+
+	assert.Equal(t, []string{
+		"#/namespace: invalid namespace com.1acme",
+		"#/fields/0/name: invalid field name my-field",
+		"#/fields/1/type/1: a union may not hold another union",
+		"#/fields/1/type/3: the union holds string twice",
+		"#/fields/2/name: field id is defined twice",
+		"#/fields/2/type/symbols/1: symbol A is listed twice",
+		"#/fields/2/type/default: the default C is not a symbol of the enum",
+		"#/fields/3/type/name: com.acme.Order is defined twice",
+		"#/fields/3/type/size: the size of a fixed type must be a non-negative integer",
+		"#/fields/4/type: an array must have items",
+		"#/fields/5: field map must have a type",
+		"#/fields/6/order: the order of a field must be ascending, descending or ignore",
+		"#/fields/7/type: invalid type name \"com.acme.\"",
+		"#/fields/8/type: a schema must be a type name, a union or an object",
+	}, avroProblemsOf(t, `{"type":"record","namespace":"com.1acme","name":"com.acme.Order","fields":[
+		{"name":"my-field","type":"string"},
+		{"name":"id","type":["null",["int"],"string","string"]},
+		{"name":"id","type":{"type":"enum","name":"Letter","symbols":["A","A"],"default":"C"}},
+		{"name":"fixed","type":{"type":"fixed","name":"Order","namespace":"com.acme","size":-1}},
+		{"name":"list","type":{"type":"array"}},
+		{"name":"map"},
+		{"name":"ordered","type":"int","order":"up"},
+		{"name":"named","type":"com.acme."},
+		{"name":"number","type":3}
+	]}`))
+}
+
+func TValidateAvroDefaults(t *testing.T) {
+	assert.Equal(t, []string{}, avroProblemsOf(t, `{"type":"record","name":"Defaults","fields":[
+		{"name":"a","type":"int","default":1},
+		{"name":"b","type":["null","string"],"default":null},
+		{"name":"c","type":{"type":"array","items":"long"},"default":[1,2]},
+		{"name":"d","type":{"type":"map","values":"boolean"},"default":{"x":true}},
+		{"name":"e","type":{"type":"record","name":"Inner","fields":[{"name":"x","type":"int"},{"name":"y","type":"int","default":0}]},"default":{"x":1}},
+		{"name":"f","type":"Inner","default":{"x":2,"y":3}},
+		{"name":"g","type":"com.acme.Referenced","default":"anything"},
+		{"name":"h","type":{"type":"string","logicalType":"uuid"},"default":"00000000-0000-0000-0000-000000000000"}
+	]}`))
+
+	assert.Equal(t, []string{
+		"#/fields/0/default: the default 1.5 does not match the type int",
+		"#/fields/1/default: the default \"x\" does not match the type null",
+		"#/fields/2/default: the default 3000000000 does not match the type int",
+		"#/fields/3/default: the default \"a\" does not match the type long",
+		"#/fields/4/default: the default {} misses field x",
+		"#/fields/5/default: the default \"Z\" does not match the type Suit",
+	}, avroProblemsOf(t, `{"type":"record","name":"Defaults","fields":[
+		{"name":"a","type":"int","default":1.5},
+		{"name":"b","type":["null","string"],"default":"x"},
+		{"name":"c","type":"int","default":3000000000},
+		{"name":"d","type":{"type":"array","items":"long"},"default":["a"]},
+		{"name":"e","type":{"type":"record","name":"Inner","fields":[{"name":"x","type":"int"}]},"default":{}},
+		{"name":"f","type":{"type":"enum","name":"Suit","symbols":["A"]},"default":"Z"}
+	]}`))
+}
+
+func TValidateAvroLogicalTypes(t *testing.T) {
+	assert.Equal(t, []string{}, avroProblemsOf(t, `{"type":"record","name":"Logical","fields":[
+		{"name":"a","type":{"type":"bytes","logicalType":"decimal","precision":9,"scale":2}},
+		{"name":"b","type":{"type":"fixed","name":"Amount","size":8,"logicalType":"decimal","precision":18}},
+		{"name":"c","type":{"type":"long","logicalType":"timestamp-micros"}},
+		{"name":"d","type":{"type":"fixed","name":"Duration","size":12,"logicalType":"duration"}},
+		{"name":"e","type":{"type":"string","logicalType":"custom-type"}}
+	]}`))
+
+	assert.Equal(t, []string{
+		"#/fields/0/type/logicalType: the date logical type applies to int, not long",
+		"#/fields/1/type/precision: the precision of a decimal must be a positive integer",
+		"#/fields/2/type/scale: the scale of a decimal must be an integer between 0 and its precision",
+		"#/fields/3/type/precision: a fixed type of 4 bytes can not hold a precision of 10",
+		"#/fields/4/type/size: a uuid fixed type must have a size of 16",
+	}, avroProblemsOf(t, `{"type":"record","name":"Logical","fields":[
+		{"name":"a","type":{"type":"long","logicalType":"date"}},
+		{"name":"b","type":{"type":"bytes","logicalType":"decimal"}},
+		{"name":"c","type":{"type":"bytes","logicalType":"decimal","precision":4,"scale":5}},
+		{"name":"d","type":{"type":"fixed","name":"Small","size":4,"logicalType":"decimal","precision":10}},
+		{"name":"e","type":{"type":"fixed","name":"Id","size":8,"logicalType":"uuid"}}
+	]}`))
+}
+
+func TAvroProblemsByLine(t *testing.T) {
+	schemaDir := t.TempDir()
+	writeWatchedFile(t, schemaDir, "order.avsc", `{
+  "type": "record",
+  "name": "Order",
+  "fields": [
+    {"name": "id", "type": "string"},
+    {
+      "name": "count",
+      "type": "int",
+      "default": "none"
+    }
+  ]
+}`)
+	_, err := readAvroSchemaFile(filepath.Join(schemaDir, "order.avsc"))
+	assert.EqualError(t, err, "not a valid AVRO schema:\n  line 9: #/fields/1/default: the default \"none\" does not match the type int")
+
+	writeWatchedFile(t, schemaDir, "broken.avsc", "{\n  \"type\": \"record\",\n  \"name\": \"Broken\"\n  \"fields\": []\n}")
+	_, err = readAvroSchemaFile(filepath.Join(schemaDir, "broken.avsc"))
+	assert.EqualError(t, err, "line 4: invalid character '\"' after object key:value pair")
+
+	writeWatchedFile(t, schemaDir, "orders.avdl", "protocol Orders {\n\trecord Order {\n\t\tstring id;\n\t\tint count = \"none\";\n\t}\n\tenum Empty { A, A }\n}\n")
+	_, err = readAvroSchemaFile(filepath.Join(schemaDir, "orders.avdl"))
+	assert.EqualError(t, err, "not a valid AVRO schema:\n"+
+		"  line 4: #/types/0/fields/1/default: the default \"none\" does not match the type int\n"+
+		"  line 6: #/types/1/symbols/1: symbol A is listed twice")
+
+	// Invalid files are not loaded
+	loader := NewSchemaLoader(AVRO.String(), nil, schemaDir, "")
+	loader.loadFromPath()
+	assert.Empty(t, loader.schemaRecords)
+}
@@ -0,0 +1,133 @@
+package client
+
+//
+// schemaLoadAvro_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var nestedAvroSchema = `{"type":"record","namespace":"com.acme","name":"Order","fields":[
+	{"name":"id","type":{"type":"string","logicalType":"uuid"}},
+	{"name":"status","type":{"type":"enum","name":"Status","symbols":["OPEN","CLOSED"]}},
+	{"name":"previousStatus","type":["null","Status"]},
+	{"name":"line","type":{"type":"record","name":"Line","fields":[
+		{"name":"price","type":"Money"},
+		{"name":"tags","type":["null",{"type":"array","items":"com.other.Tag"}]},
+		{"name":"next","type":["null","Line"]}
+	]}},
+	{"name":"shipping","type":{"type":"map","values":["null","Address"]}},
+	{"name":"billing","type":{"type":"record","name":"com.billing.Billing","fields":[
+		{"name":"account","type":"Account"},
+		{"name":"price","type":"com.acme.Money"}
+	]}}
+]}`
+
+func TestMainStackSchemaLoadAvro(t *testing.T) {
+	t.Run("TAvroWalkerFindsNestedReferences", func(t *testing.T) { TAvroWalkerFindsNestedReferences(t) })
+	t.Run("TAvroWalkerResolvesAliases", func(t *testing.T) { TAvroWalkerResolvesAliases(t) })
+	t.Run("TSchemaLoadRegistersInlineTypes", func(t *testing.T) { TSchemaLoadRegistersInlineTypes(t) })
+	t.Run("TSchemaLoadReportsReferenceCycles", func(t *testing.T) { TSchemaLoadReportsReferenceCycles(t) })
+}
+
+func TAvroWalkerFindsNestedReferences(t *testing.T) {
+	var schema map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(nestedAvroSchema), &schema))
+
+	walker := newAvroWalker(schema, map[string]string{})
+	resolved := walker.resolve(schema, "")
+
+	// Inline types and their namespaces are understood, Billing defining its own namespace for its fields
+	assert.Equal(t, []string{"com.acme.Money", "com.other.Tag", "com.acme.Address", "com.billing.Account"}, walker.references)
+	assert.Equal(t, schema, resolved)
+}
+
+func TAvroWalkerResolvesAliases(t *testing.T) {
+	var schema map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"type":"record","namespace":"com.acme","name":"Invoice","aliases":["Bill"],"fields":[
+		{"name":"amount","type":["null","OldMoney"]},
+		{"name":"previous","type":["null","Bill"]}
+	]}`), &schema))
+
+	walker := newAvroWalker(schema, map[string]string{"com.acme.OldMoney": "com.acme.Money"})
+	resolved := walker.resolve(schema, "").(map[string]interface{})
+
+	assert.Equal(t, []string{"com.acme.Money"}, walker.references)
+	assert.Equal(t, []interface{}{"null", "com.acme.Money"}, resolved["fields"].([]interface{})[0].(map[string]interface{})["type"])
+	// The schema read from the file is left untouched
+	assert.Equal(t, []interface{}{"null", "OldMoney"}, schema["fields"].([]interface{})[0].(map[string]interface{})["type"])
+}
+
+func TSchemaLoadRegistersInlineTypes(t *testing.T) {
+	HttpCallTimeout = 60
+	registry := newFakeRegistry()
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	schemaDir := t.TempDir()
+	writeWatchedFile(t, schemaDir, "order.avsc", nestedAvroSchema)
+	writeWatchedFile(t, schemaDir, "money.avsc", `{"type":"record","namespace":"com.acme","name":"Money","aliases":["OldMoney"],"fields":[{"name":"cents","type":"long"}]}`)
+	writeWatchedFile(t, schemaDir, "tag.avsc", `{"type":"record","name":"com.other.Tag","fields":[{"name":"value","type":"string"}]}`)
+	writeWatchedFile(t, schemaDir, "address.avsc", `{"type":"record","namespace":"com.acme","name":"Address","fields":[{"name":"street","type":"string"}]}`)
+	writeWatchedFile(t, schemaDir, "account.avsc", `{"type":"fixed","namespace":"com.billing","name":"Account","size":16}`)
+	// References a record defined inline in order.avsc, through the alias of another record
+	writeWatchedFile(t, schemaDir, "refund.avsc", `{"type":"record","namespace":"com.acme","name":"Refund","fields":[
+		{"name":"line","type":"Line"},{"name":"amount","type":"OldMoney"}]}`)
+
+	loader := NewSchemaLoader(AVRO.String(), NewSchemaRegistryClient(server.URL, "key", "secret", "dst"), schemaDir, "")
+	loader.Run()
+
+	assert.Equal(t, 1, registry.versionCount("com.acme.Order-value"))
+	assert.Equal(t, []SchemaReference{
+		{Name: "com.acme.Money", Subject: "com.acme.Money-value", Version: 1},
+		{Name: "com.other.Tag", Subject: "com.other.Tag-value", Version: 1},
+		{Name: "com.acme.Address", Subject: "com.acme.Address-value", Version: 1},
+		{Name: "com.billing.Account", Subject: "com.billing.Account-value", Version: 1},
+	}, registry.latest("com.acme.Order-value").References)
+
+	// Inline types are registered when referenced only
+	assert.Equal(t, 1, registry.versionCount("com.acme.Line-value"))
+	assert.Equal(t, 0, registry.versionCount("com.acme.Status-value"))
+	assert.Equal(t, 0, registry.versionCount("com.billing.Billing-value"))
+
+	refund := registry.latest("com.acme.Refund-value")
+	assert.Equal(t, []SchemaReference{
+		{Name: "com.acme.Line", Subject: "com.acme.Line-value", Version: 1},
+		{Name: "com.acme.Money", Subject: "com.acme.Money-value", Version: 1},
+	}, refund.References)
+	assert.Contains(t, refund.Schema, `"type":"com.acme.Money"`)
+
+	var line map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(registry.latest("com.acme.Line-value").Schema), &line))
+	assert.Equal(t, "com.acme", line["namespace"])
+	assert.Equal(t, "Line", line["name"])
+}
+
+func TSchemaLoadReportsReferenceCycles(t *testing.T) {
+	HttpCallTimeout = 60
+	registry := newFakeRegistry()
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	schemaDir := t.TempDir()
+	writeWatchedFile(t, schemaDir, "ping.avsc", `{"type":"record","namespace":"com.acme","name":"Ping","fields":[{"name":"pong","type":["null","Pong"]}]}`)
+	writeWatchedFile(t, schemaDir, "pong.avsc", `{"type":"record","namespace":"com.acme","name":"Pong","fields":[{"name":"ping","type":["null","Ping"]}]}`)
+	writeWatchedFile(t, schemaDir, "other.avsc", `{"type":"record","namespace":"com.acme","name":"Other","fields":[]}`)
+
+	// Watching, so the cycle is reported rather than stopping the load
+	loader := NewSchemaLoader(AVRO.String(), NewSchemaRegistryClient(server.URL, "key", "secret", "dst"), schemaDir, "")
+	loader.watching = true
+	loader.Run()
+
+	assert.Equal(t, 0, registry.versionCount("com.acme.Ping-value"))
+	assert.Equal(t, 0, registry.versionCount("com.acme.Pong-value"))
+	assert.Equal(t, 1, registry.versionCount("com.acme.Other-value"))
+	assert.Contains(t, loader.missingRefs, "com.acme.Ping is part of a reference cycle")
+	assert.Contains(t, loader.missingRefs, "com.acme.Pong is part of a reference cycle")
+}
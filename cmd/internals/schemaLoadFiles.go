@@ -0,0 +1,188 @@
+package client
+
+//
+// schemaLoadFiles.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+/*
+Protobuf and JSON schema loads register files as they are written, each file being one schema that may
+reference other files of the load. Referenced files are registered first, under the subject of the reference
+subject name strategy, by default their path relative to the loaded path. Other files are registered under
+the subjects of the subject name strategy for their schema name, or for their path when they have none.
+*/
+
+// A schema file of a Protobuf or JSON schema load
+type loadedFile struct {
+	path       string          // Path of the file on disk
+	name       string          // Path of the file relative to the loaded path
+	contents   string          // Contents of the file, registered as they are
+	schemaName string          // Name of the schema the file defines, if any
+	references []fileReference // Other files of the load the file references
+}
+
+type fileReference struct {
+	name string // Name of the reference, as written in the referencing file
+	file string // Path of the referenced file relative to the loaded path, or its $id
+}
+
+// Registers every file of the load, referenced files first
+func (sl *SchemaLoader) registerLoadedFiles() {
+	names := map[string]bool{}
+	for name := range sl.loadedFiles {
+		names[name] = true
+	}
+	sl.registerFiles(names)
+}
+
+// Registers the given files of the load, after the files they reference
+func (sl *SchemaLoader) registerFiles(toRegister map[string]bool) {
+	referenced := map[string]bool{}
+	for _, file := range sl.loadedFiles {
+		for _, reference := range file.references {
+			if target, exists := sl.referencedFile(reference); exists {
+				referenced[target.name] = true
+			}
+		}
+	}
+
+	names := []string{}
+	for name := range toRegister {
+		if _, loaded := sl.loadedFiles[name]; loaded {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	registered := map[string]SubjectVersion{}
+	for _, name := range names {
+		if CancelRun == true {
+			return
+		}
+		sl.registerLoadedFile(sl.loadedFiles[name], referenced, registered, map[string]bool{})
+	}
+}
+
+// Adds the files referencing any of the given files, directly or not, to the given files
+func (sl *SchemaLoader) withReferencingFiles(names map[string]bool) map[string]bool {
+	for added := true; added; {
+		added = false
+		for name, file := range sl.loadedFiles {
+			if names[name] {
+				continue
+			}
+			for _, reference := range file.references {
+				target, exists := sl.referencedFile(reference)
+				if names[reference.file] || (exists && names[target.name]) {
+					names[name] = true
+					added = true
+					break
+				}
+			}
+		}
+	}
+	return names
+}
+
+// Returns the file of the load the given reference points to
+func (sl *SchemaLoader) referencedFile(reference fileReference) (*loadedFile, bool) {
+	if file, exists := sl.loadedFiles[reference.file]; exists {
+		return file, true
+	}
+	if name, exists := sl.loadedIds[reference.file]; exists {
+		return sl.loadedFiles[name], true
+	}
+	return nil, false
+}
+
+// Registers the given file after the files it references, returning the subject and version it is registered as
+func (sl *SchemaLoader) registerLoadedFile(file *loadedFile, referenced map[string]bool, registered map[string]SubjectVersion,
+	visiting map[string]bool) (SubjectVersion, bool) {
+	if subjectVersion, done := registered[file.name]; done {
+		return subjectVersion, true
+	}
+
+	schemaName := file.schemaName
+	if schemaName == "" {
+		schemaName = file.name
+	}
+	subjects := []string{}
+	if referenced[file.name] {
+		subject, err := sl.namer.referenceSubjectFor(file.schemaName, file.name)
+		if err != nil {
+			log.Printf("Could not register %s: %v", file.path, err)
+			return SubjectVersion{}, false
+		}
+		subjects = append(subjects, subject)
+	} else {
+		subjects = sl.namer.subjectsFor(schemaName)
+		if len(subjects) == 0 {
+			log.Printf("Not registering %s from %s, no topic is mapped to it in %s", schemaName, file.path, TopicMappingPath)
+			return SubjectVersion{}, false
+		}
+	}
+
+	if visiting[file.name] {
+		sl.fileNotLoaded(file, schemaName, subjects, "it is part of a reference cycle")
+		return SubjectVersion{}, false
+	}
+	visiting[file.name] = true
+	defer delete(visiting, file.name)
+
+	references := []SchemaReference{}
+	for _, reference := range file.references {
+		target, exists := sl.referencedFile(reference)
+		if !exists {
+			sl.fileNotLoaded(file, schemaName, subjects, fmt.Sprintf("it references %s which is not in %s", reference.name, sl.path))
+			return SubjectVersion{}, false
+		}
+		// Referenced files are registered under the subject of the reference subject name strategy
+		targetVersion, ok := sl.registerLoadedFile(target, referenced, registered, visiting)
+		if !ok {
+			reason := fmt.Sprintf("its reference %s could not be registered", reference.name)
+			if sl.compatChecks != nil {
+				reason = fmt.Sprintf("its reference %s is not registered in %s", reference.name, sl.dstClient.SRUrl)
+			}
+			sl.fileNotLoaded(file, schemaName, subjects, reason)
+			return SubjectVersion{}, false
+		}
+		thisReference := SchemaReference{Name: reference.name, Subject: targetVersion.Subject, Version: targetVersion.Version}
+		if !referenceIsInSlice(thisReference, references) {
+			references = append(references, thisReference)
+		}
+	}
+
+	if checkSubjectIsAllowed(schemaName) {
+		for _, subject := range subjects {
+			sl.registerUnder(subject, file.contents, references, file.path, fmt.Sprintf("%s from %s", subject, file.path))
+		}
+	}
+
+	// Only referenced files need their version, they are registered under a single subject
+	version, isRegistered := sl.dstClient.lookupSchemaVersion(subjects[0], sl.schemasType.String(), file.contents, references)
+	if !isRegistered {
+		return SubjectVersion{}, false
+	}
+	registered[file.name] = SubjectVersion{Subject: subjects[0], Version: version}
+	return registered[file.name], true
+}
+
+// Reports a file that could not be registered for the given reason. When only testing schemas against the registry,
+// the file could not be tested, which is an error of every subject it would be registered under.
+func (sl *SchemaLoader) fileNotLoaded(file *loadedFile, schemaName string, subjects []string, reason string) {
+	if sl.compatChecks == nil {
+		log.Printf("Could not register %s, %s", file.path, reason)
+		return
+	}
+	if checkSubjectIsAllowed(schemaName) {
+		for _, subject := range subjects {
+			sl.compatChecks.fail(subject, file.contents, file.path, reason)
+		}
+	}
+}
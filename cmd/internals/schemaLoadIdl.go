@@ -0,0 +1,724 @@
+package client
+
+//
+// schemaLoadIdl.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+AVRO schema loads read the named types declared by AVRO protocols (.avpr) and AVRO IDL files (.avdl), each
+type becoming a schema of the load registered under its own subject. Types declared in the same file reference
+each other like types declared in different files. Messages of protocols are not registered.
+IDL files are read as described by the AVRO IDL specification: protocols, namespace and schema declarations,
+records, errors, enums with defaults, fixed types, primitive and logical types (decimal, date, time_ms,
+timestamp_ms, local_timestamp_ms, uuid), arrays, maps, unions, nullable types (string?), defaults,
+annotations and documentation comments. Imports are not followed, the imported files are read as any other
+file when they are part of the load.
+*/
+
+var avroIdlLogicalTypes = map[string]map[string]interface{}{
+	"date":               {"type": "int", "logicalType": "date"},
+	"time_ms":            {"type": "int", "logicalType": "time-millis"},
+	"timestamp_ms":       {"type": "long", "logicalType": "timestamp-millis"},
+	"local_timestamp_ms": {"type": "long", "logicalType": "local-timestamp-millis"},
+	"uuid":               {"type": "string", "logicalType": "uuid"},
+}
+
+// Returns the named types declared by the given AVRO protocol
+func parseAvroProtocol(contents []byte) ([]map[string]interface{}, error) {
+	var protocol struct {
+		Protocol  string        `json:"protocol"`
+		Namespace string        `json:"namespace"`
+		Types     []interface{} `json:"types"`
+	}
+	if err := json.Unmarshal(contents, &protocol); err != nil {
+		return nil, err
+	}
+	if protocol.Protocol == "" {
+		return nil, fmt.Errorf("not an AVRO protocol, it has no protocol name")
+	}
+
+	types := []map[string]interface{}{}
+	for i, oneType := range protocol.Types {
+		definition, isMap := oneType.(map[string]interface{})
+		if !isMap {
+			return nil, fmt.Errorf("type %d of protocol %s is not a named type", i, protocol.Protocol)
+		}
+		types = append(types, withAvroNamespace(definition, protocol.Namespace))
+	}
+	return types, nil
+}
+
+// Returns a copy of the given named type with its namespace set, if it inherits the given namespace
+func withAvroNamespace(definition map[string]interface{}, namespace string) map[string]interface{} {
+	standalone := make(map[string]interface{}, len(definition)+1)
+	for key, value := range definition {
+		standalone[key] = value
+	}
+	name, _ := standalone["name"].(string)
+	if _, hasNamespace := standalone["namespace"]; !hasNamespace && namespace != "" && !strings.Contains(name, ".") {
+		standalone["namespace"] = namespace
+	}
+	return standalone
+}
+
+// Define idlTokenKind enum
+type idlTokenKind int
+
+const (
+	idlEnd idlTokenKind = iota
+	idlIdentifier
+	idlString
+	idlNumber
+	idlSymbol
+)
+
+type idlToken struct {
+	kind idlTokenKind
+	text string // Identifier, quoted string, number or symbol as written
+	line int
+	doc  string // Documentation comment preceding the token
+}
+
+func (token idlToken) String() string {
+	if token.kind == idlEnd {
+		return "end of file"
+	}
+	return strconv.Quote(token.text)
+}
+
+// Splits AVRO IDL contents into tokens, dropping comments and attaching documentation comments to the next token
+func tokenizeAvroIdl(contents string) ([]idlToken, error) {
+	tokens := []idlToken{}
+	runes := []rune(contents)
+	line := 1
+	doc := ""
+	for i := 0; i < len(runes); {
+		char := runes[i]
+		start := i
+		switch {
+		case char == '\n':
+			line++
+			i++
+			continue
+		case unicode.IsSpace(char):
+			i++
+			continue
+		case runesHavePrefix(runes, i, "//"):
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			continue
+		case runesHavePrefix(runes, i, "/*"):
+			for i += 2; i < len(runes) && !runesHavePrefix(runes, i, "*/"); i++ {
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			comment := string(runes[start+2 : i])
+			i += 2
+			line += strings.Count(comment, "\n")
+			if strings.HasPrefix(comment, "*") && comment != "*" {
+				doc = cleanIdlDoc(comment[1:])
+			}
+			continue
+		case char == '"':
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' {
+					i++
+				}
+				if i < len(runes) && runes[i] == '\n' {
+					return nil, fmt.Errorf("line %d: unterminated string", line)
+				}
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			i++
+			tokens = append(tokens, idlToken{kind: idlString, text: string(runes[start:i]), line: line, doc: doc})
+		case char == '`':
+			for i++; i < len(runes) && runes[i] != '`'; i++ {
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated escaped identifier", line)
+			}
+			i++
+			tokens = append(tokens, idlToken{kind: idlIdentifier, text: string(runes[start+1 : i-1]), line: line, doc: doc})
+		case unicode.IsLetter(char) || char == '_':
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, idlToken{kind: idlIdentifier, text: string(runes[start:i]), line: line, doc: doc})
+		case unicode.IsDigit(char) || (char == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			for i++; i < len(runes) && (unicode.IsDigit(runes[i]) || strings.ContainsRune(".eE+-", runes[i])); i++ {
+			}
+			tokens = append(tokens, idlToken{kind: idlNumber, text: string(runes[start:i]), line: line, doc: doc})
+		default:
+			i++
+			tokens = append(tokens, idlToken{kind: idlSymbol, text: string(char), line: line, doc: doc})
+		}
+		doc = ""
+	}
+	return append(tokens, idlToken{kind: idlEnd, line: line}), nil
+}
+
+// Returns the text of a documentation comment without the leading stars of its lines
+func cleanIdlDoc(comment string) string {
+	lines := strings.Split(comment, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(strings.TrimSpace(line), "*")
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func runesHavePrefix(runes []rune, at int, prefix string) bool {
+	for _, char := range prefix {
+		if at >= len(runes) || runes[at] != char {
+			return false
+		}
+		at++
+	}
+	return true
+}
+
+// Reads AVRO IDL tokens into the named types they declare
+type idlParser struct {
+	tokens    []idlToken
+	pos       int
+	namespace string // Namespace of the protocol or file being read
+	types     []map[string]interface{}
+	lines     map[string]int // JSON pointer of the declared types and their fields -> line they are declared at
+}
+
+// Returns the named types declared by the given AVRO IDL contents, along with the lines they and their fields
+// are declared at by JSON pointer (/types/0, /types/0/fields/1)
+func parseAvroIdl(contents string) ([]map[string]interface{}, map[string]int, error) {
+	tokens, err := tokenizeAvroIdl(contents)
+	if err != nil {
+		return nil, nil, err
+	}
+	parser := &idlParser{tokens: tokens, types: []map[string]interface{}{}, lines: map[string]int{}}
+	if err := parser.parseFile(); err != nil {
+		return nil, nil, err
+	}
+	return parser.types, parser.lines, nil
+}
+
+func (ip *idlParser) peek() idlToken {
+	return ip.tokens[ip.pos]
+}
+
+func (ip *idlParser) next() idlToken {
+	token := ip.tokens[ip.pos]
+	if token.kind != idlEnd {
+		ip.pos++
+	}
+	return token
+}
+
+// Returns whether the next token is the given symbol or keyword, consuming it if so
+func (ip *idlParser) accept(text string) bool {
+	token := ip.peek()
+	if (token.kind == idlSymbol || token.kind == idlIdentifier) && token.text == text {
+		ip.pos++
+		return true
+	}
+	return false
+}
+
+func (ip *idlParser) expect(text string) error {
+	if !ip.accept(text) {
+		return ip.unexpected(strconv.Quote(text))
+	}
+	return nil
+}
+
+func (ip *idlParser) unexpected(expected string) error {
+	token := ip.peek()
+	return fmt.Errorf("line %d: expected %s, found %s", token.line, expected, token)
+}
+
+func (ip *idlParser) identifier() (string, error) {
+	if ip.peek().kind != idlIdentifier {
+		return "", ip.unexpected("a name")
+	}
+	return ip.next().text, nil
+}
+
+func (ip *idlParser) parseFile() error {
+	for ip.peek().kind != idlEnd {
+		switch {
+		case ip.accept("namespace"):
+			namespace, err := ip.identifier()
+			if err != nil {
+				return err
+			}
+			ip.namespace = namespace
+			if err := ip.expect(";"); err != nil {
+				return err
+			}
+		case ip.accept("schema"):
+			// The main schema of the file is registered like the other named types
+			if _, err := ip.parseType(map[string]interface{}{}); err != nil {
+				return err
+			}
+			if err := ip.expect(";"); err != nil {
+				return err
+			}
+		case ip.peek().text == "import":
+			if err := ip.skipStatement(); err != nil {
+				return err
+			}
+		default:
+			doc := ip.peek().doc
+			annotations, err := ip.parseAnnotations()
+			if err != nil {
+				return err
+			}
+			if ip.accept("protocol") {
+				if err := ip.parseProtocol(annotations); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := ip.parseNamedType(doc, annotations); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ip *idlParser) parseProtocol(annotations map[string]interface{}) error {
+	if namespace, isString := annotations["namespace"].(string); isString {
+		ip.namespace = namespace
+	}
+	if _, err := ip.identifier(); err != nil {
+		return err
+	}
+	if err := ip.expect("{"); err != nil {
+		return err
+	}
+	for !ip.accept("}") {
+		if ip.peek().kind == idlEnd {
+			return ip.unexpected(`"}"`)
+		}
+		if ip.peek().text == "import" {
+			if err := ip.skipStatement(); err != nil {
+				return err
+			}
+			continue
+		}
+		start := ip.pos
+		doc := ip.peek().doc
+		typeAnnotations, err := ip.parseAnnotations()
+		if err != nil {
+			return err
+		}
+		switch ip.peek().text {
+		case "record", "error", "enum", "fixed":
+			if err := ip.parseNamedType(doc, typeAnnotations); err != nil {
+				return err
+			}
+		default:
+			// Messages are not registered
+			ip.pos = start
+			if err := ip.skipStatement(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Skips tokens up to the end of the current statement
+func (ip *idlParser) skipStatement() error {
+	depth := 0
+	for {
+		token := ip.next()
+		switch {
+		case token.kind == idlEnd:
+			return fmt.Errorf("line %d: expected \";\", found end of file", token.line)
+		case token.kind != idlSymbol:
+		case token.text == "(" || token.text == "[" || token.text == "{":
+			depth++
+		case token.text == ")" || token.text == "]" || token.text == "}":
+			depth--
+		case token.text == ";" && depth == 0:
+			return nil
+		}
+	}
+}
+
+// Reads annotations such as @namespace("com.mycorp") into a map of their values
+func (ip *idlParser) parseAnnotations() (map[string]interface{}, error) {
+	annotations := map[string]interface{}{}
+	for ip.accept("@") {
+		name, err := ip.identifier()
+		if err != nil {
+			return nil, err
+		}
+		// Annotation names may hold dashes, as in @java-class
+		for ip.peek().text == "-" && ip.tokens[ip.pos+1].kind == idlIdentifier {
+			ip.pos++
+			name += "-" + ip.next().text
+		}
+		if err := ip.expect("("); err != nil {
+			return nil, err
+		}
+		value, err := ip.parseJsonValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := ip.expect(")"); err != nil {
+			return nil, err
+		}
+		annotations[name] = value
+	}
+	return annotations, nil
+}
+
+// Reads a record, error, enum or fixed declaration
+func (ip *idlParser) parseNamedType(doc string, annotations map[string]interface{}) error {
+	kind := ip.peek()
+	if kind.kind != idlIdentifier || (kind.text != "record" && kind.text != "error" && kind.text != "enum" && kind.text != "fixed") {
+		return ip.unexpected("record, error, enum, fixed or protocol")
+	}
+	ip.next()
+	name, err := ip.identifier()
+	if err != nil {
+		return err
+	}
+	pointer := fmt.Sprintf("/types/%d", len(ip.types))
+	ip.lines[pointer] = kind.line
+
+	definition := map[string]interface{}{"type": kind.text, "name": name}
+	namespace := ip.namespace
+	for key, value := range annotations {
+		if key == "namespace" {
+			namespace, _ = value.(string)
+			continue
+		}
+		definition[key] = value
+	}
+	if namespace != "" && !strings.Contains(name, ".") {
+		definition["namespace"] = namespace
+	}
+	if doc != "" {
+		definition["doc"] = doc
+	}
+
+	switch kind.text {
+	case "record", "error":
+		fields, err := ip.parseFields(pointer)
+		if err != nil {
+			return err
+		}
+		definition["fields"] = fields
+	case "enum":
+		symbols, err := ip.parseSymbols()
+		if err != nil {
+			return err
+		}
+		definition["symbols"] = symbols
+		if ip.accept("=") {
+			defaultSymbol, err := ip.identifier()
+			if err != nil {
+				return err
+			}
+			definition["default"] = defaultSymbol
+			if err := ip.expect(";"); err != nil {
+				return err
+			}
+		} else {
+			ip.accept(";")
+		}
+	case "fixed":
+		if err := ip.expect("("); err != nil {
+			return err
+		}
+		if ip.peek().kind != idlNumber {
+			return ip.unexpected("the size of the fixed type")
+		}
+		size, err := strconv.Atoi(ip.next().text)
+		if err != nil {
+			return err
+		}
+		definition["size"] = size
+		if err := ip.expect(")"); err != nil {
+			return err
+		}
+		if err := ip.expect(";"); err != nil {
+			return err
+		}
+	}
+	ip.types = append(ip.types, definition)
+	return nil
+}
+
+func (ip *idlParser) parseSymbols() ([]interface{}, error) {
+	if err := ip.expect("{"); err != nil {
+		return nil, err
+	}
+	symbols := []interface{}{}
+	for !ip.accept("}") {
+		if len(symbols) != 0 {
+			if err := ip.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		symbol, err := ip.identifier()
+		if err != nil {
+			return nil, err
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols, nil
+}
+
+// Reads the fields of the record at the given pointer, a field declaration possibly declaring several variables
+// of the same type
+func (ip *idlParser) parseFields(pointer string) ([]interface{}, error) {
+	if err := ip.expect("{"); err != nil {
+		return nil, err
+	}
+	fields := []interface{}{}
+	for !ip.accept("}") {
+		doc := ip.peek().doc
+		typeAnnotations, err := ip.parseAnnotations()
+		if err != nil {
+			return nil, err
+		}
+		fieldType, err := ip.parseType(typeAnnotations)
+		if err != nil {
+			return nil, err
+		}
+		// Declared with the nullable shorthand, as in string?
+		nullable := ip.tokens[ip.pos-1].kind == idlSymbol && ip.tokens[ip.pos-1].text == "?"
+		for {
+			field := map[string]interface{}{}
+			if variableDoc := ip.peek().doc; variableDoc != "" {
+				doc = variableDoc
+			}
+			fieldAnnotations, err := ip.parseAnnotations()
+			if err != nil {
+				return nil, err
+			}
+			for key, value := range fieldAnnotations {
+				field[key] = value
+			}
+			ip.lines[fmt.Sprintf("%s/fields/%d", pointer, len(fields))] = ip.peek().line
+			name, err := ip.identifier()
+			if err != nil {
+				return nil, err
+			}
+			field["name"] = name
+			field["type"] = fieldType
+			if doc != "" {
+				field["doc"] = doc
+			}
+			if ip.accept("=") {
+				defaultValue, err := ip.parseJsonValue()
+				if err != nil {
+					return nil, err
+				}
+				field["default"] = defaultValue
+				// A nullable type with a non-null default lists its type first, as defaults match the first type of unions
+				if nullable && defaultValue != nil {
+					field["type"] = []interface{}{fieldType.([]interface{})[1], "null"}
+				}
+			}
+			fields = append(fields, field)
+			if !ip.accept(",") {
+				break
+			}
+		}
+		if err := ip.expect(";"); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// Reads a type, applying the given annotations to it
+func (ip *idlParser) parseType(annotations map[string]interface{}) (interface{}, error) {
+	token := ip.peek()
+	if token.kind != idlIdentifier {
+		return nil, ip.unexpected("a type")
+	}
+	ip.next()
+
+	var parsedType interface{}
+	switch token.text {
+	case "array", "map":
+		if err := ip.expect("<"); err != nil {
+			return nil, err
+		}
+		elementAnnotations, err := ip.parseAnnotations()
+		if err != nil {
+			return nil, err
+		}
+		elementType, err := ip.parseType(elementAnnotations)
+		if err != nil {
+			return nil, err
+		}
+		if err := ip.expect(">"); err != nil {
+			return nil, err
+		}
+		if token.text == "array" {
+			parsedType = map[string]interface{}{"type": "array", "items": elementType}
+		} else {
+			parsedType = map[string]interface{}{"type": "map", "values": elementType}
+		}
+	case "union":
+		if err := ip.expect("{"); err != nil {
+			return nil, err
+		}
+		union := []interface{}{}
+		for !ip.accept("}") {
+			if len(union) != 0 {
+				if err := ip.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			memberAnnotations, err := ip.parseAnnotations()
+			if err != nil {
+				return nil, err
+			}
+			member, err := ip.parseType(memberAnnotations)
+			if err != nil {
+				return nil, err
+			}
+			union = append(union, member)
+		}
+		parsedType = union
+	case "decimal":
+		if err := ip.expect("("); err != nil {
+			return nil, err
+		}
+		precision, err := strconv.Atoi(ip.next().text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: expected the precision of the decimal", token.line)
+		}
+		scale := 0
+		if ip.accept(",") {
+			if scale, err = strconv.Atoi(ip.next().text); err != nil {
+				return nil, fmt.Errorf("line %d: expected the scale of the decimal", token.line)
+			}
+		}
+		if err := ip.expect(")"); err != nil {
+			return nil, err
+		}
+		parsedType = map[string]interface{}{"type": "bytes", "logicalType": "decimal", "precision": precision, "scale": scale}
+	default:
+		if logicalType, isLogical := avroIdlLogicalTypes[token.text]; isLogical {
+			copied := map[string]interface{}{}
+			for key, value := range logicalType {
+				copied[key] = value
+			}
+			parsedType = copied
+		} else {
+			parsedType = token.text
+		}
+	}
+
+	if len(annotations) != 0 {
+		annotated := map[string]interface{}{}
+		if typeMap, isMap := parsedType.(map[string]interface{}); isMap {
+			annotated = typeMap
+		} else {
+			annotated["type"] = parsedType
+		}
+		for key, value := range annotations {
+			annotated[key] = value
+		}
+		parsedType = annotated
+	}
+
+	if ip.accept("?") {
+		parsedType = []interface{}{"null", parsedType}
+	}
+	return parsedType, nil
+}
+
+// Reads a JSON value, as given to annotations and defaults
+func (ip *idlParser) parseJsonValue() (interface{}, error) {
+	token := ip.next()
+	switch token.kind {
+	case idlString:
+		var value string
+		if err := json.Unmarshal([]byte(token.text), &value); err != nil {
+			return nil, fmt.Errorf("line %d: invalid string %s", token.line, token.text)
+		}
+		return value, nil
+	case idlNumber:
+		var value json.Number
+		if err := json.Unmarshal([]byte(token.text), &value); err != nil {
+			return nil, fmt.Errorf("line %d: invalid number %s", token.line, token.text)
+		}
+		if integer, err := value.Int64(); err == nil {
+			return integer, nil
+		}
+		return value.Float64()
+	case idlIdentifier:
+		switch token.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	case idlSymbol:
+		switch token.text {
+		case "[":
+			values := []interface{}{}
+			for !ip.accept("]") {
+				if len(values) != 0 {
+					if err := ip.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				value, err := ip.parseJsonValue()
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, value)
+			}
+			return values, nil
+		case "{":
+			values := map[string]interface{}{}
+			for !ip.accept("}") {
+				if len(values) != 0 {
+					if err := ip.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				key, err := ip.parseJsonValue()
+				keyString, isString := key.(string)
+				if err != nil || !isString {
+					return nil, fmt.Errorf("line %d: expected a string key", ip.peek().line)
+				}
+				if err := ip.expect(":"); err != nil {
+					return nil, err
+				}
+				value, err := ip.parseJsonValue()
+				if err != nil {
+					return nil, err
+				}
+				values[keyString] = value
+			}
+			return values, nil
+		}
+	}
+	return nil, fmt.Errorf("line %d: expected a JSON value, found %s", token.line, token)
+}
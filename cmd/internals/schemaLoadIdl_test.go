@@ -0,0 +1,158 @@
+package client
+
+//
+// schemaLoadIdl_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var ordersIdl = `// Orders of the shop
+@namespace("com.acme.orders")
+protocol Orders {
+	import idl "common.avdl";
+
+	/** Status of an order */
+	enum Status { OPEN, CLOSED } = OPEN;
+
+	@namespace("com.acme.common")
+	fixed Checksum(16);
+
+	/**
+	 * An order.
+	 */
+	@aliases(["Purchase"])
+	record Order {
+		string id;
+		/** When the order was made */
+		timestamp_ms createdAt;
+		decimal(9, 2) total = "\u0000";
+		Status status = "OPEN";
+		array<Line> lines = [];
+		map<union { null, long }> counters;
+		string? note;
+		int? priority = 1;
+		@logicalType("timestamp-micros") long updatedAt;
+		string @order("ignore") @aliases(["comment"]) remark = "", ` + "`error`" + `;
+		com.acme.common.Checksum checksum;
+	}
+
+	record Line { string product; int quantity = 1; }
+
+	error OrderFailed { string reason; }
+
+	Order getOrder(string id) throws OrderFailed;
+	void ping() oneway;
+}
+`
+
+func TestMainStackSchemaLoadIdl(t *testing.T) {
+	t.Run("TParseAvroIdl", func(t *testing.T) { TParseAvroIdl(t) })
+	t.Run("TParseAvroIdlErrors", func(t *testing.T) { TParseAvroIdlErrors(t) })
+	t.Run("TParseAvroProtocol", func(t *testing.T) { TParseAvroProtocol(t) })
+	t.Run("TSchemaLoadReadsIdlAndProtocols", func(t *testing.T) { TSchemaLoadReadsIdlAndProtocols(t) })
+}
+
+func assertAvroTypes(t *testing.T, expected string, types []map[string]interface{}) {
+	actual, err := json.Marshal(types)
+	assert.Nil(t, err)
+	assert.JSONEq(t, expected, string(actual))
+}
+
+func TParseAvroIdl(t *testing.T) {
+	types, _, err := parseAvroIdl(ordersIdl)
+	assert.Nil(t, err)
+	assertAvroTypes(t, `[
+		{"type":"enum","name":"Status","namespace":"com.acme.orders","doc":"Status of an order","symbols":["OPEN","CLOSED"],"default":"OPEN"},
+		{"type":"fixed","name":"Checksum","namespace":"com.acme.common","size":16},
+		{"type":"record","name":"Order","namespace":"com.acme.orders","doc":"An order.","aliases":["Purchase"],"fields":[
+			{"name":"id","type":"string"},
+			{"name":"createdAt","type":{"type":"long","logicalType":"timestamp-millis"},"doc":"When the order was made"},
+			{"name":"total","type":{"type":"bytes","logicalType":"decimal","precision":9,"scale":2},"default":"\u0000"},
+			{"name":"status","type":"Status","default":"OPEN"},
+			{"name":"lines","type":{"type":"array","items":"Line"},"default":[]},
+			{"name":"counters","type":{"type":"map","values":["null","long"]}},
+			{"name":"note","type":["null","string"]},
+			{"name":"priority","type":["int","null"],"default":1},
+			{"name":"updatedAt","type":{"type":"long","logicalType":"timestamp-micros"}},
+			{"name":"remark","type":"string","order":"ignore","aliases":["comment"],"default":""},
+			{"name":"error","type":"string"},
+			{"name":"checksum","type":"com.acme.common.Checksum"}
+		]},
+		{"type":"record","name":"Line","namespace":"com.acme.orders","fields":[
+			{"name":"product","type":"string"},
+			{"name":"quantity","type":"int","default":1}
+		]},
+		{"type":"error","name":"OrderFailed","namespace":"com.acme.orders","fields":[{"name":"reason","type":"string"}]}
+	]`, types)
+
+	// IDL files without a protocol
+	types, _, err = parseAvroIdl("namespace com.acme.users;\nschema User;\nrecord User { string name; }\n")
+	assert.Nil(t, err)
+	assertAvroTypes(t, `[{"type":"record","name":"User","namespace":"com.acme.users","fields":[{"name":"name","type":"string"}]}]`, types)
+}
+
+func TParseAvroIdlErrors(t *testing.T) {
+	_, _, err := parseAvroIdl("protocol Orders {\n\trecord Order {\n\t\tstring id\n\t}\n}\n")
+	assert.EqualError(t, err, `line 4: expected ";", found "}"`)
+
+	_, _, err = parseAvroIdl("protocol Orders {\n\trecord Order { string id; }\n")
+	assert.EqualError(t, err, `line 3: expected "}", found end of file`)
+
+	_, _, err = parseAvroIdl("protocol Orders {\n\tfixed Hash(sixteen);\n}")
+	assert.EqualError(t, err, `line 2: expected the size of the fixed type, found "sixteen"`)
+
+	_, _, err = parseAvroIdl("/* unterminated\nprotocol Orders {}")
+	assert.EqualError(t, err, `line 1: unterminated comment`)
+}
+
+func TParseAvroProtocol(t *testing.T) {
+	types, err := parseAvroProtocol([]byte(`{"protocol":"Users","namespace":"com.acme.users","types":[
+		{"type":"record","name":"User","fields":[{"name":"address","type":"Address"}]},
+		{"type":"record","name":"com.acme.common.Address","fields":[{"name":"street","type":"string"}]},
+		{"type":"enum","name":"Role","namespace":"com.acme.roles","symbols":["ADMIN"]}
+	],"messages":{"getUser":{"request":[],"response":"User"}}}`))
+	assert.Nil(t, err)
+	assertAvroTypes(t, `[
+		{"type":"record","name":"User","namespace":"com.acme.users","fields":[{"name":"address","type":"Address"}]},
+		{"type":"record","name":"com.acme.common.Address","fields":[{"name":"street","type":"string"}]},
+		{"type":"enum","name":"Role","namespace":"com.acme.roles","symbols":["ADMIN"]}
+	]`, types)
+
+	_, err = parseAvroProtocol([]byte(`{"type":"record","name":"User","fields":[]}`))
+	assert.NotNil(t, err)
+}
+
+func TSchemaLoadReadsIdlAndProtocols(t *testing.T) {
+	HttpCallTimeout = 60
+	registry := newFakeRegistry()
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	schemaDir := t.TempDir()
+	writeWatchedFile(t, schemaDir, "orders.avdl", ordersIdl)
+	writeWatchedFile(t, schemaDir, "users.avpr", `{"protocol":"Users","namespace":"com.acme.users","types":[
+		{"type":"record","name":"User","fields":[{"name":"lastOrder","type":["null","com.acme.orders.Order"]}]}]}`)
+	writeWatchedFile(t, schemaDir, "README.md", "# Schemas of the shop")
+
+	loader := NewSchemaLoader(AVRO.String(), NewSchemaRegistryClient(server.URL, "key", "secret", "dst"), schemaDir, "")
+	loader.Run()
+
+	for _, subject := range []string{"com.acme.orders.Status-value", "com.acme.common.Checksum-value", "com.acme.orders.Order-value",
+		"com.acme.orders.Line-value", "com.acme.orders.OrderFailed-value", "com.acme.users.User-value"} {
+		assert.Equal(t, 1, registry.versionCount(subject), subject)
+	}
+	assert.Equal(t, []SchemaReference{
+		{Name: "com.acme.orders.Status", Subject: "com.acme.orders.Status-value", Version: 1},
+		{Name: "com.acme.orders.Line", Subject: "com.acme.orders.Line-value", Version: 1},
+		{Name: "com.acme.common.Checksum", Subject: "com.acme.common.Checksum-value", Version: 1},
+	}, registry.latest("com.acme.orders.Order-value").References)
+	assert.Equal(t, []SchemaReference{{Name: "com.acme.orders.Order", Subject: "com.acme.orders.Order-value", Version: 1}},
+		registry.latest("com.acme.users.User-value").References)
+}
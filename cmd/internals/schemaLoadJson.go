@@ -0,0 +1,274 @@
+package client
+
+//
+// schemaLoadJson.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+JSON schema loads register every .json file found under the path once it is checked to be a well-formed
+JSON Schema. Every $ref to another file becomes a reference, resolved relative to the referencing file or,
+for absolute URIs, against the $id of the loaded files. Files are registered under their title when no other
+file references them.
+*/
+
+var jsonSchemaExtension = ".json"
+
+var jsonSchemaTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true, "number": true, "string": true, "integer": true,
+}
+
+// Keywords holding a single schema
+var jsonSubschemaKeywords = []string{"additionalItems", "additionalProperties", "not", "if", "then", "else",
+	"contains", "propertyNames", "unevaluatedItems", "unevaluatedProperties", "contentSchema"}
+
+// Keywords holding a map of schemas
+var jsonSchemaMapKeywords = []string{"properties", "patternProperties", "definitions", "$defs", "dependentSchemas"}
+
+// Keywords holding a non-empty array of schemas
+var jsonSchemaArrayKeywords = []string{"allOf", "anyOf", "oneOf", "prefixItems"}
+
+var jsonStringKeywords = []string{"$ref", "$id", "$schema", "$anchor", "title", "description", "pattern", "format"}
+
+var jsonNonNegativeIntegerKeywords = []string{"minLength", "maxLength", "minItems", "maxItems", "minProperties",
+	"maxProperties", "minContains", "maxContains"}
+
+func (sl *SchemaLoader) loadJsonFiles(filePath string, info os.FileInfo, err error) error {
+	check(err)
+
+	if info.IsDir() {
+		return nil
+	}
+	if !strings.HasSuffix(filePath, jsonSchemaExtension) {
+		log.Printf("Skipping %s, JSON schema loads only read %s files", filePath, jsonSchemaExtension)
+		return nil
+	}
+
+	contents, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		log.Printf("Could not read schema file %s: %v", filePath, err)
+		return nil
+	}
+	relativePath, err := filepath.Rel(sl.path, filePath)
+	check(err)
+
+	file, id, err := parseJsonSchemaFile(filepath.ToSlash(relativePath), contents)
+	if err != nil {
+		log.Printf("Could not load schema file %s: %v", filePath, err)
+		return nil
+	}
+	file.path = filePath
+	sl.loadedFiles[file.name] = file
+	if id != "" {
+		sl.loadedIds[id] = file.name
+	}
+	return nil
+}
+
+// Returns the file described by the given JSON Schema contents along with its $id,
+// or an error listing every problem found in the schema
+func parseJsonSchemaFile(name string, contents []byte) (*loadedFile, string, error) {
+	var schema interface{}
+	if err := json.Unmarshal(contents, &schema); err != nil {
+		return nil, "", fmt.Errorf("not valid JSON: %w", err)
+	}
+
+	refs := map[string]bool{}
+	problems := validateJsonSchema(schema, "#", refs)
+	if len(problems) != 0 {
+		return nil, "", fmt.Errorf("not a well-formed JSON Schema:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	file := &loadedFile{name: name, contents: string(contents), references: []fileReference{}}
+	id := ""
+	if schemaObject, isObject := schema.(map[string]interface{}); isObject {
+		file.schemaName, _ = schemaObject["title"].(string)
+		id, _ = schemaObject["$id"].(string)
+	}
+
+	sortedRefs := []string{}
+	for ref := range refs {
+		sortedRefs = append(sortedRefs, ref)
+	}
+	sort.Strings(sortedRefs)
+	for _, ref := range sortedRefs {
+		if reference, external := externalJsonReference(name, id, ref); external {
+			file.references = append(file.references, reference)
+		}
+	}
+	return file, id, nil
+}
+
+// Returns the reference to another file described by the given $ref, if it points outside of the file
+func externalJsonReference(name string, id string, ref string) (fileReference, bool) {
+	target := ref
+	if fragment := strings.Index(target, "#"); fragment != -1 {
+		target = target[:fragment]
+	}
+	if target == "" || target == id {
+		return fileReference{}, false
+	}
+
+	if parsed, err := url.Parse(target); err == nil && parsed.IsAbs() {
+		return fileReference{name: target, file: target}, true
+	}
+	return fileReference{name: target, file: path.Clean(path.Join(path.Dir(name), target))}, true
+}
+
+// Returns the problems found in the given schema, by JSON pointer, collecting the $ref it holds
+func validateJsonSchema(schema interface{}, pointer string, refs map[string]bool) []string {
+	problems := []string{}
+
+	schemaObject, isObject := schema.(map[string]interface{})
+	if !isObject {
+		if _, isBool := schema.(bool); isBool {
+			return problems
+		}
+		return append(problems, fmt.Sprintf("%s: a schema must be an object or a boolean", pointer))
+	}
+
+	for _, keyword := range jsonStringKeywords {
+		if value, exists := schemaObject[keyword]; exists {
+			if _, isString := value.(string); !isString {
+				problems = append(problems, fmt.Sprintf("%s/%s: must be a string", pointer, keyword))
+			}
+		}
+	}
+	if ref, isString := schemaObject["$ref"].(string); isString {
+		refs[ref] = true
+	}
+
+	if value, exists := schemaObject["type"]; exists {
+		problems = append(problems, validateJsonSchemaType(value, pointer+"/type")...)
+	}
+
+	if value, exists := schemaObject["required"]; exists {
+		required, isArray := value.([]interface{})
+		if !isArray {
+			problems = append(problems, fmt.Sprintf("%s/required: must be an array of strings", pointer))
+		}
+		for _, property := range required {
+			if _, isString := property.(string); !isString {
+				problems = append(problems, fmt.Sprintf("%s/required: must be an array of strings", pointer))
+				break
+			}
+		}
+	}
+
+	if value, exists := schemaObject["enum"]; exists {
+		if enum, isArray := value.([]interface{}); !isArray || len(enum) == 0 {
+			problems = append(problems, fmt.Sprintf("%s/enum: must be a non-empty array", pointer))
+		}
+	}
+
+	for _, keyword := range jsonNonNegativeIntegerKeywords {
+		if value, exists := schemaObject[keyword]; exists {
+			if number, isNumber := value.(float64); !isNumber || number < 0 || number != float64(int64(number)) {
+				problems = append(problems, fmt.Sprintf("%s/%s: must be a non-negative integer", pointer, keyword))
+			}
+		}
+	}
+	if value, exists := schemaObject["multipleOf"]; exists {
+		if number, isNumber := value.(float64); !isNumber || number <= 0 {
+			problems = append(problems, fmt.Sprintf("%s/multipleOf: must be a number greater than 0", pointer))
+		}
+	}
+
+	for _, keyword := range jsonSubschemaKeywords {
+		if value, exists := schemaObject[keyword]; exists {
+			problems = append(problems, validateJsonSchema(value, pointer+"/"+keyword, refs)...)
+		}
+	}
+
+	if value, exists := schemaObject["items"]; exists {
+		if items, isArray := value.([]interface{}); isArray {
+			for i, item := range items {
+				problems = append(problems, validateJsonSchema(item, fmt.Sprintf("%s/items/%d", pointer, i), refs)...)
+			}
+		} else {
+			problems = append(problems, validateJsonSchema(value, pointer+"/items", refs)...)
+		}
+	}
+
+	for _, keyword := range jsonSchemaMapKeywords {
+		value, exists := schemaObject[keyword]
+		if !exists {
+			continue
+		}
+		schemas, isMap := value.(map[string]interface{})
+		if !isMap {
+			problems = append(problems, fmt.Sprintf("%s/%s: must be an object of schemas", pointer, keyword))
+			continue
+		}
+		for _, key := range sortedKeys(schemas) {
+			problems = append(problems, validateJsonSchema(schemas[key], pointer+"/"+keyword+"/"+escapeJsonPointer(key), refs)...)
+		}
+	}
+
+	for _, keyword := range jsonSchemaArrayKeywords {
+		value, exists := schemaObject[keyword]
+		if !exists {
+			continue
+		}
+		schemas, isArray := value.([]interface{})
+		if !isArray || len(schemas) == 0 {
+			problems = append(problems, fmt.Sprintf("%s/%s: must be a non-empty array of schemas", pointer, keyword))
+			continue
+		}
+		for i, subschema := range schemas {
+			problems = append(problems, validateJsonSchema(subschema, fmt.Sprintf("%s/%s/%d", pointer, keyword, i), refs)...)
+		}
+	}
+
+	return problems
+}
+
+func validateJsonSchemaType(value interface{}, pointer string) []string {
+	switch typed := value.(type) {
+	case string:
+		if !jsonSchemaTypes[typed] {
+			return []string{fmt.Sprintf("%s: unknown type %s", pointer, typed)}
+		}
+		return []string{}
+	case []interface{}:
+		problems := []string{}
+		seen := map[string]bool{}
+		for _, oneType := range typed {
+			typeName, isString := oneType.(string)
+			if !isString || !jsonSchemaTypes[typeName] {
+				problems = append(problems, fmt.Sprintf("%s: unknown type %v", pointer, oneType))
+			} else if seen[typeName] {
+				problems = append(problems, fmt.Sprintf("%s: type %s is listed twice", pointer, typeName))
+			}
+			seen[typeName] = true
+		}
+		return problems
+	}
+	return []string{fmt.Sprintf("%s: must be a type name or an array of type names", pointer)}
+}
+
+func escapeJsonPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
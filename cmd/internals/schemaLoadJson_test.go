@@ -0,0 +1,75 @@
+package client
+
+//
+// schemaLoadJson_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var jsonMoney = `{"$id":"https://schemas.acme.com/money.json","title":"Money","type":"object","properties":{"currency":{"type":"string"},"units":{"type":"integer"}}}`
+var jsonAddress = `{"title":"Address","type":"object","properties":{"city":{"type":"string"}}}`
+var jsonOrder = `{"title":"com.acme.Order","type":"object","required":["id"],"properties":{"id":{"type":"string"},` +
+	`"price":{"$ref":"https://schemas.acme.com/money.json"},"shipTo":{"$ref":"common/address.json#/properties/city"},` +
+	`"lines":{"type":"array","items":{"$ref":"#/definitions/line"}}},"definitions":{"line":{"type":"object"}}}`
+var jsonBroken = `{"title":"Broken","type":"strnig","properties":{"a":{"minLength":-1}}}`
+
+func TestMainStackSchemaLoadJson(t *testing.T) {
+	t.Run("TValidateJsonSchema", func(t *testing.T) { TValidateJsonSchema(t) })
+	t.Run("TJsonLoadRegistersReferencesFirst", func(t *testing.T) { TJsonLoadRegistersReferencesFirst(t) })
+}
+
+func TValidateJsonSchema(t *testing.T) {
+	_, _, err := parseJsonSchemaFile("broken.json", []byte(jsonBroken))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "#/type: unknown type strnig")
+	assert.Contains(t, err.Error(), "#/properties/a/minLength: must be a non-negative integer")
+
+	_, _, err = parseJsonSchemaFile("notJson.json", []byte(`{"title":`))
+	assert.NotNil(t, err)
+
+	file, id, err := parseJsonSchemaFile("orders/order.json", []byte(jsonOrder))
+	assert.Nil(t, err)
+	assert.Equal(t, "", id)
+	assert.Equal(t, "com.acme.Order", file.schemaName)
+	assert.Equal(t, []fileReference{
+		{name: "common/address.json", file: "orders/common/address.json"},
+		{name: "https://schemas.acme.com/money.json", file: "https://schemas.acme.com/money.json"},
+	}, file.references)
+}
+
+func TJsonLoadRegistersReferencesFirst(t *testing.T) {
+	HttpCallTimeout = 60
+	registry := newFakeRegistry()
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	schemaDir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(schemaDir, "common"), 0755))
+	writeWatchedFile(t, schemaDir, "money.json", jsonMoney)
+	writeWatchedFile(t, schemaDir, "common/address.json", jsonAddress)
+	writeWatchedFile(t, schemaDir, "order.json", jsonOrder)
+	writeWatchedFile(t, schemaDir, "broken.json", jsonBroken)
+
+	loader := NewSchemaLoader(JSON.String(), NewSchemaRegistryClient(server.URL, "key", "secret", "dst"), schemaDir, "")
+	loader.Run()
+
+	assert.Equal(t, 1, registry.versionCount("money.json"))
+	assert.Equal(t, 1, registry.versionCount("common/address.json"))
+	assert.Equal(t, 0, registry.versionCount("Broken-value"))
+
+	order := registry.latest("com.acme.Order-value")
+	assert.Equal(t, "JSON", order.SType)
+	assert.Equal(t, jsonOrder, order.Schema)
+	assert.Equal(t, []SchemaReference{
+		{Name: "common/address.json", Subject: "common/address.json", Version: 1},
+		{Name: "https://schemas.acme.com/money.json", Subject: "money.json", Version: 1},
+	}, order.References)
+}
@@ -0,0 +1,172 @@
+package client
+
+//
+// schemaLoadProtobuf.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+/*
+Protobuf schema loads register every .proto file found under the path. Imports are resolved relative to the
+path and become references, the imported files being registered first, each under a subject named after its
+import path. Other files are registered under the full name of their first top-level message with a -value
+suffix, or under their path when they declare no message. Well-known types (google/protobuf, google/type and
+confluent imports) are built into Schema Registry and are not registered.
+*/
+
+var protoExtension = ".proto"
+var wellKnownProtoPrefixes = []string{"google/protobuf/", "google/type/", "confluent/"}
+
+var protoPackagePattern = regexp.MustCompile(`^\s*package\s+([\w.]+)\s*;`)
+var protoImportPattern = regexp.MustCompile(`^\s*import\s+(?:public\s+|weak\s+)?"([^"]+)"\s*;`)
+var protoMessagePattern = regexp.MustCompile(`^message\s+(\w+)`)
+
+// Declarations of a .proto file
+type protoFile struct {
+	pkg      string   // Package declared by the file
+	imports  []string // Files imported by the file
+	messages []string // Top-level messages declared by the file
+}
+
+func (sl *SchemaLoader) loadProtobufFiles(path string, info os.FileInfo, err error) error {
+	check(err)
+
+	if info.IsDir() {
+		return nil
+	}
+	if !strings.HasSuffix(path, protoExtension) {
+		log.Printf("Skipping %s, Protobuf schema loads only read %s files", path, protoExtension)
+		return nil
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Printf("Could not read schema file %s: %v", path, err)
+		return nil
+	}
+	relativePath, err := filepath.Rel(sl.path, path)
+	check(err)
+
+	declarations := parseProtoFile(string(contents))
+	file := &loadedFile{
+		path:       path,
+		name:       filepath.ToSlash(relativePath),
+		contents:   string(contents),
+		references: []fileReference{},
+	}
+	if len(declarations.messages) != 0 {
+		file.schemaName = declarations.messages[0]
+		if declarations.pkg != "" {
+			file.schemaName = fmt.Sprintf("%s.%s", declarations.pkg, declarations.messages[0])
+		}
+	}
+	for _, importPath := range declarations.imports {
+		if !isWellKnownProto(importPath) {
+			file.references = append(file.references, fileReference{name: importPath, file: importPath})
+		}
+	}
+	sl.loadedFiles[file.name] = file
+	return nil
+}
+
+// Returns the package, imports and top-level messages declared in the given .proto contents
+func parseProtoFile(contents string) *protoFile {
+	file := &protoFile{imports: []string{}, messages: []string{}}
+
+	depth := 0
+	for _, statement := range protoStatements(stripProtoComments(contents)) {
+		if depth == 0 {
+			if match := protoPackagePattern.FindStringSubmatch(statement); match != nil {
+				file.pkg = match[1]
+			} else if match := protoImportPattern.FindStringSubmatch(statement); match != nil {
+				file.imports = append(file.imports, match[1])
+			} else if match := protoMessagePattern.FindStringSubmatch(strings.TrimSpace(statement)); match != nil {
+				file.messages = append(file.messages, match[1])
+			}
+		}
+		depth += strings.Count(statement, "{") - strings.Count(statement, "}")
+	}
+	return file
+}
+
+// Splits .proto contents into statements, ending at semicolons and braces outside of string literals
+func protoStatements(contents string) []string {
+	statements := []string{}
+	var current strings.Builder
+	var quote rune
+	escaped := false
+	for _, char := range contents {
+		current.WriteRune(char)
+		switch {
+		case quote != 0 && escaped:
+			escaped = false
+		case quote != 0:
+			if char == '\\' {
+				escaped = true
+			} else if char == quote {
+				quote = 0
+			}
+		case char == '"' || char == '\'':
+			quote = char
+		case char == ';' || char == '{' || char == '}':
+			statements = append(statements, current.String())
+			current.Reset()
+		}
+	}
+	return statements
+}
+
+// Removes line and block comments from .proto contents, leaving string literals untouched
+func stripProtoComments(contents string) string {
+	var stripped strings.Builder
+	var quote byte
+	escaped := false
+	for i := 0; i < len(contents); i++ {
+		char := contents[i]
+		switch {
+		case quote != 0 && escaped:
+			escaped = false
+		case quote != 0:
+			if char == '\\' {
+				escaped = true
+			} else if char == quote {
+				quote = 0
+			}
+		case char == '"' || char == '\'':
+			quote = char
+		case strings.HasPrefix(contents[i:], "//"):
+			for i < len(contents) && contents[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(contents[i:], "/*"):
+			end := strings.Index(contents[i+2:], "*/")
+			if end == -1 {
+				return stripped.String()
+			}
+			i += end + 3
+			continue
+		}
+		if i < len(contents) {
+			stripped.WriteByte(contents[i])
+		}
+	}
+	return stripped.String()
+}
+
+func isWellKnownProto(importPath string) bool {
+	for _, prefix := range wellKnownProtoPrefixes {
+		if strings.HasPrefix(importPath, prefix) {
+			return true
+		}
+	}
+	return false
+}
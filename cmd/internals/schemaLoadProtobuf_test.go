@@ -0,0 +1,89 @@
+package client
+
+//
+// schemaLoadProtobuf_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var protoMoney = `syntax = "proto3";
+package com.acme.common;
+
+// Amounts are kept in minor units
+message Money {
+  string currency = 1;
+  int64 units = 2;
+}
+`
+
+var protoOrder = `syntax = "proto3";
+package com.acme.orders;
+
+import "common/money.proto";
+import "google/protobuf/timestamp.proto";
+
+/* An order,
+   message NotTopLevel { } */
+message Order {
+  message Line {
+    string sku = 1;
+    com.acme.common.Money price = 2;
+  }
+  string id = 1 [json_name = "id;{"];
+  repeated Line lines = 2;
+  google.protobuf.Timestamp created = 3;
+}
+
+enum Status {
+  UNKNOWN = 0;
+}
+`
+
+func TestMainStackSchemaLoadProtobuf(t *testing.T) {
+	t.Run("TParseProtoFile", func(t *testing.T) { TParseProtoFile(t) })
+	t.Run("TProtobufLoadRegistersImportsFirst", func(t *testing.T) { TProtobufLoadRegistersImportsFirst(t) })
+}
+
+func TParseProtoFile(t *testing.T) {
+	file := parseProtoFile(protoOrder)
+
+	assert.Equal(t, "com.acme.orders", file.pkg)
+	assert.Equal(t, []string{"common/money.proto", "google/protobuf/timestamp.proto"}, file.imports)
+	assert.Equal(t, []string{"Order"}, file.messages)
+}
+
+func TProtobufLoadRegistersImportsFirst(t *testing.T) {
+	HttpCallTimeout = 60
+	registry := newFakeRegistry()
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	schemaDir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(schemaDir, "common"), 0755))
+	writeWatchedFile(t, schemaDir, "common/money.proto", protoMoney)
+	writeWatchedFile(t, schemaDir, "order.proto", protoOrder)
+	writeWatchedFile(t, schemaDir, "README.md", "Not a schema")
+
+	loader := NewSchemaLoader(PROTOBUF.String(), NewSchemaRegistryClient(server.URL, "key", "secret", "dst"), schemaDir, "")
+	loader.Run()
+
+	assert.Equal(t, 1, registry.versionCount("common/money.proto"))
+	assert.Equal(t, protoMoney, registry.latest("common/money.proto").Schema)
+	assert.Equal(t, "PROTOBUF", registry.latest("common/money.proto").SType)
+
+	order := registry.latest("com.acme.orders.Order-value")
+	assert.Equal(t, protoOrder, order.Schema)
+	assert.Equal(t, []SchemaReference{{Name: "common/money.proto", Subject: "common/money.proto", Version: 1}}, order.References)
+
+	// Loading again registers nothing new
+	loader.Run()
+	assert.Equal(t, 1, registry.versionCount("com.acme.orders.Order-value"))
+}
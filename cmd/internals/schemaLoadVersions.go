@@ -0,0 +1,223 @@
+package client
+
+//
+// schemaLoadVersions.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+/*
+AVRO schema loads find the versions of a schema in the files declaring the same record (namespace and name).
+-versionOrder decides which file holds which version:
+	FILE_NAME     the lexicographical order of the file paths (orders_v1.avsc before orders_v2.avsc)
+	FILE_VERSION  the version number ending the file name or naming a directory (orders_v2.avsc, orders-2.avsc, v2/orders.avsc),
+	              compared as numbers so v10 comes after v9
+	SIDECAR       the version field of the sidecar next to the file (orders.meta.json for orders.avsc)
+	MTIME         the modification time of the files
+	GIT_HISTORY   the time of the commit adding the file to the Git repository holding the path, files not committed
+	              yet coming last in modification time order
+Files declaring a record with the same contents as another file are reported and only registered once.
+*/
+
+// Define VersionOrder enum
+type VersionOrder int
+
+const (
+	FILE_NAME VersionOrder = iota
+	FILE_VERSION
+	SIDECAR
+	MTIME
+	GIT_HISTORY
+)
+
+func (vo VersionOrder) String() string {
+	return [...]string{"FILE_NAME", "FILE_VERSION", "SIDECAR", "MTIME", "GIT_HISTORY"}[vo]
+}
+
+func ParseVersionOrder(order string) (VersionOrder, error) {
+	for _, versionOrder := range []VersionOrder{FILE_NAME, FILE_VERSION, SIDECAR, MTIME, GIT_HISTORY} {
+		if strings.EqualFold(order, versionOrder.String()) {
+			return versionOrder, nil
+		}
+	}
+	if order == "" {
+		return FILE_NAME, nil
+	}
+	return FILE_NAME, fmt.Errorf("unknown version order %s, expected one of FILE_NAME, FILE_VERSION, SIDECAR, MTIME or GIT_HISTORY", order)
+}
+
+var fileNameVersionPattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])v?(\d+)$`)
+var directoryVersionPattern = regexp.MustCompile(`(?i)^v?(\d+)$`)
+
+// A file declaring a version of a schema, before versions are decided
+type schemaCandidate struct {
+	path    string
+	schema  map[string]interface{}
+	modTime time.Time
+}
+
+// Position of a file among the versions of its schema: files are ordered by rank, then value, then path
+type versionKey struct {
+	rank  int64
+	value int64
+}
+
+// Decides the version of every file read by the load, in the order chosen with -versionOrder
+func (sl *SchemaLoader) orderAvroVersions() {
+	commitTimes := map[string]time.Time{}
+	if sl.versionOrder == GIT_HISTORY {
+		commitTimes = sl.firstCommitTimes()
+	}
+
+	for desc, candidates := range sl.schemaCandidates {
+		keys := map[string]versionKey{}
+		ordered := []schemaCandidate{}
+		for _, candidate := range candidates {
+			key, hasKey := sl.versionKeyOf(candidate, commitTimes)
+			if !hasKey {
+				continue
+			}
+			keys[candidate.path] = key
+			ordered = append(ordered, candidate)
+		}
+		sort.Slice(ordered, func(i, j int) bool {
+			left, right := keys[ordered[i].path], keys[ordered[j].path]
+			if left != right {
+				return left.rank < right.rank || (left.rank == right.rank && left.value < right.value)
+			}
+			return ordered[i].path < ordered[j].path
+		})
+
+		declaredBy := map[string]string{} // Contents -> first file declaring them
+		for i, candidate := range ordered {
+			contents, err := json.Marshal(candidate.schema)
+			check(err)
+			if firstFile, duplicate := declaredBy[string(contents)]; duplicate {
+				log.Printf("%s declares %s with the same contents as %s, it is only registered once", candidate.path, fullNameOf(desc), firstFile)
+				continue
+			}
+			declaredBy[string(contents)] = candidate.path
+			if i > 0 && (sl.versionOrder == FILE_VERSION || sl.versionOrder == SIDECAR) && keys[candidate.path] == keys[ordered[i-1].path] {
+				log.Printf("%s and %s both declare version %d of %s, ordering them by path", ordered[i-1].path, candidate.path,
+					keys[candidate.path].value, fullNameOf(desc))
+			}
+
+			version := int64(len(sl.schemaRecords[desc]))
+			if version == 0 {
+				sl.schemaRecords[desc] = map[int64]map[string]interface{}{}
+				sl.schemaFiles[desc] = map[int64]string{}
+			}
+			sl.schemaRecords[desc][version] = candidate.schema
+			sl.schemaFiles[desc][version] = candidate.path
+		}
+	}
+	sl.schemaCandidates = map[SchemaDescriptor][]schemaCandidate{}
+}
+
+// Returns the position of the given file among the versions of its schema, or false when it can not be told
+func (sl *SchemaLoader) versionKeyOf(candidate schemaCandidate, commitTimes map[string]time.Time) (versionKey, bool) {
+	switch sl.versionOrder {
+	case FILE_VERSION:
+		version, found := fileVersionNumber(sl.path, candidate.path)
+		if !found {
+			log.Printf("Skipping %s, neither its name nor its directory holds a version number", candidate.path)
+		}
+		return versionKey{value: version}, found
+	case SIDECAR:
+		version, err := sidecarVersionNumber(candidate.path)
+		if err != nil {
+			log.Printf("Skipping %s, could not read its version from a sidecar: %v", candidate.path, err)
+			return versionKey{}, false
+		}
+		return versionKey{value: version}, true
+	case MTIME:
+		return versionKey{value: candidate.modTime.UnixNano()}, true
+	case GIT_HISTORY:
+		if commitTime, committed := commitTimes[candidate.path]; committed {
+			return versionKey{value: commitTime.UnixNano()}, true
+		}
+		return versionKey{rank: 1, value: candidate.modTime.UnixNano()}, true
+	}
+	return versionKey{}, true
+}
+
+// Returns the version number ending the name of the given file, or else naming its closest directory under the root
+func fileVersionNumber(root string, filePath string) (int64, bool) {
+	fileName := filepath.Base(filePath)
+	if match := fileNameVersionPattern.FindStringSubmatch(strings.TrimSuffix(fileName, filepath.Ext(fileName))); match != nil {
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		return version, err == nil
+	}
+	for dir := filepath.Dir(filePath); dir != filepath.Clean(root) && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if match := directoryVersionPattern.FindStringSubmatch(filepath.Base(dir)); match != nil {
+			version, err := strconv.ParseInt(match[1], 10, 64)
+			return version, err == nil
+		}
+	}
+	return 0, false
+}
+
+// Returns the version field of the sidecar of the given schema file
+func sidecarVersionNumber(schemaPath string) (int64, error) {
+	sidecarPath := sidecarPathOf(schemaPath)
+	if sidecarPath == "" {
+		sidecarPath = strings.TrimSuffix(schemaPath, filepath.Ext(schemaPath)) + sidecarExtension
+	}
+	contents, err := ioutil.ReadFile(sidecarPath)
+	if err != nil {
+		return 0, err
+	}
+	var sidecar struct {
+		Version *int64 `json:"version"`
+	}
+	if err := json.Unmarshal(contents, &sidecar); err != nil {
+		return 0, fmt.Errorf("%s: %w", sidecarPath, err)
+	}
+	if sidecar.Version == nil {
+		return 0, fmt.Errorf("%s has no version field", sidecarPath)
+	}
+	return *sidecar.Version, nil
+}
+
+// Returns the time of the commit that added each file of the load to the Git repository holding the path
+func (sl *SchemaLoader) firstCommitTimes() map[string]time.Time {
+	commitTimes := map[string]time.Time{}
+	repo, err := git.PlainOpenWithOptions(sl.path, &git.PlainOpenOptions{DetectDotGit: true})
+	checkFail(err, "Could not open the Git repository holding "+sl.path)
+	worktree, err := repo.Worktree()
+	checkFail(err, "Could not open the Git repository holding "+sl.path)
+	if _, err := repo.Head(); err != nil {
+		log.Printf("The Git repository holding %s has no commits, ordering versions by modification time", sl.path)
+		return commitTimes
+	}
+
+	for _, candidates := range sl.schemaCandidates {
+		for _, candidate := range candidates {
+			relativePath, err := filepath.Rel(worktree.Filesystem.Root(), candidate.path)
+			check(err)
+			fileName := filepath.ToSlash(relativePath)
+			commits, err := repo.Log(&git.LogOptions{FileName: &fileName})
+			check(err)
+			for commit, err := commits.Next(); err == nil; commit, err = commits.Next() {
+				// Commits come newest first, the last one added the file
+				commitTimes[candidate.path] = commit.Committer.When
+			}
+			commits.Close()
+		}
+	}
+	return commitTimes
+}
@@ -0,0 +1,154 @@
+package client
+
+//
+// schemaLoadVersions_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackSchemaLoadVersions(t *testing.T) {
+	t.Run("TParseVersionOrder", func(t *testing.T) { TParseVersionOrder(t) })
+	t.Run("TFileVersionNumber", func(t *testing.T) { TFileVersionNumber(t) })
+	t.Run("TOrderByFileVersion", func(t *testing.T) { TOrderByFileVersion(t) })
+	t.Run("TOrderBySidecar", func(t *testing.T) { TOrderBySidecar(t) })
+	t.Run("TOrderByModificationTime", func(t *testing.T) { TOrderByModificationTime(t) })
+	t.Run("TOrderByGitHistory", func(t *testing.T) { TOrderByGitHistory(t) })
+	t.Run("TIdenticalVersionsLoadedOnce", func(t *testing.T) { TIdenticalVersionsLoadedOnce(t) })
+}
+
+var watchDescriptor = SchemaDescriptor{namespace: "com.mycorp.watch", name: "reference"}
+
+// Returns the files holding each version of the reference schema once the given path is loaded in the given order
+func loadedVersionFiles(t *testing.T, schemaDir string, order string) []string {
+	SchemaVersionOrder = order
+	defer func() { SchemaVersionOrder = "" }()
+
+	loader := NewSchemaLoader(AVRO.String(), nil, schemaDir, "")
+	loader.loadFromPath()
+	files := []string{}
+	for version := int64(0); version < int64(len(loader.schemaFiles[watchDescriptor])); version++ {
+		relativePath, err := filepath.Rel(schemaDir, loader.schemaFiles[watchDescriptor][version])
+		assert.Nil(t, err)
+		files = append(files, filepath.ToSlash(relativePath))
+	}
+	return files
+}
+
+func TParseVersionOrder(t *testing.T) {
+	order, err := ParseVersionOrder("git_history")
+	assert.Nil(t, err)
+	assert.Equal(t, GIT_HISTORY, order)
+
+	order, err = ParseVersionOrder("")
+	assert.Nil(t, err)
+	assert.Equal(t, FILE_NAME, order)
+
+	_, err = ParseVersionOrder("SEMVER")
+	assert.NotNil(t, err)
+}
+
+func TFileVersionNumber(t *testing.T) {
+	root := filepath.FromSlash("/schemas")
+	for file, expected := range map[string]int64{
+		"orders_v2.avsc":       2,
+		"orders-12.avsc":       12,
+		"orders.V3.avsc":       3,
+		"v4/orders.avsc":       4,
+		"5/avro/orders.avsc":   5,
+		"v6/orders_v7.avsc":    7,
+		"orders/v8.avsc":       8,
+		"schemas2/orders.avsc": -1,
+		"orders2.avsc":         -1,
+	} {
+		version, found := fileVersionNumber(root, filepath.Join(root, filepath.FromSlash(file)))
+		if expected == -1 {
+			assert.False(t, found, file)
+		} else {
+			assert.True(t, found, file)
+			assert.Equal(t, expected, version, file)
+		}
+	}
+}
+
+func TOrderByFileVersion(t *testing.T) {
+	schemaDir := t.TempDir()
+	writeWatchedFile(t, schemaDir, "reference_v10.avsc", watchedReferenceEvolved)
+	writeWatchedFile(t, schemaDir, "reference_v9.avsc", watchedReference)
+	writeWatchedFile(t, schemaDir, "reference.avsc", `{"type":"record","namespace":"com.mycorp.watch","name":"reference","fields":[]}`)
+
+	assert.Equal(t, []string{"reference.avsc", "reference_v10.avsc", "reference_v9.avsc"}, loadedVersionFiles(t, schemaDir, "FILE_NAME"))
+	// Files without a version number are skipped
+	assert.Equal(t, []string{"reference_v9.avsc", "reference_v10.avsc"}, loadedVersionFiles(t, schemaDir, "FILE_VERSION"))
+}
+
+func TOrderBySidecar(t *testing.T) {
+	schemaDir := t.TempDir()
+	writeWatchedFile(t, schemaDir, "a.avsc", watchedReferenceEvolved)
+	writeWatchedFile(t, schemaDir, "a.meta.json", `{"version": 2}`)
+	writeWatchedFile(t, schemaDir, "b.avsc", watchedReference)
+	writeWatchedFile(t, schemaDir, "b.meta.json", `{"version": 1}`)
+	writeWatchedFile(t, schemaDir, "c.avsc", `{"type":"record","namespace":"com.mycorp.watch","name":"reference","fields":[]}`)
+
+	assert.Equal(t, []string{"b.avsc", "a.avsc"}, loadedVersionFiles(t, schemaDir, "SIDECAR"))
+}
+
+func TOrderByModificationTime(t *testing.T) {
+	schemaDir := t.TempDir()
+	writeWatchedFile(t, schemaDir, "a.avsc", watchedReferenceEvolved)
+	writeWatchedFile(t, schemaDir, "b.avsc", watchedReference)
+	now := time.Now()
+	assert.Nil(t, os.Chtimes(filepath.Join(schemaDir, "a.avsc"), now, now))
+	assert.Nil(t, os.Chtimes(filepath.Join(schemaDir, "b.avsc"), now.Add(-time.Hour), now.Add(-time.Hour)))
+
+	assert.Equal(t, []string{"b.avsc", "a.avsc"}, loadedVersionFiles(t, schemaDir, "MTIME"))
+}
+
+func TOrderByGitHistory(t *testing.T) {
+	repoDir := t.TempDir()
+	schemaDir := filepath.Join(repoDir, "schemas")
+	assert.Nil(t, os.MkdirAll(schemaDir, 0755))
+	repo, err := git.PlainInit(repoDir, false)
+	assert.Nil(t, err)
+	worktree, err := repo.Worktree()
+	assert.Nil(t, err)
+
+	commitFile := func(name string, contents string, when time.Time) {
+		writeWatchedFile(t, schemaDir, name, contents)
+		_, err := worktree.Add("schemas/" + name)
+		assert.Nil(t, err)
+		signature := &object.Signature{Name: "test", Email: "test@localhost", When: when}
+		_, err = worktree.Commit("Add "+name, &git.CommitOptions{Author: signature, Committer: signature})
+		assert.Nil(t, err)
+	}
+	firstCommit := time.Now().Add(-2 * time.Hour)
+	commitFile("z.avsc", watchedReference, firstCommit)
+	commitFile("a.avsc", watchedReferenceEvolved, firstCommit.Add(time.Hour))
+	// Changing a file does not change when it was added
+	commitFile("z.avsc", `{"type":"record","namespace":"com.mycorp.watch","name":"reference","fields":[{"name":"z","type":"int"}]}`,
+		firstCommit.Add(90*time.Minute))
+	writeWatchedFile(t, schemaDir, "b.avsc", `{"type":"record","namespace":"com.mycorp.watch","name":"reference","fields":[]}`)
+
+	assert.Equal(t, []string{"z.avsc", "a.avsc", "b.avsc"}, loadedVersionFiles(t, schemaDir, "GIT_HISTORY"))
+}
+
+func TIdenticalVersionsLoadedOnce(t *testing.T) {
+	schemaDir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(schemaDir, "copy"), 0755))
+	writeWatchedFile(t, schemaDir, "reference_v1.avsc", watchedReference)
+	writeWatchedFile(t, schemaDir, "reference_v2.avsc", watchedReferenceEvolved)
+	// Same contents, formatted differently
+	writeWatchedFile(t, filepath.Join(schemaDir, "copy"), "reference_v1.avsc",
+		`{"name": "reference", "namespace": "com.mycorp.watch", "type": "record", "fields": [{"name": "this", "type": "int"}]}`)
+
+	assert.Equal(t, []string{"copy/reference_v1.avsc", "reference_v2.avsc"}, loadedVersionFiles(t, schemaDir, "FILE_VERSION"))
+}
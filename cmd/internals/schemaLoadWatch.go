@@ -0,0 +1,263 @@
+package client
+
+//
+// schemaLoadWatch.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Time to wait for a file to stop changing before loading it, as editors usually write files in several steps
+var watchDebounce = 500 * time.Millisecond
+
+/*
+Watch loads the schemas of the path once, like Run, then keeps registering new versions as files change
+until interrupted. Only the changed files are parsed again. The latest version of every schema held by a
+changed file is registered, along with the latest version of the schemas referencing it so their references
+point to the new version. Files that can not be parsed, or reference schemas not found in the path, are
+reported and skipped rather than stopping the watch.
+*/
+func (sl *SchemaLoader) Watch() {
+	sl.watchUntil(nil)
+}
+
+// Watches the path until interrupted, or until the given channel is closed
+func (sl *SchemaLoader) watchUntil(stop <-chan struct{}) {
+	sl.watching = true
+	sl.Run()
+	if CancelRun == true {
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	checkFail(err, "Could not watch "+sl.path)
+	defer watcher.Close()
+	checkFail(watchDirectories(watcher, sl.path), "Could not watch "+sl.path)
+	log.Printf("Watching %s for schema changes", sl.path)
+
+	changedFiles := map[string]bool{}
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	cancelCheck := time.NewTicker(100 * time.Millisecond)
+	defer cancelCheck.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&fsnotify.Create != 0 && isDirectory(event.Name) {
+				// Files may have been written in the new directory before it was watched
+				checkDontFail(watchDirectories(watcher, event.Name))
+				checkDontFail(filepath.Walk(event.Name, func(path string, info os.FileInfo, err error) error {
+					if err == nil && !info.IsDir() {
+						changedFiles[path] = true
+					}
+					return nil
+				}))
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) != 0 {
+				changedFiles[event.Name] = true
+				debounce.Reset(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Error while watching %s: %v", sl.path, err)
+		case <-debounce.C:
+			sl.loadChangedFiles(changedFiles)
+			changedFiles = map[string]bool{}
+		case <-cancelCheck.C:
+			if CancelRun == true {
+				log.Println("Stopped watching " + sl.path)
+				return
+			}
+		case <-stop:
+			log.Println("Stopped watching " + sl.path)
+			return
+		}
+	}
+}
+
+// Parses the changed files again, and registers the schemas they hold along with the schemas referencing them
+func (sl *SchemaLoader) loadChangedFiles(changedFiles map[string]bool) {
+	if sl.schemasType == PROTOBUF || sl.schemasType == JSON {
+		sl.loadChangedSchemaFiles(changedFiles)
+		return
+	}
+
+	previousFiles := sl.schemaFiles
+	for file := range changedFiles {
+		delete(sl.parsedFiles, file)
+	}
+	sl.schemaRecords = map[SchemaDescriptor]map[int64]map[string]interface{}{}
+	sl.schemaFiles = map[SchemaDescriptor]map[int64]string{}
+	sl.avroResolved = map[avroVersion]avroRegistration{}
+	sl.missingRefs = []string{}
+	sl.loadFromPath()
+
+	changedDescriptors := map[SchemaDescriptor]bool{}
+	for desc, files := range sl.schemaFiles {
+		latestVersion := int64(len(files) - 1)
+		for version, file := range files {
+			if !changedFiles[file] {
+				continue
+			}
+			changedDescriptors[desc] = true
+			if version != latestVersion {
+				log.Printf("%s holds version %d of %s, only the latest version (%s) is registered while watching",
+					file, version+1, fullNameOf(desc), files[latestVersion])
+			}
+		}
+	}
+	for desc, files := range previousFiles {
+		for _, file := range files {
+			if changedFiles[file] && !fileExists(file) {
+				log.Printf("%s was removed, the versions of %s registered from it are kept", file, fullNameOf(desc))
+				if _, stillLoaded := sl.schemaRecords[desc]; stillLoaded {
+					changedDescriptors[desc] = true
+				}
+			}
+		}
+	}
+
+	for _, desc := range sortedDescriptors(sl.withReferencingSchemas(changedDescriptors)) {
+		if CancelRun == true {
+			return
+		}
+		if sl.inlineTypes[desc] {
+			// Registered along with the schemas referencing it
+			continue
+		}
+		versions := sl.schemaRecords[desc]
+		latestVersion := int64(len(versions) - 1)
+		missingBefore := len(sl.missingRefs)
+		if !sl.maybeRegisterAvroSchema(desc, latestVersion, versions[latestVersion]) && len(sl.missingRefs) == missingBefore {
+			log.Printf("No new version of %s to register from %s", fullNameOf(desc), sl.schemaFiles[desc][latestVersion])
+		}
+	}
+}
+
+// Parses the changed Protobuf or JSON files again, and registers them along with the files referencing them,
+// directly or not, as their references change
+func (sl *SchemaLoader) loadChangedSchemaFiles(changedFiles map[string]bool) {
+	changedNames := map[string]bool{}
+	for file := range changedFiles {
+		relativePath, err := filepath.Rel(sl.path, file)
+		if err != nil {
+			continue
+		}
+		changedNames[filepath.ToSlash(relativePath)] = true
+	}
+
+	// Files referencing a changed file before the change, as it may be removed or lose its $id
+	toRegister := sl.withReferencingFiles(copyNames(changedNames))
+	for name := range changedNames {
+		delete(sl.loadedFiles, name)
+	}
+	for id, name := range sl.loadedIds {
+		if changedNames[name] {
+			delete(sl.loadedIds, id)
+		}
+	}
+
+	loadFile := sl.loadProtobufFiles
+	if sl.schemasType == JSON {
+		loadFile = sl.loadJsonFiles
+	}
+	for _, file := range sortedNames(changedFiles) {
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			checkDontFail(loadFile(file, info, nil))
+		}
+	}
+
+	for name := range sl.withReferencingFiles(copyNames(changedNames)) {
+		toRegister[name] = true
+	}
+	sl.registerFiles(toRegister)
+}
+
+func copyNames(names map[string]bool) map[string]bool {
+	copied := map[string]bool{}
+	for name := range names {
+		copied[name] = true
+	}
+	return copied
+}
+
+func sortedNames(names map[string]bool) []string {
+	sorted := []string{}
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Adds the schemas referencing any of the given schemas, directly or not, to the given schemas
+func (sl *SchemaLoader) withReferencingSchemas(descriptors map[SchemaDescriptor]bool) map[SchemaDescriptor]bool {
+	for added := true; added; {
+		added = false
+		for desc, versions := range sl.schemaRecords {
+			if descriptors[desc] {
+				continue
+			}
+			latestSchema, err := json.Marshal(versions[int64(len(versions)-1)])
+			check(err)
+			for referenced := range descriptors {
+				// References are given by the full name of the referenced schema
+				if bytes.Contains(latestSchema, []byte(strconv.Quote(fullNameOf(referenced)))) {
+					descriptors[desc] = true
+					added = true
+					break
+				}
+			}
+		}
+	}
+	return descriptors
+}
+
+func fullNameOf(desc SchemaDescriptor) string {
+	return fmt.Sprintf("%s.%s", desc.namespace, desc.name)
+}
+
+func sortedDescriptors(descriptors map[SchemaDescriptor]bool) []SchemaDescriptor {
+	sorted := []SchemaDescriptor{}
+	for desc := range descriptors {
+		sorted = append(sorted, desc)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return fullNameOf(sorted[i]) < fullNameOf(sorted[j]) })
+	return sorted
+}
+
+// Watches the given directory and every directory under it
+func watchDirectories(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+func isDirectory(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
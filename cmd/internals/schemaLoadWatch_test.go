@@ -0,0 +1,249 @@
+package client
+
+//
+// schemaLoadWatch_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var watchedReference = `{"type":"record","namespace":"com.mycorp.watch","name":"reference","fields":[{"name":"this","type":"int"}]}`
+var watchedReferenceEvolved = `{"type":"record","namespace":"com.mycorp.watch","name":"reference","fields":[{"name":"this","type":"int"},{"name":"that","type":["null","int"],"default":null}]}`
+var watchedReferencing = `{"type":"record","namespace":"com.mycorp.watch","name":"referencing","fields":[{"name":"ref","type":"com.mycorp.watch.reference"}]}`
+var watchedBroken = `{"type":"record","namespace":"com.mycorp.watch","name":"broken","fields":[{"name":"ref","type":"com.mycorp.watch.missing"}]}`
+
+func TestMainStackSchemaLoadWatch(t *testing.T) {
+	t.Run("TWatchRegistersChangedFiles", func(t *testing.T) { TWatchRegistersChangedFiles(t) })
+	t.Run("TWatchRegistersChangedProtobufFiles", func(t *testing.T) { TWatchRegistersChangedProtobufFiles(t) })
+	t.Run("TLoadResolvesReferencesOnce", func(t *testing.T) { TLoadResolvesReferencesOnce(t) })
+}
+
+func TWatchRegistersChangedFiles(t *testing.T) {
+	HttpCallTimeout = 60
+	watchDebounce = 50 * time.Millisecond
+	registry := newFakeRegistry()
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	schemaDir := t.TempDir()
+	writeWatchedFile(t, schemaDir, "reference.avsc", watchedReference)
+	writeWatchedFile(t, schemaDir, "referencing.avsc", watchedReferencing)
+
+	loader := NewSchemaLoader(AVRO.String(), NewSchemaRegistryClient(server.URL, "key", "secret", "dst"), schemaDir, "")
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		loader.watchUntil(stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	waitForVersions(t, registry, "com.mycorp.watch.reference-value", 1)
+	waitForVersions(t, registry, "com.mycorp.watch.referencing-value", 1)
+
+	// A file referencing a missing schema is reported without stopping the watch
+	writeWatchedFile(t, schemaDir, "broken.avsc", watchedBroken)
+	writeWatchedFile(t, schemaDir, "reference.avsc", watchedReferenceEvolved)
+
+	waitForVersions(t, registry, "com.mycorp.watch.reference-value", 2)
+	waitForVersions(t, registry, "com.mycorp.watch.referencing-value", 2)
+
+	latestReferencing := registry.latest("com.mycorp.watch.referencing-value")
+	assert.Equal(t, []SchemaReference{{Name: "com.mycorp.watch.reference", Subject: "com.mycorp.watch.reference-value", Version: 2}},
+		latestReferencing.References)
+	assert.Equal(t, 0, registry.versionCount("com.mycorp.watch.broken-value"))
+}
+
+func TWatchRegistersChangedProtobufFiles(t *testing.T) {
+	HttpCallTimeout = 60
+	watchDebounce = 50 * time.Millisecond
+	registry := newFakeRegistry()
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	schemaDir := t.TempDir()
+	writeWatchedFile(t, schemaDir, "address.proto", `syntax = "proto3"; package watch; message Address { string street = 1; }`)
+	writeWatchedFile(t, schemaDir, "customer.proto",
+		`syntax = "proto3"; package watch; import "address.proto"; message Customer { Address address = 1; }`)
+	writeWatchedFile(t, schemaDir, "unrelated.proto", `syntax = "proto3"; package watch; message Unrelated { string name = 1; }`)
+
+	loader := NewSchemaLoader(PROTOBUF.String(), NewSchemaRegistryClient(server.URL, "key", "secret", "dst"), schemaDir, "")
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		loader.watchUntil(stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	waitForVersions(t, registry, "address.proto", 1)
+	waitForVersions(t, registry, "watch.Customer-value", 1)
+	waitForVersions(t, registry, "watch.Unrelated-value", 1)
+	unrelatedRequests := registry.requestCount("watch.Unrelated-value")
+
+	writeWatchedFile(t, schemaDir, "address.proto", `syntax = "proto3"; package watch; message Address { string street = 1; string city = 2; }`)
+
+	// The files referencing the changed file are registered again, files unrelated to it are not
+	waitForVersions(t, registry, "address.proto", 2)
+	waitForVersions(t, registry, "watch.Customer-value", 2)
+	assert.Equal(t, []SchemaReference{{Name: "address.proto", Subject: "address.proto", Version: 2}},
+		registry.latest("watch.Customer-value").References)
+	assert.Equal(t, unrelatedRequests, registry.requestCount("watch.Unrelated-value"))
+}
+
+func TLoadResolvesReferencesOnce(t *testing.T) {
+	HttpCallTimeout = 60
+	registry := newFakeRegistry()
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	// A chain of schemas, each referencing the one before it
+	schemaDir := t.TempDir()
+	depth := 8
+	for i := 0; i < depth; i++ {
+		fields := `[{"name":"value","type":"int"}]`
+		if i > 0 {
+			fields = fmt.Sprintf(`[{"name":"previous","type":"com.mycorp.chain.link%d"}]`, i-1)
+		}
+		writeWatchedFile(t, schemaDir, fmt.Sprintf("link%d.avsc", i),
+			fmt.Sprintf(`{"type":"record","namespace":"com.mycorp.chain","name":"link%d","fields":%s}`, i, fields))
+	}
+
+	NewSchemaLoader(AVRO.String(), NewSchemaRegistryClient(server.URL, "key", "secret", "dst"), schemaDir, "").Run()
+
+	// Every subject is looked up a bounded number of times, however deep it is in the chain
+	for i := 0; i < depth; i++ {
+		subject := fmt.Sprintf("com.mycorp.chain.link%d-value", i)
+		assert.Equal(t, 1, registry.versionCount(subject))
+		assert.LessOrEqual(t, registry.requestCount(subject), 2*depth, subject)
+	}
+}
+
+func writeWatchedFile(t *testing.T, dir string, name string, contents string) {
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+}
+
+func waitForVersions(t *testing.T, registry *fakeRegistry, subject string, versions int) {
+	deadline := time.Now().Add(10 * time.Second)
+	for registry.versionCount(subject) < versions && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.Equal(t, versions, registry.versionCount(subject), subject)
+}
+
+// A minimal Schema Registry answering schema lookups, registrations, and version reads
+type fakeRegistry struct {
+	lock     sync.Mutex
+	subjects map[string][]SchemaToRegister
+	requests map[string]int // Subject -> lookups and registrations received, version reads excluded
+	nextId   int64
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{subjects: map[string][]SchemaToRegister{}, requests: map[string]int{}, nextId: 1}
+}
+
+func (fr *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	if len(parts) < 2 || parts[0] != "subjects" || (r.Method != http.MethodPost && r.Method != http.MethodGet) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	subject, _ := url.PathUnescape(parts[1])
+	if r.Method == http.MethodGet {
+		fr.serveVersions(w, subject, parts[2:])
+		return
+	}
+	fr.requests[subject]++
+	request := SchemaToRegister{}
+	_ = json.NewDecoder(r.Body).Decode(&request)
+	if request.References == nil {
+		request.References = []SchemaReference{}
+	}
+
+	for i, registered := range fr.subjects[subject] {
+		if registered.Schema == request.Schema && reflect.DeepEqual(registered.References, request.References) {
+			_ = json.NewEncoder(w).Encode(SchemaRecord{Subject: subject, Schema: registered.Schema, Version: int64(i + 1), Id: registered.Id})
+			return
+		}
+	}
+	if len(parts) == 2 {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error_code":40403,"message":"Schema not found"}`))
+		return
+	}
+
+	request.Id = fr.nextId
+	fr.nextId++
+	fr.subjects[subject] = append(fr.subjects[subject], request)
+	_ = json.NewEncoder(w).Encode(map[string]int64{"id": request.Id})
+}
+
+// Lists the versions of a subject, or returns one of them
+func (fr *fakeRegistry) serveVersions(w http.ResponseWriter, subject string, path []string) {
+	registered := fr.subjects[subject]
+	if len(registered) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error_code":40401,"message":"Subject not found"}`))
+		return
+	}
+	if len(path) == 1 && path[0] == "versions" {
+		versions := []int64{}
+		for i := range registered {
+			versions = append(versions, int64(i+1))
+		}
+		_ = json.NewEncoder(w).Encode(versions)
+		return
+	}
+	version, err := strconv.Atoi(path[len(path)-1])
+	if len(path) != 2 || err != nil || version < 1 || version > len(registered) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error_code":40402,"message":"Version not found"}`))
+		return
+	}
+	schema := registered[version-1]
+	_ = json.NewEncoder(w).Encode(SchemaRecord{Subject: subject, Schema: schema.Schema, SType: schema.SType, Version: int64(version),
+		Id: schema.Id, References: schema.References})
+}
+
+func (fr *fakeRegistry) requestCount(subject string) int {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+	return fr.requests[subject]
+}
+
+func (fr *fakeRegistry) versionCount(subject string) int {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+	return len(fr.subjects[subject])
+}
+
+func (fr *fakeRegistry) latest(subject string) SchemaToRegister {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+	versions := fr.subjects[subject]
+	return versions[len(versions)-1]
+}
@@ -1,9 +1,7 @@
 package client
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
@@ -12,10 +10,26 @@ import (
 )
 
 type SchemaLoader struct {
-	dstClient     *SchemaRegistryClient
-	schemasType   SchemaType                                            // Define the Loader Type
-	schemaRecords map[SchemaDescriptor]map[int64]map[string]interface{} // Internal map of SchemaDescriptor -> version -> unstructured schema
-	path          string
+	dstClient        *SchemaRegistryClient
+	schemasType      SchemaType                                            // Define the Loader Type
+	schemaRecords    map[SchemaDescriptor]map[int64]map[string]interface{} // Internal map of SchemaDescriptor -> version -> unstructured schema
+	schemaFiles      map[SchemaDescriptor]map[int64]string                 // Internal map of SchemaDescriptor -> version -> file the version was read from
+	schemaCandidates map[SchemaDescriptor][]schemaCandidate                // Files read for every SchemaDescriptor, before their versions are decided
+	avroResolved     map[avroVersion]avroRegistration                      // Schema and references every version is registered with, resolved once per load
+	avroResolving    map[avroVersion]bool                                  // Versions being resolved, a version met again references itself
+	parsedFiles      map[string][]map[string]interface{}                   // Files already parsed, kept while watching to only parse changed files again
+	loadedFiles      map[string]*loadedFile                                // Internal map of relative path -> Protobuf or JSON schema file
+	loadedIds        map[string]string                                     // Internal map of JSON schema $id -> relative path
+	path             string
+	namer            *subjectNamer             // Decides the subjects schemas are registered under
+	versionOrder     VersionOrder              // Decides the version of the files declaring the same schema
+	inlineTypes      map[SchemaDescriptor]bool // Named types defined inline in the files of the load, only registered when referenced
+	avroAliases      map[string]string         // Full alias of an AVRO schema -> full name of the schema
+	avroSchemaForm   AvroSchemaForm            // Form AVRO schemas are registered in
+	compatibility    *compatibilityGate        // Checks new versions against the previous versions of their subject
+	compatChecks     *compatibilityCheckRun    // Set when schemas are only tested against the registry, see RunCompatibilityCheck
+	watching         bool
+	missingRefs      []string // References that could not be resolved while watching
 }
 
 type SchemaDescriptor struct {
@@ -23,6 +37,16 @@ type SchemaDescriptor struct {
 	name      string
 }
 
+type avroVersion struct {
+	desc    SchemaDescriptor
+	version int64
+}
+
+type avroRegistration struct {
+	schema     string
+	references []SchemaReference
+}
+
 // Define SchemaType enum
 type SchemaType int
 
@@ -50,21 +74,49 @@ var nativeTypes = map[string]struct{}{
 	schema
 */
 func NewSchemaLoader(schemaType string, dstClient *SchemaRegistryClient, givenPath string, workingDirectory string) *SchemaLoader {
+	var loader *SchemaLoader
 	if strings.EqualFold(schemaType, AVRO.String()) {
-		return &SchemaLoader{
-			dstClient:     dstClient,
-			schemasType:   AVRO,
-			schemaRecords: map[SchemaDescriptor]map[int64]map[string]interface{}{},
-			path:          CheckPath(givenPath, workingDirectory),
+		loader = &SchemaLoader{
+			dstClient:        dstClient,
+			schemasType:      AVRO,
+			schemaRecords:    map[SchemaDescriptor]map[int64]map[string]interface{}{},
+			schemaFiles:      map[SchemaDescriptor]map[int64]string{},
+			schemaCandidates: map[SchemaDescriptor][]schemaCandidate{},
+			avroResolved:     map[avroVersion]avroRegistration{},
+			avroResolving:    map[avroVersion]bool{},
+			parsedFiles:      map[string][]map[string]interface{}{},
+			path:             CheckPath(givenPath, workingDirectory),
 		}
 	} else if strings.EqualFold(schemaType, PROTOBUF.String()) {
-		log.Fatalln("The Protobuf schema load is not supported yet.")
+		loader = &SchemaLoader{
+			dstClient:   dstClient,
+			schemasType: PROTOBUF,
+			loadedFiles: map[string]*loadedFile{},
+			path:        CheckPath(givenPath, workingDirectory),
+		}
 	} else if strings.EqualFold(schemaType, JSON.String()) {
-		log.Fatalln("The Json schema load is not supported yet.")
+		loader = &SchemaLoader{
+			dstClient:   dstClient,
+			schemasType: JSON,
+			loadedFiles: map[string]*loadedFile{},
+			loadedIds:   map[string]string{},
+			path:        CheckPath(givenPath, workingDirectory),
+		}
+	} else {
+		log.Fatalln("This type of schema load is not supported, and there are no plans for support.")
 	}
 
-	log.Fatalln("This type of schema load is not supported, and there are no plans for support.")
-	return nil
+	namer, err := newSubjectNamer(loader.schemasType)
+	checkFail(err, "Could not set up the subject naming of the schema load")
+	loader.namer = namer
+	loader.versionOrder, err = ParseVersionOrder(SchemaVersionOrder)
+	checkFail(err, "Could not set up the version order of the schema load")
+	loader.avroSchemaForm, err = ParseAvroSchemaForm(AvroSchemaFormName)
+	checkFail(err, "Could not set up the AVRO schema form of the schema load")
+	loader.compatibility, err = newCompatibilityGate(CompatibilityLevelName)
+	checkFail(err, "Could not set up the compatibility checks of the schema load")
+	loader.compatibility.withRegistry(dstClient)
+	return loader
 }
 
 func (sl *SchemaLoader) Run() {
@@ -76,6 +128,9 @@ func (sl *SchemaLoader) Run() {
 			if CancelRun == true {
 				return
 			}
+			if sl.inlineTypes[schemaDesc] {
+				continue
+			}
 			versions := make([]int64, 0)
 			for versionNumber, _ := range schemaVersions {
 				versions = append(versions, versionNumber)
@@ -86,6 +141,10 @@ func (sl *SchemaLoader) Run() {
 			}
 		}
 	}
+
+	if sl.schemasType == PROTOBUF || sl.schemasType == JSON {
+		sl.registerLoadedFiles()
+	}
 }
 
 func (sl *SchemaLoader) loadFromPath() {
@@ -93,6 +152,18 @@ func (sl *SchemaLoader) loadFromPath() {
 	if sl.schemasType == AVRO {
 		err := filepath.Walk(sl.path, sl.loadAvroFiles)
 		check(err)
+		sl.orderAvroVersions()
+		sl.indexAvroNamedTypes()
+	}
+
+	if sl.schemasType == PROTOBUF {
+		err := filepath.Walk(sl.path, sl.loadProtobufFiles)
+		check(err)
+	}
+
+	if sl.schemasType == JSON {
+		err := filepath.Walk(sl.path, sl.loadJsonFiles)
+		check(err)
 	}
 
 	if CancelRun != true {
@@ -103,141 +174,139 @@ func (sl *SchemaLoader) loadFromPath() {
 
 }
 
+// Registers the given version of a schema under the subjects of the subject name strategy, unless already registered
 func (sl *SchemaLoader) maybeRegisterAvroSchema(desc SchemaDescriptor, version int64, fullSchema map[string]interface{}) bool {
+	thisSchemaName := fmt.Sprintf("%s.%s", desc.namespace, desc.name)
+	subjects := sl.namer.subjectsFor(thisSchemaName)
+	if len(subjects) == 0 {
+		log.Printf("Not registering %s from %s, no topic is mapped to it in %s", thisSchemaName, sl.schemaFiles[desc][version], TopicMappingPath)
+		return false
+	}
+	return sl.maybeRegisterAvroSchemaUnder(subjects, desc, version, fullSchema)
+}
+
+// Registers the given version of a schema under the given subjects, unless already registered
+func (sl *SchemaLoader) maybeRegisterAvroSchemaUnder(subjects []string, desc SchemaDescriptor, version int64, fullSchema map[string]interface{}) bool {
 
 	thisSchemaName := fmt.Sprintf("%s.%s", desc.namespace, desc.name)
-	thisSchemaReferences := []SchemaReference{}
+	missingBefore := len(sl.missingRefs)
+	mapAsJsonString, thisSchemaReferences := sl.resolvedAvroSchema(desc, version, fullSchema)
+	if len(sl.missingRefs) > missingBefore {
+		log.Printf("Could not register %s from %s: %s", thisSchemaName,
+			sl.schemaFiles[desc][version], strings.Join(sl.missingRefs[missingBefore:], "; "))
+		return false
+	}
+	if !checkSubjectIsAllowed(thisSchemaName) {
+		return false
+	}
 
-	// Check there are fields to the schema
-	if fullSchema["fields"] != nil {
-		thisSchemaReferences = sl.getReferencesForAvroSchema(thisSchemaName, fullSchema["fields"])
+	registered := false
+	for _, thisSchemaSubject := range subjects {
+		if sl.registerUnder(thisSchemaSubject, mapAsJsonString, thisSchemaReferences, sl.schemaFiles[desc][version],
+			fmt.Sprintf("%s with version: %d", thisSchemaSubject, version)) {
+			registered = true
+		}
 	}
+	return registered
+}
 
-	mapAsJsonBytes, err := json.Marshal(fullSchema)
-	check(err)
-	mapAsJsonString := string(mapAsJsonBytes)
-
-	thisSchemaSubject := thisSchemaName + "-value"
-
-	if checkSubjectIsAllowed(thisSchemaName) && !sl.dstClient.schemaIsRegisteredUnderSubject(thisSchemaSubject,
-		"AVRO", mapAsJsonString, thisSchemaReferences) {
-		log.Println(fmt.Sprintf("Registering schema not previously registered: %s with version: %d", thisSchemaSubject, version))
-		sl.dstClient.RegisterSchema(
-			mapAsJsonString,
-			thisSchemaSubject,
-			"AVRO",
-			thisSchemaReferences)
-		return true
+// Registers the given schema under the given subject unless already registered or incompatible with the previous
+// versions of the subject, returning whether it was registered. When only testing schemas against the registry,
+// the schema is tested instead.
+func (sl *SchemaLoader) registerUnder(subject string, schema string, references []SchemaReference, file string, description string) bool {
+	schemaType := sl.schemasType.String()
+	if sl.compatChecks != nil {
+		sl.compatChecks.test(sl.dstClient, subject, schemaType, schema, references, file)
+		return false
+	}
+	if sl.dstClient.schemaIsRegisteredUnderSubject(subject, schemaType, schema, references) {
+		sl.compatibility.accept(subject, 0, schemaType, schema)
+		return false
 	}
-	return false
+	if !sl.compatibility.allows(subject, 0, schemaType, schema) {
+		return false
+	}
+	log.Printf("Registering schema not previously registered: %s", description)
+	sl.dstClient.RegisterSchema(schema, subject, schemaType, references)
+	return true
+}
+
+// Returns the schema and references to register the given version of a schema with, registering the schemas
+// it references first. Versions are only resolved once, as resolving registers the whole tree of their references.
+func (sl *SchemaLoader) resolvedAvroSchema(desc SchemaDescriptor, version int64, fullSchema map[string]interface{}) (string, []SchemaReference) {
+	key := avroVersion{desc: desc, version: version}
+	if resolved, done := sl.avroResolved[key]; done {
+		return resolved.schema, resolved.references
+	}
+	if sl.avroResolving[key] {
+		sl.unresolvedReference(fmt.Sprintf("%s is part of a reference cycle", fullNameOf(desc)))
+		return "", []SchemaReference{}
+	}
+	sl.avroResolving[key] = true
+	defer delete(sl.avroResolving, key)
+	missingBefore := len(sl.missingRefs)
+	schema, references := sl.avroSchemaToRegister(desc, fullSchema)
+	// Versions with missing references are resolved again, as the files they miss may be written while watching
+	if len(sl.missingRefs) == missingBefore {
+		sl.avroResolved[key] = avroRegistration{schema: schema, references: references}
+	}
+	return schema, references
+}
+
+// Returns the schema and references to register the given schema with,
+// registering the schemas it references first
+func (sl *SchemaLoader) avroSchemaToRegister(desc SchemaDescriptor, fullSchema map[string]interface{}) (string, []SchemaReference) {
+	thisSchemaReferences := []SchemaReference{}
+
+	walker := newAvroWalker(fullSchema, sl.avroAliases)
+	resolvedSchema := walker.resolve(fullSchema, "")
+	for _, referenceName := range walker.references {
+		sl.resolveReferenceAndRegister(referenceName, &thisSchemaReferences)
+	}
+
+	return avroSchemaInForm(resolvedSchema, sl.avroSchemaForm), thisSchemaReferences
 }
 
 func (sl *SchemaLoader) loadAvroFiles(path string, info os.FileInfo, err error) error {
 	check(err)
 
-	if !info.IsDir() {
-		currentSchema, err := os.Open(path)
-		checkDontFail(err)
-		defer currentSchema.Close()
-
-		jsonBytes, _ := ioutil.ReadAll(currentSchema)
+	if info.IsDir() || strings.HasSuffix(path, sidecarExtension) {
+		return nil
+	}
+	if !isAvroSchemaFile(path) {
+		log.Printf("Skipping %s, AVRO schema loads only read %s files", path, strings.Join(avroFileExtensions, ", "))
+		return nil
+	}
 
-		var schemaStruct map[string]interface{}
-		json.Unmarshal(jsonBytes, &schemaStruct)
+	schemas, parsed := sl.parsedFiles[path]
+	if !parsed {
+		schemas, err = readAvroSchemaFile(path)
+		if err != nil {
+			log.Printf("Could not parse schema file %s: %v", path, err)
+			return nil
+		}
+		if sl.watching {
+			sl.parsedFiles[path] = schemas
+		}
+	}
 
+	for _, schemaStruct := range schemas {
 		thisSchemaDescription := SchemaDescriptor{
 			namespace: fmt.Sprintf("%v", schemaStruct["namespace"]),
 			name:      fmt.Sprintf("%v", schemaStruct["name"]),
 		}
-
-		thisSchemaVersion := int64(len(sl.schemaRecords[thisSchemaDescription]))
-
-		if thisSchemaVersion == 0 {
-			sl.schemaRecords[thisSchemaDescription] = map[int64]map[string]interface{}{
-				thisSchemaVersion: schemaStruct,
-			}
-		} else {
-			newVersion := sl.schemaRecords[thisSchemaDescription]
-			newVersion[thisSchemaVersion] = schemaStruct
-			sl.schemaRecords[thisSchemaDescription] = newVersion
+		// A name holding a dot is a full name, its namespace attribute is ignored
+		if name, isString := schemaStruct["name"].(string); isString && strings.Contains(name, ".") {
+			thisSchemaDescription = GetAvroSchemaDescriptor(name)
 		}
 
+		// Versions are decided once every file is read, see orderAvroVersions
+		sl.schemaCandidates[thisSchemaDescription] = append(sl.schemaCandidates[thisSchemaDescription],
+			schemaCandidate{path: path, schema: schemaStruct, modTime: info.ModTime()})
 	}
 	return nil
 }
 
-func (sl *SchemaLoader) getReferencesForAvroSchema(thisSchemaName string, fields interface{}) []SchemaReference {
-	references := []SchemaReference{}
-
-	switch theseFields := fields.(type) {
-	case []interface{}:
-		for _, oneField := range theseFields {
-			switch typecastedField := oneField.(type) {
-			case map[string]interface{}:
-				switch typeOfTypeField := typecastedField["type"].(type) {
-				case string:
-					sl.resolveReferenceAndRegister(typeOfTypeField, &references)
-				case []interface{}:
-					for _, singleTypeInArray := range typeOfTypeField {
-						switch thisFieldType := singleTypeInArray.(type) {
-						case string:
-							sl.resolveReferenceAndRegister(thisFieldType, &references)
-						default:
-							log.Println("Could not cast a type to string: " + fmt.Sprintf("%v", thisFieldType))
-						}
-					}
-				case map[string]interface{}:
-					values, valuesExist := typeOfTypeField["values"]
-					items, itemsExist := typeOfTypeField["items"]
-					if valuesExist && !itemsExist {
-						switch valuesFields := values.(type) {
-						case string:
-							sl.resolveReferenceAndRegister(valuesFields, &references)
-						case []interface{}:
-							for _, singleTypeInArray := range valuesFields {
-								switch thisFieldType := singleTypeInArray.(type) {
-								case string:
-									sl.resolveReferenceAndRegister(thisFieldType, &references)
-								default:
-									log.Println("Could not cast a type to string: " + fmt.Sprintf("%v", thisFieldType))
-								}
-							}
-						default:
-							log.Println("Could not parse avro array: " + fmt.Sprintf("%v", valuesFields))
-						}
-					}
-					if itemsExist && !valuesExist {
-						switch itemsTypes := items.(type) {
-						case string:
-							sl.resolveReferenceAndRegister(itemsTypes, &references)
-						case []interface{}:
-							for _, singleTypeInArray := range itemsTypes {
-								switch thisFieldType := singleTypeInArray.(type) {
-								case string:
-									sl.resolveReferenceAndRegister(thisFieldType, &references)
-								default:
-									log.Println("Could not cast a type to string: " + fmt.Sprintf("%v", thisFieldType))
-								}
-							}
-						default:
-							log.Println("Could not parse avro map: " + fmt.Sprintf("%v", itemsTypes))
-						}
-					}
-				default:
-					log.Println("Could not get types from schema")
-					log.Println(fmt.Sprintf("%v", typeOfTypeField))
-				}
-			default:
-				log.Println("Could not typecast input")
-			}
-		}
-	default:
-		log.Println("Could not define the field array in this schema")
-		log.Println(fmt.Sprintf("%v", theseFields))
-	}
-	return references
-}
-
 func (sl *SchemaLoader) resolveReferenceAndRegister(referenceName string, references *[]SchemaReference) {
 	// If this is a reference, then fill array and register that first
 	//Build SchemaDescriptor for the reference
@@ -248,15 +317,21 @@ func (sl *SchemaLoader) resolveReferenceAndRegister(referenceName string, refere
 
 		versions, refExists := sl.schemaRecords[thisReferenceDescriptor]
 		if !refExists {
-			log.Fatalln("Reference doesn't exist: " + fmt.Sprintf("%v", thisReferenceDescriptor))
+			sl.unresolvedReference(fmt.Sprintf("reference %s does not exist in %s", schemaFullName, sl.path))
+			return
+		}
+		referenceSubject, err := sl.namer.referenceSubjectFor(schemaFullName, schemaFullName)
+		if err != nil {
+			sl.unresolvedReference(err.Error())
+			return
 		}
-		latestVersionForReference := int64(len(versions))
 
-		sl.registerReferenceSet(versions, thisReferenceDescriptor)
+		sl.registerReferenceSet(referenceSubject, versions, thisReferenceDescriptor)
+		latestVersionForReference := sl.registeredVersionOf(referenceSubject, thisReferenceDescriptor, int64(len(versions)-1))
 
 		thisReference := SchemaReference{
 			Name:    schemaFullName,            // The type referenced
-			Subject: schemaFullName + "-value", // The SchemaDescriptor
+			Subject: referenceSubject,          // The subject of the reference strategy
 			Version: latestVersionForReference, // Latest version of schema descriptor
 		}
 
@@ -266,7 +341,16 @@ func (sl *SchemaLoader) resolveReferenceAndRegister(referenceName string, refere
 	}
 }
 
-func (sl *SchemaLoader) registerReferenceSet(versionsMap map[int64]map[string]interface{}, descriptor SchemaDescriptor) {
+// Records a reference that can not be resolved, which stops the load unless watching
+func (sl *SchemaLoader) unresolvedReference(description string) {
+	if !sl.watching {
+		log.Fatalln("Could not resolve schema reference: " + description)
+	}
+	// A file being edited should not stop the watch
+	sl.missingRefs = append(sl.missingRefs, description)
+}
+
+func (sl *SchemaLoader) registerReferenceSet(subject string, versionsMap map[int64]map[string]interface{}, descriptor SchemaDescriptor) {
 	versionsSlice := make([]int64, 0)
 	for versionNumber, _ := range versionsMap {
 		versionsSlice = append(versionsSlice, versionNumber)
@@ -274,9 +358,20 @@ func (sl *SchemaLoader) registerReferenceSet(versionsMap map[int64]map[string]in
 	sort.Slice(versionsSlice, func(i, j int) bool { return versionsSlice[i] < versionsSlice[j] })
 
 	for _, sortedVersion := range versionsSlice {
-		if sl.maybeRegisterAvroSchema(descriptor, sortedVersion, sl.schemaRecords[descriptor][sortedVersion]) {
+		if sl.maybeRegisterAvroSchemaUnder([]string{subject}, descriptor, sortedVersion, sl.schemaRecords[descriptor][sortedVersion]) {
 			log.Println(fmt.Sprintf("Registered schema reference not previously registered: %s.%s with version: %d",
 				descriptor.namespace, descriptor.name, sortedVersion))
 		}
 	}
 }
+
+// Returns the version the destination registered the given version of a schema as. Versions are assumed
+// to be registered in order when the destination can not tell, as edited files register new versions
+// while watching.
+func (sl *SchemaLoader) registeredVersionOf(subject string, desc SchemaDescriptor, version int64) int64 {
+	schema, references := sl.resolvedAvroSchema(desc, version, sl.schemaRecords[desc][version])
+	if registeredVersion, registered := sl.dstClient.lookupSchemaVersion(subject, sl.schemasType.String(), schema, references); registered {
+		return registeredVersion
+	}
+	return version + 1
+}
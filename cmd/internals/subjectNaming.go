@@ -0,0 +1,160 @@
+package client
+
+//
+// subjectNaming.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+/*
+Schema loads register schemas under the subjects serializers look them up with, following one of the
+subject name strategies of Confluent serializers:
+	RECORD_NAME        <record name>-value
+	TOPIC_NAME         <topic>-value, for every topic the record is mapped to in -topicMapping
+	TOPIC_RECORD_NAME  <topic>-<record name>-value, for every topic the record is mapped to in -topicMapping
+The suffix is -key instead with -keySchemas. Referenced schemas follow their own strategy, which may also be
+	REFERENCE_NAME     the name of the reference: the full name of an Avro record, the import path of a .proto file
+	                   or the path of a JSON Schema file
+The record name of a Protobuf file is the full name of its first message, the one of a JSON Schema its title.
+*/
+
+// Define SubjectNameStrategy enum
+type SubjectNameStrategy int
+
+const (
+	RECORD_NAME SubjectNameStrategy = iota
+	TOPIC_NAME
+	TOPIC_RECORD_NAME
+	REFERENCE_NAME
+)
+
+func (sns SubjectNameStrategy) String() string {
+	return [...]string{"RECORD_NAME", "TOPIC_NAME", "TOPIC_RECORD_NAME", "REFERENCE_NAME"}[sns]
+}
+
+// Parses a strategy name, also accepting the class names of Confluent serializers such as RecordNameStrategy
+func ParseSubjectNameStrategy(name string) (SubjectNameStrategy, error) {
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSuffix(name, "Strategy"), "_", ""))
+	for _, strategy := range []SubjectNameStrategy{RECORD_NAME, TOPIC_NAME, TOPIC_RECORD_NAME, REFERENCE_NAME} {
+		if normalized == strings.ReplaceAll(strategy.String(), "_", "") {
+			return strategy, nil
+		}
+	}
+	return RECORD_NAME, fmt.Errorf("unknown subject name strategy %s, expected one of RECORD_NAME, TOPIC_NAME, TOPIC_RECORD_NAME or REFERENCE_NAME", name)
+}
+
+// Decides the subjects schemas of a load are registered under
+type subjectNamer struct {
+	strategy          SubjectNameStrategy
+	referenceStrategy SubjectNameStrategy
+	suffix            string
+	topics            map[string][]string // Record name -> topics it is produced to
+}
+
+// Returns the subject namer configured by -subjectNameStrategy, -referenceSubjectNameStrategy, -keySchemas and -topicMapping.
+// References of Avro schemas default to RECORD_NAME, references of other types to REFERENCE_NAME.
+func newSubjectNamer(schemaType SchemaType) (*subjectNamer, error) {
+	namer := subjectNamer{suffix: "-value", topics: map[string][]string{}, referenceStrategy: REFERENCE_NAME}
+	if KeySchemas {
+		namer.suffix = "-key"
+	}
+	if schemaType == AVRO {
+		namer.referenceStrategy = RECORD_NAME
+	}
+
+	var err error
+	if SubjectNameStrategyName != "" {
+		if namer.strategy, err = ParseSubjectNameStrategy(SubjectNameStrategyName); err != nil {
+			return nil, err
+		}
+		if namer.strategy == REFERENCE_NAME {
+			return nil, fmt.Errorf("REFERENCE_NAME only applies to referenced schemas, see -referenceSubjectNameStrategy")
+		}
+	}
+	if ReferenceSubjectStrategyName != "" {
+		if namer.referenceStrategy, err = ParseSubjectNameStrategy(ReferenceSubjectStrategyName); err != nil {
+			return nil, err
+		}
+	}
+
+	usesTopics := namer.strategy == TOPIC_NAME || namer.strategy == TOPIC_RECORD_NAME ||
+		namer.referenceStrategy == TOPIC_NAME || namer.referenceStrategy == TOPIC_RECORD_NAME
+	if usesTopics && TopicMappingPath == "" {
+		return nil, fmt.Errorf("the TOPIC_NAME and TOPIC_RECORD_NAME strategies need a -topicMapping file")
+	}
+	if TopicMappingPath != "" {
+		if namer.topics, err = readTopicMapping(TopicMappingPath); err != nil {
+			return nil, err
+		}
+	}
+	return &namer, nil
+}
+
+// Returns the subjects the schema with the given record name is registered under.
+// Topic based strategies return no subject for records not mapped to any topic.
+func (sn *subjectNamer) subjectsFor(recordName string) []string {
+	return sn.subjectsWith(sn.strategy, recordName, recordName)
+}
+
+// Returns the subject the schema with the given record name is registered under when referenced with the given name
+func (sn *subjectNamer) referenceSubjectFor(recordName string, referenceName string) (string, error) {
+	if recordName == "" {
+		recordName = referenceName
+	}
+	subjects := sn.subjectsWith(sn.referenceStrategy, recordName, referenceName)
+	if len(subjects) == 0 {
+		return "", fmt.Errorf("no topic is mapped to the referenced schema %s in %s", recordName, TopicMappingPath)
+	}
+	// A referenced schema is registered under a single subject, the one of the first topic it is mapped to
+	return subjects[0], nil
+}
+
+func (sn *subjectNamer) subjectsWith(strategy SubjectNameStrategy, recordName string, referenceName string) []string {
+	switch strategy {
+	case TOPIC_NAME, TOPIC_RECORD_NAME:
+		subjects := []string{}
+		for _, topic := range sn.topics[recordName] {
+			if strategy == TOPIC_NAME {
+				subjects = append(subjects, topic+sn.suffix)
+			} else {
+				subjects = append(subjects, fmt.Sprintf("%s-%s%s", topic, recordName, sn.suffix))
+			}
+		}
+		return subjects
+	case REFERENCE_NAME:
+		return []string{referenceName}
+	}
+	return []string{recordName + sn.suffix}
+}
+
+// Reads a topic mapping file, holding one topic=record name line per topic.
+// Blank lines and lines starting with # are ignored.
+func readTopicMapping(mappingPath string) (map[string][]string, error) {
+	mappingFile, err := os.Open(mappingPath)
+	if err != nil {
+		return nil, err
+	}
+	defer mappingFile.Close()
+
+	topics := map[string][]string{}
+	scanner := bufio.NewScanner(mappingFile)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		mapping := strings.SplitN(line, "=", 2)
+		if len(mapping) != 2 || strings.TrimSpace(mapping[0]) == "" || strings.TrimSpace(mapping[1]) == "" {
+			return nil, fmt.Errorf("%s:%d: expected a topic=record name mapping", mappingPath, lineNumber)
+		}
+		topic, recordName := strings.TrimSpace(mapping[0]), strings.TrimSpace(mapping[1])
+		topics[recordName] = append(topics[recordName], topic)
+	}
+	return topics, scanner.Err()
+}
@@ -0,0 +1,152 @@
+package client
+
+//
+// subjectNaming_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackSubjectNaming(t *testing.T) {
+	t.Run("TParseSubjectNameStrategy", func(t *testing.T) { TParseSubjectNameStrategy(t) })
+	t.Run("TSubjectNamerStrategies", func(t *testing.T) { TSubjectNamerStrategies(t) })
+	t.Run("TReadTopicMapping", func(t *testing.T) { TReadTopicMapping(t) })
+	t.Run("TSchemaLoadWithTopicNames", func(t *testing.T) { TSchemaLoadWithTopicNames(t) })
+	t.Run("TProtobufLoadWithRecordNames", func(t *testing.T) { TProtobufLoadWithRecordNames(t) })
+}
+
+func resetSubjectNaming() {
+	SubjectNameStrategyName = ""
+	ReferenceSubjectStrategyName = ""
+	TopicMappingPath = ""
+	KeySchemas = false
+}
+
+func TParseSubjectNameStrategy(t *testing.T) {
+	strategy, err := ParseSubjectNameStrategy("TOPIC_RECORD_NAME")
+	assert.Nil(t, err)
+	assert.Equal(t, TOPIC_RECORD_NAME, strategy)
+
+	strategy, err = ParseSubjectNameStrategy("RecordNameStrategy")
+	assert.Nil(t, err)
+	assert.Equal(t, RECORD_NAME, strategy)
+
+	strategy, err = ParseSubjectNameStrategy("topic_name")
+	assert.Nil(t, err)
+	assert.Equal(t, TOPIC_NAME, strategy)
+
+	_, err = ParseSubjectNameStrategy("SUBJECT_NAME")
+	assert.NotNil(t, err)
+}
+
+func TSubjectNamerStrategies(t *testing.T) {
+	defer resetSubjectNaming()
+	mappingPath := filepath.Join(t.TempDir(), "topics")
+	writeWatchedFile(t, filepath.Dir(mappingPath), "topics", "orders=com.acme.Order\norders-replay=com.acme.Order\n")
+
+	namer, err := newSubjectNamer(AVRO)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"com.acme.Order-value"}, namer.subjectsFor("com.acme.Order"))
+	referenceSubject, err := namer.referenceSubjectFor("com.acme.Money", "com.acme.Money")
+	assert.Nil(t, err)
+	assert.Equal(t, "com.acme.Money-value", referenceSubject)
+
+	// References of other types default to the name of the reference
+	namer, err = newSubjectNamer(PROTOBUF)
+	assert.Nil(t, err)
+	referenceSubject, err = namer.referenceSubjectFor("com.acme.Money", "common/money.proto")
+	assert.Nil(t, err)
+	assert.Equal(t, "common/money.proto", referenceSubject)
+
+	SubjectNameStrategyName = "TOPIC_NAME"
+	_, err = newSubjectNamer(AVRO)
+	assert.NotNil(t, err)
+
+	TopicMappingPath = mappingPath
+	KeySchemas = true
+	namer, err = newSubjectNamer(AVRO)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"orders-key", "orders-replay-key"}, namer.subjectsFor("com.acme.Order"))
+	assert.Equal(t, []string{}, namer.subjectsFor("com.acme.Money"))
+
+	SubjectNameStrategyName = "TOPIC_RECORD_NAME"
+	ReferenceSubjectStrategyName = "TOPIC_NAME"
+	namer, err = newSubjectNamer(AVRO)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"orders-com.acme.Order-key", "orders-replay-com.acme.Order-key"}, namer.subjectsFor("com.acme.Order"))
+	_, err = namer.referenceSubjectFor("com.acme.Money", "com.acme.Money")
+	assert.NotNil(t, err)
+
+	SubjectNameStrategyName = "REFERENCE_NAME"
+	_, err = newSubjectNamer(AVRO)
+	assert.NotNil(t, err)
+}
+
+func TReadTopicMapping(t *testing.T) {
+	mappingDir := t.TempDir()
+	writeWatchedFile(t, mappingDir, "topics", "# Orders\n\n orders = com.acme.Order \npayments=com.acme.Payment\n")
+	topics, err := readTopicMapping(filepath.Join(mappingDir, "topics"))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{"com.acme.Order": {"orders"}, "com.acme.Payment": {"payments"}}, topics)
+
+	writeWatchedFile(t, mappingDir, "broken", "orders\n")
+	_, err = readTopicMapping(filepath.Join(mappingDir, "broken"))
+	assert.EqualError(t, err, filepath.Join(mappingDir, "broken")+":1: expected a topic=record name mapping")
+}
+
+func TSchemaLoadWithTopicNames(t *testing.T) {
+	defer resetSubjectNaming()
+	HttpCallTimeout = 60
+	registry := newFakeRegistry()
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	schemaDir := t.TempDir()
+	writeWatchedFile(t, schemaDir, "reference.avsc", watchedReference)
+	writeWatchedFile(t, schemaDir, "referencing.avsc", watchedReferencing)
+	mappingDir := t.TempDir()
+	writeWatchedFile(t, mappingDir, "topics", "orders=com.mycorp.watch.referencing\n")
+
+	SubjectNameStrategyName = "TOPIC_NAME"
+	ReferenceSubjectStrategyName = "REFERENCE_NAME"
+	TopicMappingPath = filepath.Join(mappingDir, "topics")
+	KeySchemas = true
+
+	loader := NewSchemaLoader(AVRO.String(), NewSchemaRegistryClient(server.URL, "key", "secret", "dst"), schemaDir, "")
+	loader.Run()
+
+	assert.Equal(t, 1, registry.versionCount("com.mycorp.watch.reference"))
+	assert.Equal(t, 0, registry.versionCount("com.mycorp.watch.reference-key"))
+	assert.Equal(t, []SchemaReference{{Name: "com.mycorp.watch.reference", Subject: "com.mycorp.watch.reference", Version: 1}},
+		registry.latest("orders-key").References)
+}
+
+func TProtobufLoadWithRecordNames(t *testing.T) {
+	defer resetSubjectNaming()
+	HttpCallTimeout = 60
+	registry := newFakeRegistry()
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	schemaDir := t.TempDir()
+	writeWatchedFile(t, schemaDir, "address.proto", `syntax = "proto3"; package naming; message Address { string street = 1; }`)
+	writeWatchedFile(t, schemaDir, "customer.proto",
+		`syntax = "proto3"; package naming; import "address.proto"; message Customer { Address address = 1; }`)
+
+	ReferenceSubjectStrategyName = "RECORD_NAME"
+
+	loader := NewSchemaLoader(PROTOBUF.String(), NewSchemaRegistryClient(server.URL, "key", "secret", "dst"), schemaDir, "")
+	loader.Run()
+
+	// The reference points at the subject the referenced file was registered under
+	assert.Equal(t, 0, registry.versionCount("address.proto"))
+	assert.Equal(t, 1, registry.versionCount("naming.Address-value"))
+	assert.Equal(t, []SchemaReference{{Name: "address.proto", Subject: "naming.Address-value", Version: 1}},
+		registry.latest("naming.Customer-value").References)
+}
@@ -0,0 +1,304 @@
+package client
+
+//
+// verify.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+)
+
+// A single difference found between the source and the destination
+type VerificationMismatch struct {
+	Subject     string `json:"subject"`
+	Version     int64  `json:"version,omitempty"`
+	Field       string `json:"field"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// The result of verifying one subject
+type SubjectVerification struct {
+	Subject    string                 `json:"subject"`
+	Mismatches []VerificationMismatch `json:"mismatches"`
+}
+
+// The result of verifying a destination against a source
+type VerificationReport struct {
+	SourceUrl      string                `json:"sourceUrl"`
+	DestinationUrl string                `json:"destinationUrl"`
+	Subjects       []SubjectVerification `json:"subjects"`
+}
+
+// Returns whether any subject of the report has a mismatch
+func (vr VerificationReport) HasMismatches() bool {
+	for _, subject := range vr.Subjects {
+		if len(subject.Mismatches) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// One side of a verification
+type verificationSide struct {
+	active           map[string][]int64
+	all              map[string][]int64
+	getSchema        func(subject string, version int64, deleted bool) SchemaRecord
+	getCompatibility func(subject string) string
+	getMode          func(subject string) string
+}
+
+func newRegistryVerificationSide(srClient *SchemaRegistryClient) *verificationSide {
+	allChan := make(chan map[string][]int64)
+	go srClient.GetSubjectsWithVersions(allChan, true)
+	all := <-allChan
+
+	return &verificationSide{
+		active:           GetCurrentSubjectState(srClient),
+		all:              all,
+		getSchema:        srClient.GetSchema,
+		getCompatibility: srClient.GetSubjectCompatibility,
+		getMode:          srClient.GetSubjectMode,
+	}
+}
+
+// Compares the source and destination registries subject by subject.
+// When withConfig is set, per-subject compatibility and mode are compared as well.
+func RunVerification(srcClient *SchemaRegistryClient, destClient *SchemaRegistryClient, withConfig bool) VerificationReport {
+	listenForInterruption()
+
+	log.Printf("Verifying %s against %s", destClient.SRUrl, srcClient.SRUrl)
+	report := VerificationReport{
+		SourceUrl:      srcClient.SRUrl,
+		DestinationUrl: destClient.SRUrl,
+		Subjects:       verifySubjects(newRegistryVerificationSide(srcClient), newRegistryVerificationSide(destClient), withConfig),
+	}
+	return report
+}
+
+func verifySubjects(src *verificationSide, dst *verificationSide, withConfig bool) []SubjectVerification {
+	allSubjects := map[string]bool{}
+	for subject := range src.all {
+		allSubjects[subject] = true
+	}
+	for subject := range dst.all {
+		allSubjects[subject] = true
+	}
+
+	sorted := make([]string, 0, len(allSubjects))
+	for subject := range allSubjects {
+		sorted = append(sorted, subject)
+	}
+	sort.Strings(sorted)
+
+	results := []SubjectVerification{}
+	for _, subject := range sorted {
+		if CancelRun == true {
+			break
+		}
+		results = append(results, verifySubject(subject, src, dst, withConfig))
+	}
+	return results
+}
+
+func verifySubject(subject string, src *verificationSide, dst *verificationSide, withConfig bool) SubjectVerification {
+	result := SubjectVerification{Subject: subject, Mismatches: []VerificationMismatch{}}
+	addMismatch := func(version int64, field string, source string, destination string) {
+		result.Mismatches = append(result.Mismatches, VerificationMismatch{
+			Subject: subject, Version: version, Field: field, Source: source, Destination: destination,
+		})
+	}
+
+	srcVersions, dstVersions := src.all[subject], dst.all[subject]
+	if srcVersions == nil || dstVersions == nil {
+		addMismatch(0, "subject", presence(srcVersions != nil), presence(dstVersions != nil))
+		return result
+	}
+
+	if !sameVersions(srcVersions, dstVersions) {
+		addMismatch(0, "versions", formatVersions(srcVersions), formatVersions(dstVersions))
+	}
+
+	for _, version := range srcVersions {
+		if !isInSlice(version, dstVersions) {
+			continue
+		}
+		srcDeleted := !isInSlice(version, src.active[subject])
+		dstDeleted := !isInSlice(version, dst.active[subject])
+		if srcDeleted != dstDeleted {
+			addMismatch(version, "softDeleted", fmt.Sprintf("%v", srcDeleted), fmt.Sprintf("%v", dstDeleted))
+		}
+
+		srcSchema := src.getSchema(subject, version, srcDeleted)
+		dstSchema := dst.getSchema(subject, version, dstDeleted)
+
+		if srcSchema.Id != dstSchema.Id {
+			addMismatch(version, "id", fmt.Sprintf("%d", srcSchema.Id), fmt.Sprintf("%d", dstSchema.Id))
+		}
+		if srcSchema.SType != dstSchema.SType {
+			addMismatch(version, "schemaType", srcSchema.SType, dstSchema.SType)
+		}
+		if canonicalSchema(srcSchema.SType, srcSchema.Schema) != canonicalSchema(dstSchema.SType, dstSchema.Schema) {
+			addMismatch(version, "schema", srcSchema.Schema, dstSchema.Schema)
+		}
+		if formatReferences(srcSchema.References) != formatReferences(dstSchema.References) {
+			addMismatch(version, "references", formatReferences(srcSchema.References), formatReferences(dstSchema.References))
+		}
+	}
+
+	if withConfig {
+		srcCompat, dstCompat := src.getCompatibility(subject), dst.getCompatibility(subject)
+		if srcCompat != dstCompat {
+			addMismatch(0, "compatibility", srcCompat, dstCompat)
+		}
+		srcMode, dstMode := src.getMode(subject), dst.getMode(subject)
+		if srcMode != dstMode {
+			addMismatch(0, "mode", srcMode, dstMode)
+		}
+	}
+
+	return result
+}
+
+// Returns a form of the schema that does not depend on formatting.
+// JSON based schemas are re-serialized with sorted keys, others have their whitespace collapsed.
+func canonicalSchema(stype string, schema string) string {
+	if stype == "" || stype == AVRO.String() || stype == JSON.String() {
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(schema), &parsed); err == nil {
+			canonical, err := json.Marshal(parsed)
+			if err == nil {
+				return string(canonical)
+			}
+		}
+	}
+	return strings.Join(strings.Fields(schema), " ")
+}
+
+func formatReferences(references []SchemaReference) string {
+	formatted := []string{}
+	for _, reference := range references {
+		formatted = append(formatted, fmt.Sprintf("%s=%s/%d", reference.Name, reference.Subject, reference.Version))
+	}
+	sort.Strings(formatted)
+	return strings.Join(formatted, ",")
+}
+
+func formatVersions(versions []int64) string {
+	sorted := append([]int64{}, versions...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	formatted := []string{}
+	for _, version := range sorted {
+		formatted = append(formatted, fmt.Sprintf("%d", version))
+	}
+	return strings.Join(formatted, ",")
+}
+
+func sameVersions(left []int64, right []int64) bool {
+	return len(GetVersionsDiff(left, right)) == 0 && len(GetVersionsDiff(right, left)) == 0
+}
+
+func presence(present bool) string {
+	if present {
+		return "present"
+	}
+	return "missing"
+}
+
+// Writes the verification report in the given format: TEXT, JSON or JUNIT
+func WriteVerificationReport(report VerificationReport, format string, out io.Writer) error {
+	switch strings.ToUpper(format) {
+	case "", "TEXT":
+		return writeVerificationText(report, out)
+	case "JSON":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case "JUNIT":
+		return writeVerificationJUnit(report, out)
+	}
+	return fmt.Errorf("unknown report format %s, expected one of TEXT, JSON or JUNIT", format)
+}
+
+func writeVerificationText(report VerificationReport, out io.Writer) error {
+	mismatched := 0
+	for _, subject := range report.Subjects {
+		if len(subject.Mismatches) == 0 {
+			continue
+		}
+		mismatched++
+		if _, err := fmt.Fprintf(out, "MISMATCH %s\n", subject.Subject); err != nil {
+			return err
+		}
+		for _, mismatch := range subject.Mismatches {
+			location := mismatch.Field
+			if mismatch.Version != 0 {
+				location = fmt.Sprintf("version %d %s", mismatch.Version, mismatch.Field)
+			}
+			if _, err := fmt.Fprintf(out, "  %s: source=%q destination=%q\n", location, mismatch.Source, mismatch.Destination); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintf(out, "Verified %d subjects of %s against %s: %d mismatched\n",
+		len(report.Subjects), report.DestinationUrl, report.SourceUrl, mismatched)
+	return err
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func writeVerificationJUnit(report VerificationReport, out io.Writer) error {
+	suite := junitTestSuite{Name: "schema-registry-verification", Tests: len(report.Subjects)}
+	for _, subject := range report.Subjects {
+		testCase := junitTestCase{Name: subject.Subject, ClassName: report.DestinationUrl}
+		if len(subject.Mismatches) != 0 {
+			suite.Failures++
+			details := []string{}
+			for _, mismatch := range subject.Mismatches {
+				details = append(details, fmt.Sprintf("version %d %s: source=%q destination=%q",
+					mismatch.Version, mismatch.Field, mismatch.Source, mismatch.Destination))
+			}
+			testCase.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d mismatches", len(subject.Mismatches)),
+				Text:    strings.Join(details, "\n"),
+			}
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(out)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
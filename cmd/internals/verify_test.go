@@ -0,0 +1,107 @@
+package client
+
+//
+// verify_test.go
+// Copyright 2020 Abraham Leal
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainStackVerify(t *testing.T) {
+	t.Run("TCanonicalSchema", func(t *testing.T) { TCanonicalSchema(t) })
+	t.Run("TVerifySubjects", func(t *testing.T) { TVerifySubjects(t) })
+	t.Run("TWriteVerificationReport", func(t *testing.T) { TWriteVerificationReport(t) })
+}
+
+func inMemVerificationSide(records []SchemaRecord, softDeleted map[string][]int64, compat map[string]string) *verificationSide {
+	side := &verificationSide{active: map[string][]int64{}, all: map[string][]int64{}}
+	for _, record := range records {
+		side.all[record.Subject] = append(side.all[record.Subject], record.Version)
+		if !isInSlice(record.Version, softDeleted[record.Subject]) {
+			side.active[record.Subject] = append(side.active[record.Subject], record.Version)
+		}
+	}
+	side.getSchema = func(subject string, version int64, deleted bool) SchemaRecord {
+		for _, record := range records {
+			if record.Subject == subject && record.Version == version {
+				return record
+			}
+		}
+		return SchemaRecord{}
+	}
+	side.getCompatibility = func(subject string) string { return compat[subject] }
+	side.getMode = func(subject string) string { return "" }
+	return side
+}
+
+func TCanonicalSchema(t *testing.T) {
+	var pretty bytes.Buffer
+	err := json.Indent(&pretty, []byte(mockSchema), "", "    ")
+	assert.Nil(t, err)
+
+	assert.Equal(t, canonicalSchema("AVRO", mockSchema), canonicalSchema("AVRO", pretty.String()))
+	assert.Equal(t, "syntax = \"proto3\";", canonicalSchema("PROTOBUF", "syntax =   \"proto3\";\n"))
+}
+
+func TVerifySubjects(t *testing.T) {
+	src := inMemVerificationSide([]SchemaRecord{
+		{Subject: testingSubject, Version: 1, Id: 1, Schema: mockSchema, SType: "AVRO"},
+		{Subject: testingSubject, Version: 2, Id: 2, Schema: schemaToReferenceDTwo, SType: "AVRO"},
+		{Subject: newSubject, Version: 1, Id: 3, Schema: mockSchema, SType: "AVRO"},
+	}, map[string][]int64{testingSubject: {2}}, map[string]string{testingSubject: "FULL"})
+
+	dst := inMemVerificationSide([]SchemaRecord{
+		{Subject: testingSubject, Version: 1, Id: 1, Schema: mockSchema, SType: "AVRO"},
+		{Subject: testingSubject, Version: 2, Id: 4, Schema: schemaToReferenceDTwo, SType: "AVRO"},
+	}, map[string][]int64{}, map[string]string{})
+
+	results := verifySubjects(src, dst, true)
+	assert.Equal(t, 2, len(results))
+
+	mismatchedFields := map[string]bool{}
+	for _, result := range results {
+		for _, mismatch := range result.Mismatches {
+			mismatchedFields[mismatch.Subject+"/"+mismatch.Field] = true
+		}
+	}
+
+	assert.Equal(t, map[string]bool{
+		newSubject + "/subject":           true,
+		testingSubject + "/softDeleted":   true,
+		testingSubject + "/id":            true,
+		testingSubject + "/compatibility": true,
+	}, mismatchedFields)
+
+	matching := verifySubjects(dst, dst, true)
+	assert.False(t, VerificationReport{Subjects: matching}.HasMismatches())
+}
+
+func TWriteVerificationReport(t *testing.T) {
+	report := VerificationReport{
+		SourceUrl:      "http://source",
+		DestinationUrl: "http://destination",
+		Subjects: []SubjectVerification{
+			{Subject: testingSubject, Mismatches: []VerificationMismatch{
+				{Subject: testingSubject, Version: 1, Field: "id", Source: "1", Destination: "2"},
+			}},
+			{Subject: newSubject, Mismatches: []VerificationMismatch{}},
+		},
+	}
+
+	var junit bytes.Buffer
+	assert.Nil(t, WriteVerificationReport(report, "junit", &junit))
+	assert.True(t, strings.Contains(junit.String(), `tests="2" failures="1"`))
+
+	var text bytes.Buffer
+	assert.Nil(t, WriteVerificationReport(report, "TEXT", &text))
+	assert.True(t, strings.Contains(text.String(), "MISMATCH "+testingSubject))
+
+	assert.NotNil(t, WriteVerificationReport(report, "YAML", &text))
+}